@@ -0,0 +1,261 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/model"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/validator"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"strings"
+)
+
+func (app *application) listRolesHandler(w http.ResponseWriter, r *http.Request) {
+	roles, err := app.models.Roles.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"roles": roles}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	permissions, err := app.models.Permissions.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"permissions": permissions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showUserAccessHandler returns a user's roles, the permissions granted to
+// them directly and the permissions they end up with.
+func (app *application) showUserAccessHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	roles, err := app.models.Roles.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	direct, err := app.models.Permissions.GetDirectForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{
+		"user":               user,
+		"roles":              roles,
+		"direct_permissions": direct,
+		"permissions":        permissions,
+	}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) grantRoleHandler(w http.ResponseWriter, r *http.Request) {
+	app.changeUserRole(w, r, true)
+}
+
+func (app *application) revokeRoleHandler(w http.ResponseWriter, r *http.Request) {
+	app.changeUserRole(w, r, false)
+}
+
+func (app *application) changeUserRole(w http.ResponseWriter, r *http.Request, grant bool) {
+	user, ok := app.readTargetUser(w, r)
+	if !ok {
+		return
+	}
+	actor := app.contextGetUser(r)
+	role := httprouter.ParamsFromContext(r.Context()).ByName("role")
+
+	roles, err := app.models.Roles.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	codes := make([]string, len(roles))
+	for i := range roles {
+		codes[i] = roles[i].Code
+	}
+
+	v := validator.New()
+	v.Check(validator.In(role, codes...), "role", "unknown role")
+	if !grant {
+		v.Check(actor.ID != user.ID || role != model.RoleAdmin, "role", "you can't revoke your own admin role")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	entry := accessChange(actor, user, model.AuditRoleGranted, map[string]string{"role": role})
+	if !grant {
+		entry.Action = model.AuditRoleRevoked
+	}
+
+	err = app.models.Roles.ChangeForUser(user.ID, role, grant, entry)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeAccessChange(w, r, entry)
+}
+
+func (app *application) grantPermissionHandler(w http.ResponseWriter, r *http.Request) {
+	app.changeUserPermission(w, r, true)
+}
+
+func (app *application) revokePermissionHandler(w http.ResponseWriter, r *http.Request) {
+	app.changeUserPermission(w, r, false)
+}
+
+func (app *application) changeUserPermission(w http.ResponseWriter, r *http.Request, grant bool) {
+	user, ok := app.readTargetUser(w, r)
+	if !ok {
+		return
+	}
+	actor := app.contextGetUser(r)
+	code := httprouter.ParamsFromContext(r.Context()).ByName("code")
+
+	codes, err := app.models.Permissions.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if v.Check(codes.Include(code), "permission", "unknown permission"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Revoking a direct grant leaves the permissions of the user's roles, so
+	// a permission that a role grants has to be revoked with the role.
+	if !grant {
+		roles, err := app.models.Roles.GetGrantingForUser(user.ID, code)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if len(roles) > 0 {
+			v.AddError("permission", fmt.Sprintf("still granted by role %s", strings.Join(roles, ", ")))
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	entry := accessChange(actor, user, model.AuditPermissionGranted, map[string]string{"permission": code})
+	if !grant {
+		entry.Action = model.AuditPermissionRevoked
+	}
+
+	err = app.models.Permissions.ChangeForUser(user.ID, code, grant, entry)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeAccessChange(w, r, entry)
+}
+
+// accessChange returns the audit entry for a change to a user's roles or
+// permissions.
+func accessChange(actor, user *model.User, action string, details map[string]string) *model.AuditEntry {
+	return &model.AuditEntry{
+		ActorID:      &actor.ID,
+		Action:       action,
+		TargetUserID: &user.ID,
+		Details:      details,
+	}
+}
+
+// writeAccessChange responds with the audit entry of a change to a user's
+// roles or permissions.
+func (app *application) writeAccessChange(w http.ResponseWriter, r *http.Request, entry *model.AuditEntry) {
+	err := app.writeJSON(w, http.StatusOK, envelope{"audit_entry": entry}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ActorID      int
+		TargetUserID int
+		Action       string
+		model.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.ActorID = app.readInt(qs, "actor_id", 0, v)
+	input.TargetUserID = app.readInt(qs, "user_id", 0, v)
+	input.Action = app.readString(qs, "action", "")
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "-created_at")
+	input.Filters.SortSafelist = []string{"id", "created_at", "-id", "-created_at"}
+
+	if model.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	entries, metadata, err := app.models.Audit.GetAll(int64(input.ActorID), int64(input.TargetUserID), input.Action, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"audit_log": entries, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readTargetUser loads the user named by the id parameter, responding with
+// 404 and returning false if there is none.
+func (app *application) readTargetUser(w http.ResponseWriter, r *http.Request) (*model.User, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	user, err := app.models.Users.GetByID(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return user, true
+}
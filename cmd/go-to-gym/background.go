@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// background runs fn in its own goroutine. At most -background-workers tasks
+// run at once; the rest wait for a free worker. serve waits for every task,
+// running or waiting, before it returns.
+func (app *application) background(name string, fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		app.workers <- struct{}{}
+		defer func() { <-app.workers }()
+
+		app.runTask(name, fn)
+	}()
+}
+
+// every runs fn every interval until the server shuts down. Runs don't take
+// a worker, so periodic upkeep can't be starved by queued tasks.
+func (app *application) every(name string, interval time.Duration, fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-app.stop:
+				return
+			case <-ticker.C:
+				app.runTask(name, fn)
+			}
+		}
+	}()
+}
+
+func (app *application) runTask(name string, fn func()) {
+	defer func() {
+		if err := recover(); err != nil {
+			app.logger.PrintError(fmt.Errorf("%s", err), map[string]string{
+				"task": name,
+			})
+		}
+	}()
+
+	fn()
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/model"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/validator"
+	"net/http"
+)
+
+func (app *application) createCatalogExerciseHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name             string   `json:"name"`
+		Aliases          []string `json:"aliases"`
+		PrimaryMuscles   []string `json:"primary_muscles"`
+		SecondaryMuscles []string `json:"secondary_muscles"`
+		Equipment        string   `json:"equipment"`
+		Category         string   `json:"category"`
+		MET              float64  `json:"met"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Aliases == nil {
+		input.Aliases = []string{}
+	}
+	if input.PrimaryMuscles == nil {
+		input.PrimaryMuscles = []string{}
+	}
+	if input.SecondaryMuscles == nil {
+		input.SecondaryMuscles = []string{}
+	}
+	if input.Category == "" {
+		input.Category = "other"
+	}
+	if input.MET == 0 {
+		input.MET = model.CategoryMET(input.Category)
+	}
+
+	entry := &model.CatalogExercise{
+		Name:             input.Name,
+		Aliases:          input.Aliases,
+		PrimaryMuscles:   input.PrimaryMuscles,
+		SecondaryMuscles: input.SecondaryMuscles,
+		Equipment:        input.Equipment,
+		Category:         input.Category,
+		MET:              input.MET,
+	}
+
+	v := validator.New()
+	if model.ValidateCatalogExercise(v, entry); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Catalog.Insert(entry)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrDuplicateCatalogName):
+			v.AddError("name", "an exercise with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/catalog/exercises/%d", entry.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"exercise": entry}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showCatalogExerciseHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	entry, err := app.models.Catalog.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"exercise": entry}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateCatalogExerciseHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	entry, err := app.models.Catalog.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Name             *string   `json:"name"`
+		Aliases          *[]string `json:"aliases"`
+		PrimaryMuscles   *[]string `json:"primary_muscles"`
+		SecondaryMuscles *[]string `json:"secondary_muscles"`
+		Equipment        *string   `json:"equipment"`
+		Category         *string   `json:"category"`
+		MET              *float64  `json:"met"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		entry.Name = *input.Name
+	}
+	if input.Aliases != nil {
+		entry.Aliases = *input.Aliases
+	}
+	if input.PrimaryMuscles != nil {
+		entry.PrimaryMuscles = *input.PrimaryMuscles
+	}
+	if input.SecondaryMuscles != nil {
+		entry.SecondaryMuscles = *input.SecondaryMuscles
+	}
+	if input.Equipment != nil {
+		entry.Equipment = *input.Equipment
+	}
+	if input.Category != nil {
+		entry.Category = *input.Category
+	}
+	if input.MET != nil {
+		entry.MET = *input.MET
+	}
+
+	v := validator.New()
+	if model.ValidateCatalogExercise(v, entry); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Catalog.Update(entry)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrDuplicateCatalogName):
+			v.AddError("name", "an exercise with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"exercise": entry}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteCatalogExerciseHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Catalog.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, model.ErrCatalogEntryInUse):
+			app.resourceInUseResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "catalog exercise successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listCatalogExercisesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name      string
+		Muscle    string
+		Equipment string
+		Category  string
+		model.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Name = app.readString(qs, "name", "")
+	input.Muscle = app.readString(qs, "muscle", "")
+	input.Equipment = app.readString(qs, "equipment", "")
+	input.Category = app.readString(qs, "category", "")
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "name")
+	input.Filters.SortSafelist = []string{"id", "name", "category", "-id", "-name", "-category"}
+
+	v.Check(input.Muscle == "" || validator.In(input.Muscle, model.MuscleGroups...), "muscle", "invalid muscle group")
+	v.Check(input.Category == "" || validator.In(input.Category, model.CatalogCategories...), "category", "invalid category")
+
+	if model.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	entries, metadata, err := app.models.Catalog.GetAll(input.Name, input.Muscle, input.Equipment, input.Category, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"exercises": entries, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// resolveCatalogIDs turns the exercise names (or aliases) and catalog IDs of
+// a workout request into catalog IDs. Unknown entries are recorded on v.
+func (app *application) resolveCatalogIDs(v *validator.Validator, names []string, catalogIDs []int64) ([]int64, error) {
+	if len(names) > 0 && len(catalogIDs) > 0 {
+		v.AddError("catalog_ids", "must not be combined with exercises")
+		return nil, nil
+	}
+
+	var resolved []int64
+
+	for _, name := range names {
+		entry, err := app.models.Catalog.GetByName(name)
+		if err != nil {
+			switch {
+			case errors.Is(err, model.ErrRecordNotFound):
+				v.AddError("exercises", fmt.Sprintf("%q is not in the exercise catalog", name))
+				continue
+			default:
+				return nil, err
+			}
+		}
+		resolved = append(resolved, entry.ID)
+	}
+
+	for _, id := range catalogIDs {
+		entry, err := app.models.Catalog.Get(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, model.ErrRecordNotFound):
+				v.AddError("catalog_ids", fmt.Sprintf("%d is not in the exercise catalog", id))
+				continue
+			default:
+				return nil, err
+			}
+		}
+		resolved = append(resolved, entry.ID)
+	}
+
+	return resolved, nil
+}
+
+// resolveCatalogEntry finds the catalog entry for a single exercise either by
+// ID or by name. It returns nil when neither is given or the entry is unknown,
+// in which case the problem is recorded on v.
+func (app *application) resolveCatalogEntry(v *validator.Validator, name string, catalogID int64) (*model.CatalogExercise, error) {
+	var entry *model.CatalogExercise
+	var err error
+
+	switch {
+	case catalogID != 0:
+		entry, err = app.models.Catalog.Get(catalogID)
+		if errors.Is(err, model.ErrRecordNotFound) {
+			v.AddError("catalog_id", "must reference an existing catalog exercise")
+			return nil, nil
+		}
+	case name != "":
+		entry, err = app.models.Catalog.GetByName(name)
+		if errors.Is(err, model.ErrRecordNotFound) {
+			v.AddError("name", "must match an exercise in the catalog")
+			return nil, nil
+		}
+	default:
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/mailer"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/model"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/validator"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// inviteClientHandler emails an invitation to the activated user with the
+// given address. Inviting them again sends a new token and replaces the old
+// one. Like password resets it always responds 202, so that coaches can't
+// find out who has an account.
+func (app *application) inviteClientHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if model.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	coach, err := app.models.Users.GetByID(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if v.Check(!strings.EqualFold(input.Email, coach.Email), "email", "you can't coach yourself"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	client, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil && !errors.Is(err, model.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if client != nil && client.Activated {
+		err = app.inviteClient(coach, client)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	message := "if an activated account with that email address exists, it will receive an invitation"
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"message": message}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// inviteClient emails client an invitation to be coached by coach, unless
+// coach is already coaching them.
+func (app *application) inviteClient(coach, client *model.User) error {
+	token, err := app.models.Tokens.New(client.ID, 7*24*time.Hour, model.ScopeCoachInvite)
+	if err != nil {
+		return err
+	}
+
+	_, err = app.models.Coaching.Invite(coach.ID, client.ID, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrAlreadyCoached):
+			return app.models.Tokens.Delete(model.ScopeCoachInvite, token.Plaintext)
+		default:
+			return err
+		}
+	}
+
+	app.sendEmail(client.Email, mailer.TemplateCoachInvite, map[string]any{
+		"coachName":       coach.Name,
+		"invitationToken": token.Plaintext,
+	})
+	return nil
+}
+
+func (app *application) listClientsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	links, err := app.models.Coaching.GetAllForCoach(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"links": links}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listCoachesHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	links, err := app.models.Coaching.GetAllForClient(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"links": links}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// acceptInvitationHandler lets the invited user accept with the token from the
+// invitation email, giving the coach access to their data.
+func (app *application) acceptInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if model.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	invited, err := app.models.Users.GetForToken(model.ScopeCoachInvite, input.TokenPlaintext)
+	if err != nil && !errors.Is(err, model.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if invited == nil || invited.ID != user.ID {
+		v.AddError("token", "invalid or expired invitation token")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	link, err := app.models.Coaching.Accept(user.ID, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired invitation token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Tokens.Delete(model.ScopeCoachInvite, input.TokenPlaintext)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"link": link}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteCoachingLinkHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Coaching.Delete(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "coaching successfully ended"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createAssignmentHandler assigns one of the coach's workouts or programs, or
+// any they can read, to a client who accepted them.
+func (app *application) createAssignmentHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		WorkoutID *int64 `json:"workout_id"`
+		ProgramID *int64 `json:"program_id"`
+		Notes     string `json:"notes"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	link, err := app.models.Coaching.GetActive(user.ID, app.contextGetOwnerID(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notPermittedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	assignment := &model.Assignment{
+		LinkID:    link.ID,
+		CoachID:   link.Coach.ID,
+		ClientID:  link.Client.ID,
+		WorkoutID: input.WorkoutID,
+		ProgramID: input.ProgramID,
+		Notes:     input.Notes,
+	}
+
+	v := validator.New()
+	if model.ValidateAssignment(v, assignment); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if assignment.WorkoutID != nil {
+		_, err = app.models.Workouts.Get(*assignment.WorkoutID, user.ID)
+		if errors.Is(err, model.ErrRecordNotFound) {
+			v.AddError("workout_id", "workout not found")
+		}
+	} else {
+		_, err = app.models.Programs.Get(*assignment.ProgramID, user.ID)
+		if errors.Is(err, model.ErrRecordNotFound) {
+			v.AddError("program_id", "program not found")
+		}
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Coaching.InsertAssignment(assignment)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/coaching/clients/%d/assignments", assignment.ClientID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"assignment": assignment}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listAssignmentsHandler returns the assignments of the client in the :client
+// parameter. A coach sees only their own; a client sees all of theirs.
+func (app *application) listAssignmentsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	ownerID := app.contextGetOwnerID(r)
+
+	var coachID int64
+	if ownerID != user.ID {
+		coachID = user.ID
+	}
+
+	assignments, err := app.models.Coaching.GetAllAssignments(coachID, ownerID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"assignments": assignments}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteAssignmentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Coaching.DeleteAssignment(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "assignment successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -8,7 +8,12 @@ import (
 
 type contextKey string
 
-const userContextKey = contextKey("user")
+const (
+	userContextKey        = contextKey("user")
+	tokenContextKey       = contextKey("token")
+	permissionsContextKey = contextKey("permissions")
+	ownerContextKey       = contextKey("owner")
+)
 
 func (app *application) contextSetUser(r *http.Request, user *model.User) *http.Request {
 	ctx := context.WithValue(r.Context(), userContextKey, user)
@@ -22,3 +27,42 @@ func (app *application) contextGetUser(r *http.Request) *model.User {
 	}
 	return user
 }
+
+func (app *application) contextSetToken(r *http.Request, token string) *http.Request {
+	ctx := context.WithValue(r.Context(), tokenContextKey, token)
+	return r.WithContext(ctx)
+}
+
+// contextGetToken returns the authentication token of the request, or "" for
+// anonymous requests.
+func (app *application) contextGetToken(r *http.Request) string {
+	token, _ := r.Context().Value(tokenContextKey).(string)
+	return token
+}
+
+func (app *application) contextSetPermissions(r *http.Request, permissions model.Permissions) *http.Request {
+	ctx := context.WithValue(r.Context(), permissionsContextKey, permissions)
+	return r.WithContext(ctx)
+}
+
+// contextGetPermissions returns the permissions carried by a signed access
+// token. ok is false when they have to be loaded from the database.
+func (app *application) contextGetPermissions(r *http.Request) (model.Permissions, bool) {
+	permissions, ok := r.Context().Value(permissionsContextKey).(model.Permissions)
+	return permissions, ok
+}
+
+func (app *application) contextSetOwnerID(r *http.Request, ownerID int64) *http.Request {
+	ctx := context.WithValue(r.Context(), ownerContextKey, ownerID)
+	return r.WithContext(ctx)
+}
+
+// contextGetOwnerID returns the user whose data the request reads: the client
+// on a coach's requests for client data, and otherwise the current user.
+func (app *application) contextGetOwnerID(r *http.Request) int64 {
+	ownerID, ok := r.Context().Value(ownerContextKey).(int64)
+	if !ok {
+		return app.contextGetUser(r).ID
+	}
+	return ownerID
+}
@@ -2,7 +2,10 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func (app *application) logError(r *http.Request, err error) {
@@ -50,11 +53,24 @@ func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Requ
 	app.errorResponse(w, r, http.StatusConflict, message)
 }
 
+func (app *application) resourceInUseResponse(w http.ResponseWriter, r *http.Request) {
+	message := "unable to delete the record because other records still refer to it"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
 func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
 	message := "rate limit exceeded"
 	app.errorResponse(w, r, http.StatusTooManyRequests, message)
 }
 
+// accountLockedResponse is sent for locked email addresses whether or not they
+// have an account.
+func (app *application) accountLockedResponse(w http.ResponseWriter, r *http.Request, lockedUntil time.Time) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(lockedUntil).Seconds()))))
+	message := "too many failed login attempts, please try again later or follow the unlock instructions emailed to the account"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
 func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
 	message := "invalid authentication credentials"
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
@@ -10,36 +10,75 @@ import (
 
 func (app *application) createExerciseHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Name      string `json:"name"`
-		Sets      int    `json:"sets"`
-		Reps      int    `json:"reps"`
-		WorkoutID int    `json:"workout_id"`
+		Name         string  `json:"name"`
+		CatalogID    int64   `json:"catalog_id"`
+		Sets         int     `json:"sets"`
+		Reps         int     `json:"reps"`
+		Weight       float64 `json:"weight"`
+		WeightUnit   string  `json:"weight_unit"`
+		Duration     int     `json:"duration_seconds"`
+		Distance     float64 `json:"distance"`
+		DistanceUnit string  `json:"distance_unit"`
+		Tempo        string  `json:"tempo"`
+		WorkoutID    int     `json:"workout_id"`
 	}
 
+	v := validator.New()
+	units := app.readUnits(r.URL.Query(), v)
+
 	err := app.readJSON(w, r, &input)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
+	if input.WeightUnit == "" {
+		input.WeightUnit = model.UnitKilograms
+	}
+	if input.DistanceUnit == "" {
+		input.DistanceUnit = model.UnitKilometers
+	}
+
+	user := app.contextGetUser(r)
 
 	exercise := &model.Exercise{
-		Name:      input.Name,
-		Sets:      input.Sets,
-		Reps:      input.Reps,
-		WorkoutID: input.WorkoutID,
+		UserID:       user.ID,
+		Name:         input.Name,
+		Sets:         input.Sets,
+		Reps:         input.Reps,
+		Weight:       input.Weight,
+		WeightUnit:   input.WeightUnit,
+		Duration:     input.Duration,
+		Distance:     input.Distance,
+		DistanceUnit: input.DistanceUnit,
+		Tempo:        input.Tempo,
+		WorkoutID:    input.WorkoutID,
+	}
+
+	entry, err := app.resolveCatalogEntry(v, input.Name, input.CatalogID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if entry != nil {
+		exercise.CatalogID = entry.ID
+		exercise.Name = entry.Name
 	}
 
-	v := validator.New()
 	if model.ValidateExercise(v, exercise); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
+	if !app.checkExerciseWorkout(w, r, exercise.WorkoutID) {
+		return
+	}
+
 	err = app.models.Exercises.Insert(exercise)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	exercise.ConvertUnits(units)
 
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/exercises/%d", exercise.ID))
@@ -56,7 +95,16 @@ func (app *application) showExerciseHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	exercise, err := app.models.Exercises.Get(id)
+	v := validator.New()
+	units := app.readUnits(r.URL.Query(), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	exercise, err := app.models.Exercises.Get(id, user.ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, model.ErrRecordNotFound):
@@ -66,6 +114,7 @@ func (app *application) showExerciseHandler(w http.ResponseWriter, r *http.Reque
 		}
 		return
 	}
+	exercise.ConvertUnits(units)
 
 	err = app.writeJSON(w, http.StatusOK, envelope{"exercise": exercise}, nil)
 	if err != nil {
@@ -80,7 +129,16 @@ func (app *application) updateExerciseHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	exercise, err := app.models.Exercises.Get(id)
+	v := validator.New()
+	units := app.readUnits(r.URL.Query(), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	exercise, err := app.models.Exercises.Get(id, user.ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, model.ErrRecordNotFound):
@@ -91,11 +149,23 @@ func (app *application) updateExerciseHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	if exercise.UserID != user.ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
 	var input struct {
-		Name      *string `json:"name"`
-		Sets      *int    `json:"sets"`
-		Reps      *int    `json:"reps"`
-		WorkoutID *int    `json:"workout_id"`
+		Name         *string  `json:"name"`
+		CatalogID    *int64   `json:"catalog_id"`
+		Sets         *int     `json:"sets"`
+		Reps         *int     `json:"reps"`
+		Weight       *float64 `json:"weight"`
+		WeightUnit   *string  `json:"weight_unit"`
+		Duration     *int     `json:"duration_seconds"`
+		Distance     *float64 `json:"distance"`
+		DistanceUnit *string  `json:"distance_unit"`
+		Tempo        *string  `json:"tempo"`
+		WorkoutID    *int     `json:"workout_id"`
 	}
 
 	err = app.readJSON(w, r, &input)
@@ -104,8 +174,24 @@ func (app *application) updateExerciseHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	if input.Name != nil {
-		exercise.Name = *input.Name
+	if input.Name != nil || input.CatalogID != nil {
+		var name string
+		var catalogID int64
+		if input.Name != nil {
+			name = *input.Name
+		}
+		if input.CatalogID != nil {
+			catalogID = *input.CatalogID
+		}
+		entry, err := app.resolveCatalogEntry(v, name, catalogID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if entry != nil {
+			exercise.CatalogID = entry.ID
+			exercise.Name = entry.Name
+		}
 	}
 	if input.Sets != nil {
 		exercise.Sets = *input.Sets
@@ -113,16 +199,37 @@ func (app *application) updateExerciseHandler(w http.ResponseWriter, r *http.Req
 	if input.Reps != nil {
 		exercise.Reps = *input.Reps
 	}
+	if input.Weight != nil {
+		exercise.Weight = *input.Weight
+	}
+	if input.WeightUnit != nil {
+		exercise.WeightUnit = *input.WeightUnit
+	}
+	if input.Duration != nil {
+		exercise.Duration = *input.Duration
+	}
+	if input.Distance != nil {
+		exercise.Distance = *input.Distance
+	}
+	if input.DistanceUnit != nil {
+		exercise.DistanceUnit = *input.DistanceUnit
+	}
+	if input.Tempo != nil {
+		exercise.Tempo = *input.Tempo
+	}
 	if input.WorkoutID != nil {
 		exercise.WorkoutID = *input.WorkoutID
 	}
 
-	v := validator.New()
 	if model.ValidateExercise(v, exercise); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
+	if input.WorkoutID != nil && !app.checkExerciseWorkout(w, r, exercise.WorkoutID) {
+		return
+	}
+
 	err = app.models.Exercises.Update(exercise)
 	if err != nil {
 		switch {
@@ -133,6 +240,7 @@ func (app *application) updateExerciseHandler(w http.ResponseWriter, r *http.Req
 		}
 		return
 	}
+	exercise.ConvertUnits(units)
 
 	err = app.writeJSON(w, http.StatusOK, envelope{"exercise": exercise}, nil)
 	if err != nil {
@@ -147,7 +255,25 @@ func (app *application) deleteExerciseHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	err = app.models.Exercises.Delete(id)
+	user := app.contextGetUser(r)
+
+	exercise, err := app.models.Exercises.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if exercise.UserID != user.ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	err = app.models.Exercises.Delete(exercise.ID, user.ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, model.ErrRecordNotFound):
@@ -172,9 +298,16 @@ func (app *application) listExercisesHandler(w http.ResponseWriter, r *http.Requ
 	}
 
 	var input struct {
-		Name    string
-		SetFrom int
-		SetTo   int
+		Name         string
+		SetFrom      int
+		SetTo        int
+		WeightFrom   int
+		WeightTo     int
+		DurationFrom int
+		DurationTo   int
+		DistanceFrom int
+		DistanceTo   int
+		Units        string
 		model.Filters
 	}
 
@@ -184,26 +317,88 @@ func (app *application) listExercisesHandler(w http.ResponseWriter, r *http.Requ
 	input.Name = app.readString(qs, "name", "")
 	input.SetFrom = app.readInt(qs, "setFrom", 0, v)
 	input.SetTo = app.readInt(qs, "setTo", 0, v)
+	input.WeightFrom = app.readInt(qs, "weightFrom", 0, v)
+	input.WeightTo = app.readInt(qs, "weightTo", 0, v)
+	input.DurationFrom = app.readInt(qs, "durationFrom", 0, v)
+	input.DurationTo = app.readInt(qs, "durationTo", 0, v)
+	input.DistanceFrom = app.readInt(qs, "distanceFrom", 0, v)
+	input.DistanceTo = app.readInt(qs, "distanceTo", 0, v)
+	input.Units = app.readUnits(qs, v)
 
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
 
-	input.Filters.Sort = app.readString(qs, "sort", "id")
-	input.Filters.SortSafelist = []string{"id", "name", "sets", "reps", "-id", "-name", "-sets", "-reps"}
+	input.Filters.Sort = app.readString(qs, "sort", "position")
+	input.Filters.SortSafelist = []string{"id", "position", "name", "sets", "reps", "-id", "-position", "-name", "-sets", "-reps"}
 
 	if model.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	exercises, metadata, err := app.models.Exercises.GetAll(input.Name, int(id), input.SetFrom, input.SetTo, input.Filters)
+	user := app.contextGetUser(r)
+
+	_, err = app.models.Workouts.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Weight and distance bounds are read in the requested unit system and
+	// compared in kilograms and kilometres by the model.
+	weightFrom := model.ToKilograms(float64(input.WeightFrom), input.Units)
+	weightTo := model.ToKilograms(float64(input.WeightTo), input.Units)
+	distanceFrom := model.ToKilometers(float64(input.DistanceFrom), input.Units)
+	distanceTo := model.ToKilometers(float64(input.DistanceTo), input.Units)
+
+	exercises, metadata, err := app.models.Exercises.GetAll(input.Name, int(id), input.SetFrom, input.SetTo, weightFrom, weightTo, input.DurationFrom, input.DurationTo, distanceFrom, distanceTo, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	for _, exercise := range exercises {
+		exercise.ConvertUnits(input.Units)
+	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"exercises": exercises, "metadata": metadata}, nil)
+	groups, err := app.models.Workouts.GetExerciseGroups(id)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"exercises": exercises, "groups": groups, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// checkExerciseWorkout makes sure that exercises are only attached to workouts
+// owned by the current user. It writes the error response itself and reports
+// whether the handler may carry on.
+func (app *application) checkExerciseWorkout(w http.ResponseWriter, r *http.Request, workoutID int) bool {
+	user := app.contextGetUser(r)
+
+	workout, err := app.models.Workouts.Get(int64(workoutID), user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			v := validator.New()
+			v.AddError("workout_id", "must reference an existing workout")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return false
+	}
+
+	if !workout.IsOwnedBy(user) {
+		app.notPermittedResponse(w, r)
+		return false
 	}
+	return true
 }
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/model"
+	"io"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportTTL is how long a finished export can be downloaded.
+const exportTTL = 7 * 24 * time.Hour
+
+// createExportHandler starts building an archive of the user's data. While an
+// export is being built, asking again returns that one.
+func (app *application) createExportHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	export, err := app.models.Exports.GetPending(user.ID)
+	if err != nil && !errors.Is(err, model.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if export == nil {
+		export = &model.DataExport{UserID: user.ID}
+
+		err = app.models.Exports.Insert(export)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.background("data export", func() {
+			app.runExport(export)
+		})
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/users/me/export/%d", export.ID))
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"export": export}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showExportHandler downloads a ready export, or else describes it: 202
+// Accepted while it is being built.
+func (app *application) showExportHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	export, err := app.models.Exports.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	switch export.Status {
+	case model.ExportPending:
+		err = app.writeJSON(w, http.StatusAccepted, envelope{"export": export}, nil)
+	case model.ExportFailed:
+		err = app.writeJSON(w, http.StatusOK, envelope{"export": export}, nil)
+	default:
+		var archive []byte
+		archive, err = app.models.Exports.GetArchive(export.ID, user.ID)
+		if err != nil {
+			break
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="gotogym-export-%d.zip"`, export.ID))
+		w.Header().Set("Content-Length", strconv.Itoa(len(archive)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(archive)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+func (app *application) runExport(export *model.DataExport) {
+	archive, err := app.buildExport(export.UserID)
+	if err == nil {
+		err = app.models.Exports.Finish(export, archive, exportTTL)
+	}
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{
+			"export_id": strconv.FormatInt(export.ID, 10),
+		})
+		err = app.models.Exports.Fail(export)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	}
+}
+
+func (app *application) deleteExpiredExports() {
+	count, err := app.models.Exports.DeleteExpired()
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+	if count > 0 {
+		app.logger.PrintInfo("deleted expired exports", map[string]string{
+			"count": strconv.FormatInt(count, 10),
+		})
+	}
+}
+
+// buildExport returns a ZIP archive with a JSON and a CSV file for each kind
+// of data stored about the user.
+func (app *application) buildExport(userID int64) ([]byte, error) {
+	user, err := app.models.Users.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	bodyweight, err := app.models.Measurements.LatestBodyweight(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Workouts are listed with everyone's public ones; only the user's own are
+	// exported.
+	listed, err := allPages(func(filters model.Filters) ([]*model.Workout, model.Metadata, error) {
+		return app.models.Workouts.GetAll(userID, bodyweight, "", nil, 0, 0, filters)
+	})
+	if err != nil {
+		return nil, err
+	}
+	workouts := []*model.Workout{}
+	exercises := []*model.Exercise{}
+	for _, workout := range listed {
+		if workout.UserID != userID {
+			continue
+		}
+		workout.SetCalories(bodyweight)
+		workouts = append(workouts, workout)
+
+		workoutExercises, err := app.models.Exercises.GetAllForWorkout(workout.ID)
+		if err != nil {
+			return nil, err
+		}
+		exercises = append(exercises, workoutExercises...)
+	}
+
+	sessions, err := allPages(func(filters model.Filters) ([]*model.WorkoutSession, model.Metadata, error) {
+		return app.models.Sessions.GetAll(userID, 0, nil, nil, filters)
+	})
+	if err != nil {
+		return nil, err
+	}
+	sets := []*model.SessionSet{}
+	for _, session := range sessions {
+		session.SetCalories(bodyweight)
+		session.Sets, err = app.models.Sessions.GetAllSets(session.ID)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, session.Sets...)
+	}
+
+	measurements, err := allPages(func(filters model.Filters) ([]*model.Measurement, model.Metadata, error) {
+		return app.models.Measurements.GetAll(userID, "", nil, nil, filters)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logins, err := app.models.Tokens.GetAllSessionsForUser(userID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	apiKeys, err := app.models.APIKeys.GetAllForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	access, err := app.exportAccess(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	files := []struct {
+		name    string
+		records any
+		skip    []string
+	}{
+		{"profile", []*model.User{user}, nil},
+		{"workouts", workouts, nil},
+		{"exercises", exercises, nil},
+		{"sessions", sessions, []string{"sets"}},
+		{"session_sets", sets, nil},
+		{"measurements", measurements, nil},
+		{"login_sessions", logins, nil},
+		{"api_keys", apiKeys, nil},
+		{"permissions", access, nil},
+	}
+	for _, file := range files {
+		err = writeExportFile(zw, file.name, file.records, file.skip...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = zw.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type accessRecord struct {
+	Kind string `json:"kind"`
+	Code string `json:"code"`
+}
+
+// exportAccess lists the user's roles followed by the permissions they end up
+// with.
+func (app *application) exportAccess(userID int64) ([]accessRecord, error) {
+	roles, err := app.models.Roles.GetAllForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	permissions, err := app.models.Permissions.GetAllForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	access := []accessRecord{}
+	for _, role := range roles {
+		access = append(access, accessRecord{Kind: "role", Code: role})
+	}
+	for _, permission := range permissions {
+		access = append(access, accessRecord{Kind: "permission", Code: permission})
+	}
+	return access, nil
+}
+
+// allPages collects every page of a GetAll method, in order of ID.
+func allPages[T any](getAll func(model.Filters) ([]T, model.Metadata, error)) ([]T, error) {
+	filters := model.Filters{Page: 1, PageSize: 100, Sort: "id", SortSafelist: []string{"id"}}
+
+	all := []T{}
+	for {
+		page, _, err := getAll(filters)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, page...)
+		if len(page) < filters.PageSize {
+			return all, nil
+		}
+		filters.Page++
+	}
+}
+
+// writeExportFile adds name.json, with the records in an envelope like the
+// API's responses, and name.csv to the archive.
+func writeExportFile(zw *zip.Writer, name string, records any, skip ...string) error {
+	js, err := json.MarshalIndent(envelope{name: records}, "", "\t")
+	if err != nil {
+		return err
+	}
+	f, err := zw.Create(name + ".json")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(js, '\n'))
+	if err != nil {
+		return err
+	}
+
+	f, err = zw.Create(name + ".csv")
+	if err != nil {
+		return err
+	}
+	return writeCSV(f, records, skip...)
+}
+
+// writeCSV writes a slice of structs as CSV with a column for each JSON field
+// except those in skip. Values are written as they are encoded in JSON, with
+// strings unquoted and nulls left empty.
+func writeCSV(w io.Writer, records any, skip ...string) error {
+	rv := reflect.ValueOf(records)
+	if rv.Kind() != reflect.Slice {
+		return fmt.Errorf("writeCSV: %T is not a slice", records)
+	}
+
+	rt := rv.Type().Elem()
+	if rt.Kind() == reflect.Pointer {
+		rt = rt.Elem()
+	}
+
+	var (
+		header []string
+		fields []int
+	)
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if slices.Contains(skip, name) {
+			continue
+		}
+		header = append(header, name)
+		fields = append(fields, i)
+	}
+
+	cw := csv.NewWriter(w)
+	err := cw.Write(header)
+	if err != nil {
+		return err
+	}
+
+	row := make([]string, len(fields))
+	for i := 0; i < rv.Len(); i++ {
+		record := reflect.Indirect(rv.Index(i))
+		for j, field := range fields {
+			row[j], err = csvValue(record.Field(field).Interface())
+			if err != nil {
+				return err
+			}
+		}
+		err = cw.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func csvValue(value any) (string, error) {
+	js, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case string(js) == "null":
+		return "", nil
+	case js[0] == '"':
+		var s string
+		err = json.Unmarshal(js, &s)
+		return s, err
+	default:
+		return string(js), nil
+	}
+}
@@ -4,13 +4,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/model"
 	"github.com/holydanchik/GoToGym/pkg/go-to-gym/validator"
 	"github.com/julienschmidt/httprouter"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type envelope map[string]interface{}
@@ -24,6 +27,16 @@ func (app *application) readIDParam(r *http.Request) (int64, error) {
 	return id, nil
 }
 
+// readIntParam reads a positive integer route parameter other than the id.
+func (app *application) readIntParam(r *http.Request, name string) (int, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+	i, err := strconv.Atoi(params.ByName(name))
+	if err != nil || i < 1 {
+		return 0, fmt.Errorf("invalid %s parameter", name)
+	}
+	return i, nil
+}
+
 func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
 	js, err := json.MarshalIndent(data, "", "\t")
 	if err != nil {
@@ -107,3 +120,83 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	}
 	return i
 }
+
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+	return b
+}
+
+func (app *application) readDate(qs url.Values, key string, v *validator.Validator) *time.Time {
+	s := qs.Get(key)
+	if s == "" {
+		return nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		v.AddError(key, "must be a date in YYYY-MM-DD format")
+		return nil
+	}
+	return &t
+}
+
+func (app *application) readUnits(qs url.Values, v *validator.Validator) string {
+	units := qs.Get("units")
+	v.Check(units == "" || validator.In(units, model.UnitsMetric, model.UnitsImperial), "units", "must be either metric or imperial")
+	return units
+}
+
+// caloriesOverride turns a calories_burned value from a request into a manual
+// override. Zero clears the override so the server estimates again.
+func caloriesOverride(value *int) *int {
+	if value == nil || *value == 0 {
+		return nil
+	}
+	return value
+}
+
+// userPermissions returns the permissions the request acts with: those carried
+// by its JWT or API key, or else the user's own.
+func (app *application) userPermissions(r *http.Request, user *model.User) (model.Permissions, error) {
+	if permissions, ok := app.contextGetPermissions(r); ok {
+		return permissions, nil
+	}
+	return app.models.Permissions.GetAllForUser(user.ID)
+}
+
+// clientIP returns the IP address the request came from.
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// sendEmail sends an email as a background task, retrying a few times before
+// logging the failure.
+func (app *application) sendEmail(recipient, templateFile string, data any) {
+	app.background("email", func() {
+		var err error
+		for attempt := 1; attempt <= 3; attempt++ {
+			if attempt > 1 {
+				time.Sleep(time.Duration(attempt-1) * 500 * time.Millisecond)
+			}
+			err = app.mailer.Send(recipient, templateFile, data)
+			if err == nil {
+				return
+			}
+		}
+
+		app.logger.PrintError(err, map[string]string{
+			"template": templateFile,
+		})
+	})
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/model"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/tracker"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/validator"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const maxHistoryImportBytes = 10 << 20
+
+// sportExercises are the catalog entries runs and rides are logged as.
+var sportExercises = map[string]string{
+	tracker.SportRunning: "Running",
+	tracker.SportCycling: "Cycling",
+}
+
+// createHistoryImportHandler imports sessions logged in another app. Each
+// session is imported once: sessions imported before are skipped, so the
+// same file can be imported again.
+func (app *application) createHistoryImportHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+
+	format := app.readString(qs, "format", "")
+	v.Check(validator.In(format, "strong", "hevy", "gpx", "tcx"), "format", "must be one of strong, hevy, gpx or tcx")
+	units := app.readUnits(qs, v)
+	// Only Strong exports don't say which units they use: Hevy exports do,
+	// and GPX and TCX distances are always in kilometres.
+	v.Check(units != model.UnitsImperial || format == "strong", "units", "only applies to Strong exports")
+	sport := app.readString(qs, "sport", "")
+	v.Check(sport == "" || sportExercises[sport] != "", "sport", "must be either running or cycling")
+	loc, err := time.LoadLocation(app.readString(qs, "timezone", "UTC"))
+	v.Check(err == nil, "timezone", "must be a valid IANA time zone")
+	dryRun := app.readBool(qs, "dry_run", false, v)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxHistoryImportBytes)
+
+	var activities []*tracker.Activity
+	switch format {
+	case "strong":
+		activities, err = tracker.ReadStrong(r.Body, loc)
+	case "hevy":
+		activities, err = tracker.ReadHevy(r.Body, loc)
+	case "gpx":
+		activities, err = tracker.ReadGPX(r.Body)
+	case "tcx":
+		activities, err = tracker.ReadTCX(r.Body)
+	}
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		var rowError *tracker.RowError
+		switch {
+		case errors.As(err, &maxBytesError):
+			app.badRequestResponse(w, r, fmt.Errorf("body must not be larger than %d bytes", maxHistoryImportBytes))
+		case errors.As(err, &rowError):
+			rowErrors := make(importErrors)
+			rowErrors.add(rowError.Row, rowError.Column, rowError.Err)
+			app.errorResponse(w, r, http.StatusUnprocessableEntity, rowErrors)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+	rowErrors := make(importErrors)
+
+	if format != "strong" {
+		units = model.UnitsMetric
+	}
+
+	imports, err := app.prepareHistoryImport(user, activities, units, sport, rowErrors)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if len(rowErrors) > 0 {
+		app.errorResponse(w, r, http.StatusUnprocessableEntity, rowErrors)
+		return
+	}
+
+	status := http.StatusCreated
+	if dryRun {
+		status = http.StatusOK
+		err = app.markImported(user.ID, imports)
+	} else {
+		err = app.models.Sessions.Import(imports)
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	sessions := []*model.WorkoutSession{}
+	skipped := 0
+	for _, imp := range imports {
+		if imp.Skipped {
+			skipped++
+			continue
+		}
+		imp.Session.Sets = imp.Sets
+		sessions = append(sessions, imp.Session)
+	}
+
+	err = app.writeJSON(w, status, envelope{"sessions": sessions, "skipped": skipped}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// markImported sets Skipped on the imports that were imported before.
+func (app *application) markImported(userID int64, imports []*model.SessionImport) error {
+	keys := make([]string, len(imports))
+	for i, imp := range imports {
+		keys[i] = imp.Session.ImportKey
+	}
+
+	imported, err := app.models.Sessions.ImportedKeys(userID, keys)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	for _, imp := range imports {
+		imp.Skipped = imported[imp.Session.ImportKey] || seen[imp.Session.ImportKey]
+		seen[imp.Session.ImportKey] = true
+	}
+	return nil
+}
+
+// prepareHistoryImport turns activities into sessions of the user's workouts,
+// in the order they were performed. Weights are stored in kilograms and
+// distances in kilometres; units is the unit system of activities that
+// aren't Imperial. Problems are added to rowErrors.
+func (app *application) prepareHistoryImport(user *model.User, activities []*tracker.Activity, units, sport string, rowErrors importErrors) ([]*model.SessionImport, error) {
+	var imports []*model.SessionImport
+	catalog := make(map[string]*model.CatalogExercise)
+
+	for _, activity := range activities {
+		system := units
+		if activity.Imperial {
+			system = model.UnitsImperial
+		}
+
+		session := &model.WorkoutSession{
+			UserID:     user.ID,
+			StartedAt:  activity.StartedAt,
+			FinishedAt: &activity.FinishedAt,
+			Notes:      activity.Notes,
+			Distance:   round2(model.ToKilometers(activity.Distance, system)),
+		}
+		if activity.FinishedAt.IsZero() {
+			session.FinishedAt = &activity.StartedAt
+		}
+		if activity.Calories > 0 {
+			session.CaloriesBurned = &activity.Calories
+		}
+
+		imp := &model.SessionImport{
+			Session: session,
+			Workout: &model.Workout{
+				UserID:     user.ID,
+				Name:       activity.Name,
+				Visibility: model.VisibilityPrivate,
+				Exercises:  []string{},
+				CatalogIDs: []int64{},
+			},
+		}
+
+		var err error
+		if activity.Sets == nil {
+			err = app.prepareSportImport(imp, activity, sport, catalog, rowErrors)
+		} else {
+			err = app.prepareLiftingImport(imp, activity, system, catalog, rowErrors)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		v := validator.New()
+		model.ValidateSession(v, session)
+		model.ValidateWorkout(v, imp.Workout)
+		for key, message := range v.Errors {
+			switch key {
+			case "exercises":
+				// A workout without exercises only lacks those with errors.
+				continue
+			case "name":
+				key = "workout"
+			}
+			rowErrors.add(activity.Row, key, message)
+		}
+
+		imports = append(imports, imp)
+	}
+
+	slices.SortStableFunc(imports, func(a, b *model.SessionImport) int {
+		return a.Session.StartedAt.Compare(b.Session.StartedAt)
+	})
+	return imports, nil
+}
+
+// prepareSportImport logs a run or ride as a session of a workout named after
+// its sport, such as "Running", whose one exercise has the activity's
+// duration and distance. The track's name goes in the session notes.
+func (app *application) prepareSportImport(imp *model.SessionImport, activity *tracker.Activity, sport string, catalog map[string]*model.CatalogExercise, rowErrors importErrors) error {
+	if activity.Sport != "" {
+		sport = activity.Sport
+	}
+	if sport == "" {
+		rowErrors.add(activity.Row, "sport", "must be running or cycling, or set with the sport parameter")
+		return nil
+	}
+
+	entry, err := app.historyCatalogEntry(catalog, sportExercises[sport])
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		rowErrors.add(activity.Row, "sport", "must match an exercise in the catalog")
+		return nil
+	}
+
+	session := imp.Session
+	session.ImportKey = "activity/" + session.StartedAt.UTC().Format(time.RFC3339)
+	if activity.Name != "" {
+		session.Notes = strings.TrimSpace(activity.Name + "\n" + session.Notes)
+	}
+
+	imp.Workout.Name = entry.Name
+	imp.Workout.Exercises = append(imp.Workout.Exercises, entry.Name)
+	imp.Workout.CatalogIDs = append(imp.Workout.CatalogIDs, entry.ID)
+
+	exercise := &model.Exercise{
+		UserID:       imp.Workout.UserID,
+		CatalogID:    entry.ID,
+		Name:         entry.Name,
+		WeightUnit:   model.UnitKilograms,
+		Duration:     int(session.FinishedAt.Sub(session.StartedAt).Seconds()),
+		Distance:     session.Distance,
+		DistanceUnit: model.UnitKilometers,
+	}
+
+	v := validator.New()
+	model.ValidateExercise(v, exercise)
+	for key, message := range v.Errors {
+		rowErrors.add(activity.Row, key, message)
+	}
+
+	imp.Exercises = append(imp.Exercises, exercise)
+	return nil
+}
+
+// prepareLiftingImport logs the sets of a lifting activity. Sets without reps,
+// of cardio or timed exercises, only add their duration and distance to the
+// exercise of a newly created workout.
+func (app *application) prepareLiftingImport(imp *model.SessionImport, activity *tracker.Activity, system string, catalog map[string]*model.CatalogExercise, rowErrors importErrors) error {
+	session := imp.Session
+	session.ImportKey = "lifting/" + session.StartedAt.UTC().Format(time.RFC3339) + "/" + strings.ToLower(activity.Name)
+
+	exercises := make(map[int64]*model.Exercise)
+
+	for _, s := range activity.Sets {
+		entry, err := app.historyCatalogEntry(catalog, s.Exercise)
+		if err != nil {
+			return err
+		}
+		if entry == nil {
+			rowErrors.add(s.Row, "exercise", "must match an exercise in the catalog")
+			continue
+		}
+
+		weight := round2(model.ToKilograms(s.Weight, system))
+
+		exercise, ok := exercises[entry.ID]
+		if !ok {
+			exercise = &model.Exercise{
+				UserID:       imp.Workout.UserID,
+				CatalogID:    entry.ID,
+				Name:         entry.Name,
+				Reps:         s.Reps,
+				Weight:       weight,
+				WeightUnit:   model.UnitKilograms,
+				DistanceUnit: model.UnitKilometers,
+			}
+			exercises[entry.ID] = exercise
+			imp.Exercises = append(imp.Exercises, exercise)
+			imp.Workout.Exercises = append(imp.Workout.Exercises, entry.Name)
+			imp.Workout.CatalogIDs = append(imp.Workout.CatalogIDs, entry.ID)
+		}
+
+		if s.Reps == 0 {
+			exercise.Duration += s.Duration
+			exercise.Distance = round2(exercise.Distance + model.ToKilometers(s.Distance, system))
+			continue
+		}
+		exercise.Sets++
+
+		set := &model.SessionSet{
+			PerformedAt:  session.StartedAt,
+			ExerciseName: entry.Name,
+			Weight:       weight,
+			Reps:         s.Reps,
+			RPE:          s.RPE,
+		}
+
+		v := validator.New()
+		model.ValidateSessionSet(v, set)
+		for key, message := range v.Errors {
+			// The exercise is found or created on import.
+			if key != "exercise_id" {
+				rowErrors.add(s.Row, key, message)
+			}
+		}
+
+		imp.Sets = append(imp.Sets, set)
+	}
+
+	for _, exercise := range imp.Exercises {
+		v := validator.New()
+		model.ValidateExercise(v, exercise)
+		for key, message := range v.Errors {
+			rowErrors.add(activity.Row, key, message)
+		}
+	}
+	return nil
+}
+
+// historyCatalogEntry finds the catalog entry for an exercise name, remembering
+// entries already looked up. Names such as "Bench Press (Barbell)", as Strong
+// and Hevy write them, are also looked up without the equipment.
+func (app *application) historyCatalogEntry(cache map[string]*model.CatalogExercise, name string) (*model.CatalogExercise, error) {
+	key := strings.ToLower(name)
+	if entry, ok := cache[key]; ok {
+		return entry, nil
+	}
+
+	names := []string{name}
+	if i := strings.LastIndex(name, " ("); i > 0 && strings.HasSuffix(name, ")") {
+		names = append(names, name[:i])
+	}
+
+	var entry *model.CatalogExercise
+	for _, name := range names {
+		var err error
+		entry, err = app.resolveCatalogEntry(validator.New(), name, 0)
+		if err != nil {
+			return nil, err
+		}
+		if entry != nil {
+			break
+		}
+	}
+
+	cache[key] = entry
+	return entry, nil
+}
+
+func round2(value float64) float64 {
+	return math.Round(value*100) / 100
+}
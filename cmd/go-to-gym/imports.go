@@ -0,0 +1,379 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/model"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/validator"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const maxImportRows = 1000
+
+// importRow is one exercise of a bulk import. It is appended to the workout
+// with workout_id, or else to a new workout named workout; the first row of a
+// new workout sets its description, visibility and calories_burned.
+type importRow struct {
+	Workout        string  `json:"workout"`
+	WorkoutID      int64   `json:"workout_id"`
+	Description    string  `json:"description"`
+	Visibility     string  `json:"visibility"`
+	CaloriesBurned *int    `json:"calories_burned"`
+	Exercise       string  `json:"exercise"`
+	CatalogID      int64   `json:"catalog_id"`
+	Sets           int     `json:"sets"`
+	Reps           int     `json:"reps"`
+	Weight         float64 `json:"weight"`
+	WeightUnit     string  `json:"weight_unit"`
+	Duration       int     `json:"duration_seconds"`
+	Distance       float64 `json:"distance"`
+	DistanceUnit   string  `json:"distance_unit"`
+	Tempo          string  `json:"tempo"`
+}
+
+// importErrors holds the validation errors of each row, keyed by row number
+// counting from 1 without the CSV header.
+type importErrors map[string]map[string]string
+
+func (e importErrors) add(row int, key, message string) {
+	n := strconv.Itoa(row)
+	if e[n] == nil {
+		e[n] = make(map[string]string)
+	}
+	if _, exists := e[n][key]; !exists {
+		e[n][key] = message
+	}
+}
+
+// createImportHandler creates workouts and exercises from a CSV file or a
+// JSON array of rows. Nothing is saved unless every row is valid, and with
+// dry_run=true nothing is saved at all.
+func (app *application) createImportHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	dryRun := app.readBool(r.URL.Query(), "dry_run", false, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	rowErrors := make(importErrors)
+
+	rows, err := app.readImportRows(w, r, rowErrors)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	imports, err := app.prepareImport(app.contextGetUser(r), rows, rowErrors)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if len(rowErrors) > 0 {
+		app.errorResponse(w, r, http.StatusUnprocessableEntity, rowErrors)
+		return
+	}
+
+	// Only the new workouts are returned, with the exercises of every row.
+	workouts := []*model.Workout{}
+	exercises := []*model.Exercise{}
+	for _, imp := range imports {
+		if imp.Workout.ID == 0 {
+			workouts = append(workouts, imp.Workout)
+		}
+		exercises = append(exercises, imp.Exercises...)
+	}
+
+	status := http.StatusOK
+	if !dryRun {
+		err = app.models.Workouts.Import(imports)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		status = http.StatusCreated
+	}
+
+	err = app.writeJSON(w, status, envelope{"workouts": workouts, "exercises": exercises}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readImportRows reads the rows of a text/csv body, or else a JSON array.
+// Cells of the wrong type are reported in rowErrors.
+func (app *application) readImportRows(w http.ResponseWriter, r *http.Request, rowErrors importErrors) ([]importRow, error) {
+	var rows []importRow
+	var err error
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "text/csv" {
+		rows, err = readImportCSV(w, r, rowErrors)
+	} else {
+		err = app.readJSON(w, r, &rows)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case len(rows) == 0:
+		return nil, errors.New("body must contain at least one row")
+	case len(rows) > maxImportRows:
+		return nil, fmt.Errorf("body must not contain more than %d rows", maxImportRows)
+	}
+	return rows, nil
+}
+
+// readImportCSV reads a CSV file whose header names the importRow fields of
+// its columns, in any order.
+func readImportCSV(w http.ResponseWriter, r *http.Request, rowErrors importErrors) ([]importRow, error) {
+	maxBytes := 1_048_576
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+
+	cr := csv.NewReader(r.Body)
+	cr.TrimLeadingSpace = true
+
+	records, err := cr.ReadAll()
+	if err != nil {
+		var parseError *csv.ParseError
+		switch {
+		case errors.As(err, &parseError):
+			return nil, fmt.Errorf("body contains badly-formed CSV (line %d)", parseError.Line)
+		case err.Error() == "http: request body too large":
+			return nil, fmt.Errorf("body must not be larger than %d bytes", maxBytes)
+		default:
+			return nil, err
+		}
+	}
+	if len(records) == 0 {
+		return nil, errors.New("body must not be empty")
+	}
+
+	rt := reflect.TypeOf(importRow{})
+	fieldsByName := make(map[string]int)
+	for i := 0; i < rt.NumField(); i++ {
+		fieldsByName[rt.Field(i).Tag.Get("json")] = i
+	}
+
+	header := records[0]
+	fields := make([]int, len(header))
+	for i, name := range header {
+		field, ok := fieldsByName[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("body contains unknown column %q", name)
+		}
+		fields[i] = field
+	}
+
+	rows := make([]importRow, len(records)-1)
+	for i, record := range records[1:] {
+		row := reflect.ValueOf(&rows[i]).Elem()
+		for j, cell := range record {
+			cell = strings.TrimSpace(cell)
+			if cell == "" {
+				continue
+			}
+			err := setImportField(row.Field(fields[j]), cell)
+			if err != nil {
+				rowErrors.add(i+1, rt.Field(fields[j]).Tag.Get("json"), err.Error())
+			}
+		}
+	}
+	return rows, nil
+}
+
+func setImportField(field reflect.Value, cell string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(cell)
+	case reflect.Int, reflect.Int64:
+		i, err := strconv.ParseInt(cell, 10, 64)
+		if err != nil {
+			return errors.New("must be an integer value")
+		}
+		field.SetInt(i)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(cell, 64)
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		field.SetFloat(f)
+	case reflect.Pointer:
+		value := reflect.New(field.Type().Elem())
+		err := setImportField(value.Elem(), cell)
+		if err != nil {
+			return err
+		}
+		field.Set(value)
+	}
+	return nil
+}
+
+// prepareImport validates the rows and groups them by workout, resolving
+// exercises against the catalog. Problems are added to rowErrors.
+func (app *application) prepareImport(user *model.User, rows []importRow, rowErrors importErrors) ([]*model.WorkoutImport, error) {
+	var imports []*model.WorkoutImport
+	byName := make(map[string]*model.WorkoutImport)
+	byID := make(map[int64]*model.WorkoutImport)
+	firstRows := make(map[*model.WorkoutImport]int)
+	catalog := make(map[string]*model.CatalogExercise)
+
+	for i, row := range rows {
+		n := i + 1
+		v := validator.New()
+
+		var imp *model.WorkoutImport
+		switch {
+		case row.WorkoutID != 0:
+			imp = byID[row.WorkoutID]
+			if imp != nil {
+				break
+			}
+			workout, err := app.models.Workouts.Get(row.WorkoutID, user.ID)
+			if err != nil && !errors.Is(err, model.ErrRecordNotFound) {
+				return nil, err
+			}
+			if workout == nil || !workout.IsOwnedBy(user) {
+				v.AddError("workout_id", "must reference one of your workouts")
+				break
+			}
+			imp = &model.WorkoutImport{Workout: workout}
+			byID[row.WorkoutID] = imp
+			imports = append(imports, imp)
+		case row.Workout != "":
+			imp = byName[row.Workout]
+			if imp != nil {
+				break
+			}
+			if row.Visibility == "" {
+				row.Visibility = model.VisibilityPrivate
+			}
+			imp = &model.WorkoutImport{Workout: &model.Workout{
+				UserID:         user.ID,
+				Name:           row.Workout,
+				Description:    row.Description,
+				CaloriesBurned: caloriesOverride(row.CaloriesBurned),
+				Visibility:     row.Visibility,
+				Exercises:      []string{},
+				CatalogIDs:     []int64{},
+			}}
+			byName[row.Workout] = imp
+			firstRows[imp] = n
+			imports = append(imports, imp)
+		default:
+			v.AddError("workout", "must be provided unless workout_id is")
+		}
+
+		entry, err := app.importCatalogEntry(v, catalog, row)
+		if err != nil {
+			return nil, err
+		}
+
+		if row.WeightUnit == "" {
+			row.WeightUnit = model.UnitKilograms
+		}
+		if row.DistanceUnit == "" {
+			row.DistanceUnit = model.UnitKilometers
+		}
+
+		exercise := &model.Exercise{
+			UserID:       user.ID,
+			Name:         row.Exercise,
+			Sets:         row.Sets,
+			Reps:         row.Reps,
+			Weight:       row.Weight,
+			WeightUnit:   row.WeightUnit,
+			Duration:     row.Duration,
+			Distance:     row.Distance,
+			DistanceUnit: row.DistanceUnit,
+			Tempo:        row.Tempo,
+		}
+		if entry != nil {
+			exercise.CatalogID = entry.ID
+			exercise.Name = entry.Name
+		}
+
+		ev := validator.New()
+		model.ValidateExercise(ev, exercise)
+		for key, message := range ev.Errors {
+			if key == "name" {
+				key = "exercise"
+			}
+			v.AddError(key, message)
+		}
+
+		for key, message := range v.Errors {
+			rowErrors.add(n, key, message)
+		}
+
+		if imp != nil && entry != nil {
+			if imp.Workout.ID != 0 {
+				exercise.WorkoutID = int(imp.Workout.ID)
+			} else {
+				imp.Workout.Exercises = append(imp.Workout.Exercises, entry.Name)
+				imp.Workout.CatalogIDs = append(imp.Workout.CatalogIDs, entry.ID)
+			}
+			imp.Exercises = append(imp.Exercises, exercise)
+		}
+	}
+
+	// New workouts are validated once, with any problems reported on their
+	// first row.
+	for imp, n := range firstRows {
+		v := validator.New()
+		model.ValidateWorkout(v, imp.Workout)
+		for key, message := range v.Errors {
+			switch key {
+			case "name":
+				key = "workout"
+			case "exercises":
+				// The rows of its exercises already have errors.
+				continue
+			}
+			rowErrors.add(n, key, message)
+		}
+	}
+
+	return imports, nil
+}
+
+// importCatalogEntry resolves the catalog entry of a row like
+// createExerciseHandler does, remembering entries already looked up.
+func (app *application) importCatalogEntry(v *validator.Validator, cache map[string]*model.CatalogExercise, row importRow) (*model.CatalogExercise, error) {
+	var key string
+	switch {
+	case row.CatalogID != 0:
+		key = "#" + strconv.FormatInt(row.CatalogID, 10)
+	case row.Exercise != "":
+		key = strings.ToLower(row.Exercise)
+	default:
+		v.AddError("exercise", "must be provided unless catalog_id is")
+		return nil, nil
+	}
+
+	entry, ok := cache[key]
+	if !ok {
+		var err error
+		entry, err = app.resolveCatalogEntry(validator.New(), row.Exercise, row.CatalogID)
+		if err != nil {
+			return nil, err
+		}
+		cache[key] = entry
+	}
+
+	switch {
+	case entry != nil:
+	case row.CatalogID != 0:
+		v.AddError("catalog_id", "must reference an existing catalog exercise")
+	default:
+		v.AddError("exercise", "must match an exercise in the catalog")
+	}
+	return entry, nil
+}
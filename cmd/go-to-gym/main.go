@@ -3,12 +3,17 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"expvar"
 	"flag"
 	"github.com/holydanchik/GoToGym/pkg/go-to-gym/jsonlog"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/jwt"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/mailer"
 	"github.com/holydanchik/GoToGym/pkg/go-to-gym/model"
 	"github.com/holydanchik/GoToGym/pkg/go-to-gym/model/filler"
 	_ "github.com/lib/pq"
 	"os"
+	"sync"
 	"time"
 )
 
@@ -21,16 +26,47 @@ type config struct {
 		dsn string
 	}
 	limiter struct {
-		rps     float64
-		burst   int
-		enabled bool
+		rps        float64
+		burst      int
+		loginRPS   float64
+		loginBurst int
+		enabled    bool
+	}
+	lockout struct {
+		attempts int
+		base     time.Duration
+		max      time.Duration
+	}
+	smtp struct {
+		host     string
+		port     int
+		username string
+		password string
+		sender   string
+	}
+	outbox        string
+	workers       int
+	deletionGrace time.Duration
+	auth          struct {
+		mode       string
+		jwtSecret  string
+		jwtKeyFile string
+		jwtIssuer  string
+		accessTTL  time.Duration
+		refreshTTL time.Duration
+		cacheTTL   time.Duration
 	}
 }
 
 type application struct {
-	config config
-	logger *jsonlog.Logger
-	models model.Models
+	config  config
+	logger  *jsonlog.Logger
+	models  model.Models
+	mailer  mailer.Mailer
+	jwt     *jwt.Key
+	wg      sync.WaitGroup
+	workers chan struct{}
+	stop    chan struct{}
 }
 
 func main() {
@@ -43,8 +79,32 @@ func main() {
 
 	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
 	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
+	flag.Float64Var(&cfg.limiter.loginRPS, "limiter-login-rps", 0.2, "Rate limiter maximum login attempts per second")
+	flag.IntVar(&cfg.limiter.loginBurst, "limiter-login-burst", 5, "Rate limiter maximum burst of login attempts")
 	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
 
+	flag.IntVar(&cfg.lockout.attempts, "lockout-attempts", 5, "Failed logins allowed before an account is locked (0 disables lockouts)")
+	flag.DurationVar(&cfg.lockout.base, "lockout-duration", time.Minute, "First lockout, doubled by every further failed login")
+	flag.DurationVar(&cfg.lockout.max, "lockout-max-duration", time.Hour, "Longest lockout")
+
+	flag.StringVar(&cfg.auth.mode, "auth-mode", "database", "Authentication tokens (database|jwt)")
+	flag.StringVar(&cfg.auth.jwtSecret, "jwt-secret", "", "HMAC secret for signing JWTs, at least 32 bytes")
+	flag.StringVar(&cfg.auth.jwtKeyFile, "jwt-key-file", "", "PEM file with an Ed25519 private key for signing JWTs (instead of -jwt-secret)")
+	flag.StringVar(&cfg.auth.jwtIssuer, "jwt-issuer", "gotogym", "JWT issuer and audience")
+	flag.DurationVar(&cfg.auth.accessTTL, "jwt-access-ttl", 15*time.Minute, "Lifetime of JWT access tokens")
+	flag.DurationVar(&cfg.auth.refreshTTL, "jwt-refresh-ttl", 30*24*time.Hour, "Lifetime of refresh tokens")
+	flag.DurationVar(&cfg.auth.cacheTTL, "auth-cache-ttl", 30*time.Second, "How long token users and permissions are cached (0 disables the cache)")
+
+	flag.IntVar(&cfg.workers, "background-workers", 8, "Maximum number of background tasks running at once")
+	flag.DurationVar(&cfg.deletionGrace, "account-deletion-grace", 14*24*time.Hour, "How long deleted accounts can be restored")
+
+	flag.StringVar(&cfg.smtp.host, "smtp-host", "", "SMTP host (emails go to the outbox if empty)")
+	flag.IntVar(&cfg.smtp.port, "smtp-port", 587, "SMTP port")
+	flag.StringVar(&cfg.smtp.username, "smtp-username", "", "SMTP username")
+	flag.StringVar(&cfg.smtp.password, "smtp-password", "", "SMTP password")
+	flag.StringVar(&cfg.smtp.sender, "smtp-sender", "Go To Gym <no-reply@gotogym.local>", "SMTP sender")
+	flag.StringVar(&cfg.outbox, "outbox", "", "Directory to write emails to when no SMTP host is set (stdout if empty, in development only)")
+
 	flag.Parse()
 	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
 
@@ -57,9 +117,34 @@ func main() {
 	logger.PrintInfo("database connection pool established", nil)
 
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: model.NewModels(db),
+		config:  cfg,
+		logger:  logger,
+		models:  model.NewModels(db, model.NewAuthCache(cfg.auth.cacheTTL)),
+		workers: make(chan struct{}, max(cfg.workers, 1)),
+		stop:    make(chan struct{}),
+	}
+
+	if cfg.auth.mode == "jwt" {
+		app.jwt, err = openJWTKey(cfg)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+	}
+
+	switch {
+	case cfg.smtp.host != "":
+		app.mailer = mailer.NewSMTP(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender)
+	case cfg.outbox != "":
+		app.mailer, err = mailer.NewDirOutbox(cfg.outbox, cfg.smtp.sender)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+	case cfg.env == "development":
+		app.mailer = mailer.NewOutbox(os.Stdout, cfg.smtp.sender)
+	default:
+		// Emails carry activation and password reset tokens, which must not
+		// end up in the logs.
+		logger.PrintFatal(errors.New("-smtp-host or -outbox is required outside development"), nil)
 	}
 
 	isEmpty, err := isTableEmpty(db, "workouts")
@@ -76,12 +161,40 @@ func main() {
 		logger.PrintInfo("database filled with dummy data", nil)
 	}
 
+	app.every("expired token cleanup", time.Hour, app.deleteExpiredTokens)
+	app.every("auth cache cleanup", time.Minute, app.models.AuthCache.DeleteExpired)
+	app.every("login failure cleanup", time.Hour, app.deleteStaleLoginFailures)
+	app.every("account deletion", time.Hour, app.deleteScheduledUsers)
+	app.every("expired export cleanup", time.Hour, app.deleteExpiredExports)
+
+	expvar.Publish("auth_cache", expvar.Func(func() any {
+		return app.models.AuthCache.Stats()
+	}))
+
 	err = app.serve()
 	if err != nil {
 		logger.PrintFatal(err, nil)
 	}
 }
 
+func openJWTKey(cfg config) (*jwt.Key, error) {
+	if cfg.auth.jwtKeyFile != "" {
+		data, err := os.ReadFile(cfg.auth.jwtKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		key, err := jwt.ParseEd25519PrivateKey(data)
+		if err != nil {
+			return nil, err
+		}
+		return jwt.NewEd25519(key, cfg.auth.jwtIssuer, cfg.auth.jwtIssuer), nil
+	}
+	if len(cfg.auth.jwtSecret) < 32 {
+		return nil, errors.New("-jwt-secret must be at least 32 bytes long when -auth-mode=jwt")
+	}
+	return jwt.NewHMAC([]byte(cfg.auth.jwtSecret), cfg.auth.jwtIssuer, cfg.auth.jwtIssuer), nil
+}
+
 func isTableEmpty(db *sql.DB, tableName string) (bool, error) {
 	var count int
 	err := db.QueryRow("SELECT COUNT(*) FROM " + tableName).Scan(&count)
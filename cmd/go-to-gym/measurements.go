@@ -0,0 +1,305 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/model"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/validator"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"time"
+)
+
+func (app *application) createMeasurementHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		MeasuredAt *time.Time `json:"measured_at"`
+		Kind       string     `json:"kind"`
+		Value      float64    `json:"value"`
+		Unit       string     `json:"unit"`
+		Notes      string     `json:"notes"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.MeasuredAt == nil {
+		now := time.Now()
+		input.MeasuredAt = &now
+	}
+	if input.Unit == "" {
+		input.Unit = model.MeasurementUnit(input.Kind, model.UnitsMetric)
+	}
+
+	user := app.contextGetUser(r)
+
+	measurement := &model.Measurement{
+		UserID:     user.ID,
+		MeasuredAt: *input.MeasuredAt,
+		Kind:       input.Kind,
+		Value:      input.Value,
+		Unit:       input.Unit,
+		Notes:      input.Notes,
+	}
+
+	v := validator.New()
+	if model.ValidateMeasurement(v, measurement); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Measurements.Insert(measurement)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/users/me/measurements/%d", measurement.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"measurement": measurement}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showMeasurementHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	units := app.readUnits(r.URL.Query(), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	measurement, err := app.models.Measurements.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	measurement.ConvertUnits(units)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"measurement": measurement}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateMeasurementHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	measurement, err := app.models.Measurements.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		MeasuredAt *time.Time `json:"measured_at"`
+		Kind       *string    `json:"kind"`
+		Value      *float64   `json:"value"`
+		Unit       *string    `json:"unit"`
+		Notes      *string    `json:"notes"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.MeasuredAt != nil {
+		measurement.MeasuredAt = *input.MeasuredAt
+	}
+	if input.Kind != nil {
+		measurement.Kind = *input.Kind
+	}
+	if input.Value != nil {
+		measurement.Value = *input.Value
+	}
+	if input.Unit != nil {
+		measurement.Unit = *input.Unit
+	}
+	if input.Notes != nil {
+		measurement.Notes = *input.Notes
+	}
+
+	v := validator.New()
+	if model.ValidateMeasurement(v, measurement); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Measurements.Update(measurement)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"measurement": measurement}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteMeasurementHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Measurements.Delete(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "measurement successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listMeasurementsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Kind  string
+		From  *time.Time
+		To    *time.Time
+		Units string
+		model.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Kind = app.readString(qs, "kind", "")
+	input.From = app.readDate(qs, "from", v)
+	input.To = app.readDate(qs, "to", v)
+	input.Units = app.readUnits(qs, v)
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "-measured_at")
+	input.Filters.SortSafelist = []string{"id", "measured_at", "value", "-id", "-measured_at", "-value"}
+
+	v.Check(input.Kind == "" || validator.In(input.Kind, model.MeasurementKinds...), "kind", "invalid measurement kind")
+	if input.From != nil && input.To != nil {
+		v.Check(!input.To.Before(*input.From), "to", "must not be before from")
+	}
+
+	if model.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if input.To != nil {
+		to := input.To.AddDate(0, 0, 1)
+		input.To = &to
+	}
+
+	ownerID := app.contextGetOwnerID(r)
+
+	measurements, metadata, err := app.models.Measurements.GetAll(ownerID, input.Kind, input.From, input.To, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for _, measurement := range measurements {
+		measurement.ConvertUnits(input.Units)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"measurements": measurements, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showMeasurementTrendHandler returns daily values of one kind of measurement
+// with a moving average and the weekly rate of change. The range defaults to
+// the last 90 days and the window to 7 days.
+func (app *application) showMeasurementTrendHandler(w http.ResponseWriter, r *http.Request) {
+	kind := httprouter.ParamsFromContext(r.Context()).ByName("kind")
+	if !validator.In(kind, model.MeasurementKinds...) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	from := app.readDate(qs, "from", v)
+	to := app.readDate(qs, "to", v)
+	window := app.readInt(qs, "window", 7, v)
+	units := app.readUnits(qs, v)
+
+	if to == nil {
+		today := time.Now().UTC().Truncate(24 * time.Hour)
+		to = &today
+	}
+	if from == nil {
+		start := to.AddDate(0, 0, -89)
+		from = &start
+	}
+
+	v.Check(!to.Before(*from), "to", "must not be before from")
+	v.Check(window >= 1 && window <= 90, "window", "must be between 1 and 90")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	ownerID := app.contextGetOwnerID(r)
+
+	// Earlier days are loaded too so the first points get a full window.
+	measurements, err := app.models.Measurements.GetSeries(ownerID, kind, from.AddDate(0, 0, -window+1), to.AddDate(0, 0, 1))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	trend := model.Trend(measurements, kind, *from, window, units)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"trend": trend}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
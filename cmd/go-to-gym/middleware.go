@@ -3,11 +3,14 @@ package main
 import (
 	"errors"
 	"fmt"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/jwt"
 	"github.com/holydanchik/GoToGym/pkg/go-to-gym/model"
 	"github.com/holydanchik/GoToGym/pkg/go-to-gym/validator"
+	"github.com/julienschmidt/httprouter"
 	"golang.org/x/time/rate"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -25,7 +28,10 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 	})
 }
 
-func (app *application) rateLimit(next http.Handler) http.Handler {
+// ipLimiter returns a function reporting whether a request from an IP address
+// is within rps requests per second with bursts of burst. Addresses that
+// haven't been seen for three minutes are forgotten.
+func (app *application) ipLimiter(name string, rps float64, burst int) func(ip string) bool {
 	type client struct {
 		limiter  *rate.Limiter
 		lastSeen time.Time
@@ -35,18 +41,31 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 		clients = make(map[string]*client)
 	)
 
-	go func() {
-		for {
-			time.Sleep(time.Minute)
-			mu.Lock()
-			for ip, client := range clients {
-				if time.Since(client.lastSeen) > 3*time.Minute {
-					delete(clients, ip)
-				}
+	app.every(name+" cleanup", time.Minute, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for ip, client := range clients {
+			if time.Since(client.lastSeen) > 3*time.Minute {
+				delete(clients, ip)
 			}
-			mu.Unlock()
 		}
-	}()
+	})
+
+	return func(ip string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if _, found := clients[ip]; !found {
+			clients[ip] = &client{
+				limiter: rate.NewLimiter(rate.Limit(rps), burst),
+			}
+		}
+		clients[ip].lastSeen = time.Now()
+		return clients[ip].limiter.Allow()
+	}
+}
+
+func (app *application) rateLimit(next http.Handler) http.Handler {
+	allow := app.ipLimiter("rate limiter", app.config.limiter.rps, app.config.limiter.burst)
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if app.config.limiter.enabled {
@@ -55,24 +74,37 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 				app.serverErrorResponse(w, r, err)
 				return
 			}
-			mu.Lock()
-			if _, found := clients[ip]; !found {
-				clients[ip] = &client{
-					limiter: rate.NewLimiter(rate.Limit(app.config.limiter.rps), app.config.limiter.burst),
-				}
-			}
-			clients[ip].lastSeen = time.Now()
-			if !clients[ip].limiter.Allow() {
-				mu.Unlock()
+			if !allow(ip) {
 				app.rateLimitExceededResponse(w, r)
 				return
 			}
-			mu.Unlock()
 		}
 		next.ServeHTTP(w, r)
 	})
 }
 
+// loginRateLimit applies the stricter login limits on top of rateLimit, so a
+// single address can only try a few passwords a minute.
+func (app *application) loginRateLimit(next http.HandlerFunc) http.HandlerFunc {
+	allow := app.ipLimiter("login rate limiter", app.config.limiter.loginRPS, app.config.limiter.loginBurst)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.config.limiter.enabled {
+			ip, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			if !allow(ip) {
+				app.logger.PrintInfo("login rate limit exceeded", map[string]string{"ip": ip})
+				app.rateLimitExceededResponse(w, r)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
 func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Authorization")
@@ -92,6 +124,30 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 
 		token := headerParts[1]
 
+		if strings.HasPrefix(token, model.APIKeyPrefix) {
+			app.authenticateAPIKey(w, r, token, next)
+			return
+		}
+
+		if app.jwt != nil && jwt.LooksLikeJWT(token) {
+			claims, err := app.jwt.Parse(token)
+			if err != nil {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+			id, err := strconv.ParseInt(claims.Subject, 10, 64)
+			if err != nil || id < 1 {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+
+			r = app.contextSetUser(r, &model.User{ID: id, Activated: claims.Activated})
+			r = app.contextSetPermissions(r, claims.Permissions)
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		v := validator.New()
 
 		if model.ValidateTokenPlaintext(v, token); !v.Valid() {
@@ -111,12 +167,70 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		}
 
 		r = app.contextSetUser(r, user)
+		r = app.contextSetToken(r, token)
 
 		next.ServeHTTP(w, r)
 	})
 }
 
+// authenticateAPIKey authenticates a request made with an API key, which acts
+// with the permissions it shares with its owner and only from its allowed IPs.
+func (app *application) authenticateAPIKey(w http.ResponseWriter, r *http.Request, keyPlaintext string, next http.Handler) {
+	v := validator.New()
+	if model.ValidateAPIKeyPlaintext(v, keyPlaintext); !v.Valid() {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+
+	key, user, err := app.models.APIKeys.GetForKey(keyPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The keys of an account scheduled for deletion stop working until it is
+	// restored.
+	if user.DeleteAfter != nil {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+
+	ip := clientIP(r)
+	if !key.AllowsIP(ip) {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+
+	err = app.models.APIKeys.Touch(key.ID, ip)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+	}
+
+	r = app.contextSetUser(r, user)
+	r = app.contextSetToken(r, keyPlaintext)
+	r = app.contextSetPermissions(r, key.Permissions)
+
+	next.ServeHTTP(w, r)
+}
+
+// requireAuthenticatedUser rejects anonymous requests. Like
+// requireActivatedUser, it also rejects requests made with an API key: keys
+// only act through the permissions they were given, which requirePermission
+// and requireClientAccess check.
 func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return app.authenticatedUser(app.rejectAPIKeys(next))
+}
+
+func (app *application) requireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return app.activatedUser(app.rejectAPIKeys(next))
+}
+
+func (app *application) authenticatedUser(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := app.contextGetUser(r)
 		if user.IsAnonymous() {
@@ -127,7 +241,7 @@ func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.Han
 	})
 }
 
-func (app *application) requireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
+func (app *application) activatedUser(next http.HandlerFunc) http.HandlerFunc {
 	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := app.contextGetUser(r)
 
@@ -138,7 +252,17 @@ func (app *application) requireActivatedUser(next http.HandlerFunc) http.Handler
 		next.ServeHTTP(w, r)
 	})
 
-	return app.requireAuthenticatedUser(fn)
+	return app.authenticatedUser(fn)
+}
+
+func (app *application) rejectAPIKeys(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(app.contextGetToken(r), model.APIKeyPrefix) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
 }
 
 func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
@@ -146,7 +270,7 @@ func (app *application) requirePermission(code string, next http.HandlerFunc) ht
 
 		user := app.contextGetUser(r)
 
-		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		permissions, err := app.userPermissions(r, user)
 		if err != nil {
 			app.serverErrorResponse(w, r, err)
 			return
@@ -158,5 +282,53 @@ func (app *application) requirePermission(code string, next http.HandlerFunc) ht
 		}
 		next.ServeHTTP(w, r)
 	}
-	return app.requireActivatedUser(fn)
+	return app.activatedUser(fn)
+}
+
+// requireClientAccess lets a user read the data of the client in the :client
+// parameter: their own, or a client who accepted them as coach while they
+// hold the clients:coach permission. An API key only reads the data of the
+// clients, through clients:coach. Handlers find the client with
+// contextGetOwnerID.
+func (app *application) requireClientAccess(next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		clientID, err := strconv.ParseInt(httprouter.ParamsFromContext(r.Context()).ByName("client"), 10, 64)
+		if err != nil || clientID < 1 {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		user := app.contextGetUser(r)
+
+		if clientID == user.ID && strings.HasPrefix(app.contextGetToken(r), model.APIKeyPrefix) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		if clientID != user.ID {
+			permissions, err := app.userPermissions(r, user)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			if !permissions.Include("clients:coach") {
+				app.notPermittedResponse(w, r)
+				return
+			}
+
+			_, err = app.models.Coaching.GetActive(user.ID, clientID)
+			if err != nil {
+				switch {
+				case errors.Is(err, model.ErrRecordNotFound):
+					app.notPermittedResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+		}
+
+		next.ServeHTTP(w, app.contextSetOwnerID(r, clientID))
+	}
+	return app.activatedUser(fn)
 }
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"errors"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/mailer"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/model"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/validator"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// currentUser loads the user making the request from the database, since the
+// user in the context of a JWT request only has an ID.
+func (app *application) currentUser(w http.ResponseWriter, r *http.Request) (*model.User, bool) {
+	user, err := app.models.Users.GetByID(app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return user, true
+}
+
+// checkPassword adds a validation error for key unless password is the
+// user's password.
+func checkPassword(v *validator.Validator, user *model.User, key, password string) error {
+	if v.Check(password != "", key, "must be provided"); !v.Valid() {
+		return nil
+	}
+	match, err := user.Password.Matches(password)
+	if err != nil {
+		return err
+	}
+	v.Check(match, key, "is incorrect")
+	return nil
+}
+
+func (app *application) showCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateCurrentUserHandler changes the user's name. If the request includes
+// the version it last read, it fails with a conflict when the user has
+// changed since.
+func (app *application) updateCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name    *string `json:"name"`
+		Version *int    `json:"version"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Version != nil && *input.Version != user.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+
+	if input.Name != nil {
+		user.Name = *input.Name
+	}
+
+	v := validator.New()
+	if model.ValidateUser(v, user); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateCurrentUserPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		CurrentPassword string `json:"current_password"`
+		Password        string `json:"password"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	model.ValidatePasswordPlaintext(v, input.Password)
+	err = checkPassword(v, user, "current_password", input.CurrentPassword)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = user.Password.Set(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(model.ScopePasswordReset, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Like a password reset, a change signs out every other device.
+	err = app.models.Tokens.DeleteOtherSessions(user.ID, app.contextGetToken(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "your password was successfully changed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateCurrentUserEmailHandler emails a confirmation token to the new
+// address. The user keeps their old address until they confirm it.
+func (app *application) updateCurrentUserEmailHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	model.ValidateEmail(v, input.Email)
+	v.Check(input.Email != user.Email, "email", "must be different from your current email address")
+	err = checkPassword(v, user, "password", input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.models.Users.GetByEmail(input.Email)
+	switch {
+	case err == nil:
+		v.AddError("email", "a user with this email address already exists")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	case !errors.Is(err, model.ErrRecordNotFound):
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Users.SetPendingEmail(user.ID, input.Email)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Tokens sent to an earlier pending address stop working.
+	err = app.models.Tokens.DeleteAllForUser(model.ScopeEmailChange, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	token, err := app.models.Tokens.New(user.ID, 24*time.Hour, model.ScopeEmailChange)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.sendEmail(input.Email, mailer.TemplateEmailChange, map[string]any{
+		"name":             user.Name,
+		"emailChangeToken": token.Plaintext,
+	})
+
+	message := "please confirm your new email address with the token we sent to it"
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"message": message}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) confirmUserEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if model.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(model.ScopeEmailChange, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired email change token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Users.ConfirmEmail(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrDuplicateEmail):
+			v.AddError("email", "a user with this email address already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, model.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired email change token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Password reset tokens went to the old address.
+	for _, scope := range []string{model.ScopeEmailChange, model.ScopePasswordReset} {
+		err = app.models.Tokens.DeleteAllForUser(scope, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteCurrentUserHandler schedules the user's account for deletion after
+// the grace period and logs them out everywhere. Logging in again and
+// restoring the account cancels the deletion.
+func (app *application) deleteCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Password string `json:"password"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	err = checkPassword(v, user, "password", input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if user.DeleteAfter == nil {
+		deleteAfter := time.Now().Add(app.config.deletionGrace)
+
+		err = app.models.Users.SetDeleteAfter(user, &deleteAfter)
+		if err != nil {
+			switch {
+			case errors.Is(err, model.ErrEditConflict):
+				app.editConflictResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+	}
+
+	for _, scope := range model.LoginScopes {
+		err = app.models.Tokens.DeleteAllForUser(scope, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	app.logger.PrintInfo("account deletion scheduled", map[string]string{
+		"user_id":      strconv.FormatInt(user.ID, 10),
+		"delete_after": user.DeleteAfter.Format(time.RFC3339),
+	})
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) restoreCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if user.DeleteAfter != nil {
+		err := app.models.Users.SetDeleteAfter(user, nil)
+		if err != nil {
+			switch {
+			case errors.Is(err, model.ErrEditConflict):
+				app.editConflictResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteScheduledUsers() {
+	count, err := app.models.Users.DeleteScheduled()
+	if count > 0 {
+		app.logger.PrintInfo("deleted accounts", map[string]string{
+			"count": strconv.FormatInt(count, 10),
+		})
+	}
+	if err != nil {
+		app.logger.PrintError(err, nil)
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/model"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/validator"
+	"net/http"
+)
+
+func (app *application) createProgramHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name        string              `json:"name"`
+		Description string              `json:"description,omitempty"`
+		Weeks       int                 `json:"weeks"`
+		Days        []*model.ProgramDay `json:"days"`
+		Progression *model.Progression  `json:"progression"`
+		Visibility  string              `json:"visibility,omitempty"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Visibility == "" {
+		input.Visibility = model.VisibilityPrivate
+	}
+	if input.Progression == nil {
+		input.Progression = &model.Progression{Rule: model.ProgressionNone}
+	}
+
+	user := app.contextGetUser(r)
+
+	program := &model.Program{
+		UserID:      user.ID,
+		Name:        input.Name,
+		Description: input.Description,
+		Weeks:       input.Weeks,
+		Days:        input.Days,
+		Progression: *input.Progression,
+		Visibility:  input.Visibility,
+	}
+
+	v := validator.New()
+	if model.ValidateProgram(v, program); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if ok := app.checkProgramWorkouts(w, r, v, program); !ok {
+		return
+	}
+
+	err = app.models.Programs.Insert(program)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/programs/%d", program.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"program": program}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showProgramHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	program, err := app.models.Programs.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"program": program}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateProgramHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	program, err := app.models.Programs.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !program.IsOwnedBy(user) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Name        *string              `json:"name"`
+		Description *string              `json:"description"`
+		Weeks       *int                 `json:"weeks"`
+		Days        *[]*model.ProgramDay `json:"days"`
+		Progression *model.Progression   `json:"progression"`
+		Visibility  *string              `json:"visibility"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		program.Name = *input.Name
+	}
+	if input.Description != nil {
+		program.Description = *input.Description
+	}
+	if input.Weeks != nil {
+		program.Weeks = *input.Weeks
+	}
+	if input.Days != nil {
+		program.Days = *input.Days
+	}
+	if input.Progression != nil {
+		program.Progression = *input.Progression
+	}
+	if input.Visibility != nil {
+		program.Visibility = *input.Visibility
+	}
+
+	v := validator.New()
+	if model.ValidateProgram(v, program); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if ok := app.checkProgramWorkouts(w, r, v, program); !ok {
+		return
+	}
+
+	err = app.models.Programs.Update(program)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"program": program}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteProgramHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Programs.Delete(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "program successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listProgramsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name string
+		model.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Name = app.readString(qs, "name", "")
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortSafelist = []string{"id", "name", "weeks", "-id", "-name", "-weeks"}
+
+	if model.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	programs, metadata, err := app.models.Programs.GetAll(user.ID, input.Name, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"programs": programs, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showProgramDayHandler renders the prescription for one day of a program,
+// progressing each exercise from the authenticated user's own history.
+func (app *application) showProgramDayHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	week, err := app.readIntParam(r, "week")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	day, err := app.readIntParam(r, "day")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	program, err := app.models.Programs.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if week > program.Weeks || day > 7 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	programDay := program.Day(week, day)
+	if programDay == nil {
+		err = app.writeJSON(w, http.StatusOK, envelope{"week": week, "day": day, "rest_day": true}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	workout, err := app.models.Workouts.Get(programDay.WorkoutID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	exercises, err := app.models.Exercises.GetAllForWorkout(workout.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	prescriptions := make([]*model.Prescription, 0, len(exercises))
+
+	for _, exercise := range exercises {
+		last, err := app.models.Sessions.GetLastSets(user.ID, exercise.Name)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		oneRepMax, err := app.models.Records.GetBest(user.ID, exercise.Name, model.RecordEstimated1RM)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		prescriptions = append(prescriptions, program.Prescribe(week, exercise, last, oneRepMax))
+	}
+
+	groups, err := app.models.Workouts.GetExerciseGroups(workout.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"week":      week,
+		"day":       day,
+		"deload":    program.IsDeloadWeek(week),
+		"workout":   workout,
+		"exercises": prescriptions,
+		"groups":    groups,
+	}
+
+	err = app.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// checkProgramWorkouts makes sure every day of the program references a
+// workout the user can see, and one that others can see too when the
+// program is shared or public. It sends a validation error otherwise.
+func (app *application) checkProgramWorkouts(w http.ResponseWriter, r *http.Request, v *validator.Validator, program *model.Program) bool {
+	for _, d := range program.Days {
+		workout, err := app.models.Workouts.Get(d.WorkoutID, program.UserID)
+		if err != nil {
+			switch {
+			case errors.Is(err, model.ErrRecordNotFound):
+				v.AddError("days", fmt.Sprintf("workout %d does not exist", d.WorkoutID))
+			default:
+				app.serverErrorResponse(w, r, err)
+				return false
+			}
+			continue
+		}
+		if program.Visibility != model.VisibilityPrivate && workout.Visibility == model.VisibilityPrivate {
+			v.AddError("days", fmt.Sprintf("workout %d must be shared or public like the program", d.WorkoutID))
+		}
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return false
+	}
+	return true
+}
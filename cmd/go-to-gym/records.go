@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/model"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/validator"
+	"net/http"
+)
+
+func (app *application) listUserRecordsHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	app.writeRecords(w, r, app.readString(qs, "exercise", ""))
+}
+
+func (app *application) listExerciseRecordsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	exercise, err := app.models.Exercises.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeRecords(w, r, exercise.Name)
+}
+
+// writeRecords responds with the user's current records together with a page
+// of the record history, optionally narrowed down to a single exercise.
+func (app *application) writeRecords(w http.ResponseWriter, r *http.Request, exerciseName string) {
+	var input struct {
+		Type string
+		model.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Type = app.readString(qs, "type", "")
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "-achieved_at")
+	input.Filters.SortSafelist = []string{"id", "achieved_at", "value", "-id", "-achieved_at", "-value"}
+
+	v.Check(input.Type == "" || validator.In(input.Type, model.RecordHeaviestWeight, model.RecordEstimated1RM, model.RecordMostReps, model.RecordSessionVolume), "type", "invalid record type")
+
+	if model.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	current, err := app.models.Records.GetCurrent(user.ID, exerciseName)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	history, metadata, err := app.models.Records.GetAll(user.ID, exerciseName, input.Type, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"current": current, "history": history, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
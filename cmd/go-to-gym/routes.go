@@ -1,6 +1,7 @@
 package main
 
 import (
+	"expvar"
 	"github.com/julienschmidt/httprouter"
 	"net/http"
 )
@@ -19,16 +20,106 @@ func (app *application) routes() http.Handler {
 	router.HandlerFunc(http.MethodPatch, "/v1/workouts/:id", app.requirePermission("workouts:write", app.updateWorkoutHandler))
 	router.HandlerFunc(http.MethodDelete, "/v1/workouts/:id", app.requirePermission("workouts:write", app.deleteWorkoutHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/workouts/:id/exercises", app.requirePermission("workouts:read", app.listExercisesHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/workouts/:id/exercises/order", app.requirePermission("workouts:write", app.reorderWorkoutExercisesHandler))
 
 	router.HandlerFunc(http.MethodPost, "/v1/exercises", app.requirePermission("workouts:write", app.createExerciseHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/exercises/:id", app.requirePermission("workouts:read", app.showExerciseHandler))
 	router.HandlerFunc(http.MethodPatch, "/v1/exercises/:id", app.requirePermission("workouts:write", app.updateExerciseHandler))
 	router.HandlerFunc(http.MethodDelete, "/v1/exercises/:id", app.requirePermission("workouts:write", app.deleteExerciseHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/exercises/:id/records", app.requirePermission("workouts:read", app.listExerciseRecordsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/imports", app.requirePermission("workouts:write", app.createImportHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/imports/history", app.requirePermission("workouts:write", app.createHistoryImportHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/catalog/exercises", app.requirePermission("workouts:read", app.listCatalogExercisesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/catalog/exercises", app.requirePermission("catalog:write", app.createCatalogExerciseHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/catalog/exercises/:id", app.requirePermission("workouts:read", app.showCatalogExerciseHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/catalog/exercises/:id", app.requirePermission("catalog:write", app.updateCatalogExerciseHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/catalog/exercises/:id", app.requirePermission("catalog:write", app.deleteCatalogExerciseHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/programs", app.requirePermission("workouts:read", app.listProgramsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/programs", app.requirePermission("workouts:write", app.createProgramHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/programs/:id", app.requirePermission("workouts:read", app.showProgramHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/programs/:id", app.requirePermission("workouts:write", app.updateProgramHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/programs/:id", app.requirePermission("workouts:write", app.deleteProgramHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/programs/:id/weeks/:week/days/:day", app.requirePermission("workouts:read", app.showProgramDayHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/schedule", app.requireActivatedUser(app.showScheduleHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/schedule/entries", app.requireActivatedUser(app.listScheduleEntriesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/schedule/entries", app.requireActivatedUser(app.createScheduleEntryHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/schedule/entries/:id", app.requireActivatedUser(app.showScheduleEntryHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/schedule/entries/:id", app.requireActivatedUser(app.updateScheduleEntryHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/schedule/entries/:id", app.requireActivatedUser(app.deleteScheduleEntryHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/schedule/feed", app.requireActivatedUser(app.createCalendarFeedHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/schedule/feed", app.requireActivatedUser(app.deleteCalendarFeedHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/schedule/feed/:token", app.calendarFeedHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/sessions", app.requireActivatedUser(app.listSessionsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/sessions", app.requireActivatedUser(app.startSessionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/sessions/:id", app.requireActivatedUser(app.showSessionHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/sessions/:id", app.requireActivatedUser(app.updateSessionHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/sessions/:id", app.requireActivatedUser(app.deleteSessionHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/sessions/:id/sets", app.requireActivatedUser(app.logSessionSetHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/sessions/:id/finished", app.requireActivatedUser(app.finishSessionHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/coaching/clients", app.requirePermission("clients:coach", app.listClientsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/coaching/clients", app.requirePermission("clients:coach", app.inviteClientHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/coaching/clients/:client/sessions", app.requireClientAccess(app.listSessionsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/coaching/clients/:client/sessions/:id", app.requireClientAccess(app.showSessionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/coaching/clients/:client/measurements", app.requireClientAccess(app.listMeasurementsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/coaching/clients/:client/trends/:kind", app.requireClientAccess(app.showMeasurementTrendHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/coaching/clients/:client/assignments", app.requireClientAccess(app.listAssignmentsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/coaching/clients/:client/assignments", app.requireClientAccess(app.createAssignmentHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/coaching/coaches", app.requireActivatedUser(app.listCoachesHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/coaching/invitations/accepted", app.requireActivatedUser(app.acceptInvitationHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/coaching/links/:id", app.requireActivatedUser(app.deleteCoachingLinkHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/coaching/assignments", app.requireActivatedUser(app.listAssignmentsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/coaching/assignments/:id", app.requirePermission("clients:coach", app.deleteAssignmentHandler))
+
+	router.HandlerFunc(http.MethodGet, "/debug/vars", app.requirePermission("users:admin", expvar.Handler().ServeHTTP))
+
+	router.HandlerFunc(http.MethodGet, "/v1/admin/roles", app.requirePermission("users:admin", app.listRolesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/permissions", app.requirePermission("users:admin", app.listPermissionsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/audit", app.requirePermission("users:admin", app.listAuditLogHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users/:id/access", app.requirePermission("users:admin", app.showUserAccessHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/admin/users/:id/roles/:role", app.requirePermission("users:admin", app.grantRoleHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/roles/:role", app.requirePermission("users:admin", app.revokeRoleHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/admin/users/:id/permissions/:code", app.requirePermission("users:admin", app.grantPermissionHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/permissions/:code", app.requirePermission("users:admin", app.revokePermissionHandler))
 
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.updateUserPasswordHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/unlocked", app.unlockUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/email/confirmed", app.confirmUserEmailHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/users/me", app.requireAuthenticatedUser(app.showCurrentUserHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me", app.requireActivatedUser(app.updateCurrentUserHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me", app.requireActivatedUser(app.deleteCurrentUserHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/password", app.requireActivatedUser(app.updateCurrentUserPasswordHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/email", app.requireActivatedUser(app.updateCurrentUserEmailHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/restored", app.requireActivatedUser(app.restoreCurrentUserHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/export", app.requireActivatedUser(app.createExportHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/export/:id", app.requireActivatedUser(app.showExportHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/records", app.requireActivatedUser(app.listUserRecordsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/measurements", app.requireActivatedUser(app.listMeasurementsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/measurements", app.requireActivatedUser(app.createMeasurementHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/measurements/:id", app.requireActivatedUser(app.showMeasurementHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me/measurements/:id", app.requireActivatedUser(app.updateMeasurementHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/measurements/:id", app.requireActivatedUser(app.deleteMeasurementHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/trends/:kind", app.requireActivatedUser(app.showMeasurementTrendHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/api-keys", app.requireActivatedUser(app.listAPIKeysHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/api-keys", app.requireActivatedUser(app.createAPIKeyHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/api-keys/:id", app.requireActivatedUser(app.showAPIKeyHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me/api-keys/:id", app.requireActivatedUser(app.updateAPIKeyHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/api-keys/:id", app.requireActivatedUser(app.deleteAPIKeyHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/sessions", app.requireAuthenticatedUser(app.listLoginSessionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/sessions", app.requireAuthenticatedUser(app.deleteAllLoginSessionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/sessions/:id", app.requireAuthenticatedUser(app.deleteLoginSessionHandler))
 
-	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.loginRateLimit(app.createAuthenticationTokenHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/refresh", app.createRefreshedTokensHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/activation", app.createActivationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/password-reset", app.createPasswordResetTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/unlock", app.createUnlockTokenHandler)
 
 	return app.recoverPanic(app.rateLimit(app.authenticate(router)))
 }
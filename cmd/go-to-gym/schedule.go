@@ -0,0 +1,431 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/ical"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/model"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/validator"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// calendarFeedTTL is long because calendar apps poll a subscription URL for
+// as long as it is configured. Users rotate or revoke the feed instead.
+const calendarFeedTTL = 365 * 24 * time.Hour
+
+func (app *application) createScheduleEntryHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		WorkoutID       int64     `json:"workout_id"`
+		StartsAt        time.Time `json:"starts_at"`
+		DurationMinutes int       `json:"duration_minutes"`
+		Timezone        string    `json:"timezone"`
+		RRule           string    `json:"rrule"`
+		Notes           string    `json:"notes"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.DurationMinutes == 0 {
+		input.DurationMinutes = 60
+	}
+	if input.Timezone == "" {
+		input.Timezone = "UTC"
+	}
+
+	user := app.contextGetUser(r)
+
+	entry := &model.ScheduleEntry{
+		UserID:          user.ID,
+		WorkoutID:       input.WorkoutID,
+		StartsAt:        input.StartsAt,
+		DurationMinutes: input.DurationMinutes,
+		Timezone:        input.Timezone,
+		RRule:           input.RRule,
+		Notes:           input.Notes,
+	}
+
+	if ok := app.prepareScheduleEntry(w, r, entry); !ok {
+		return
+	}
+
+	err = app.models.Schedule.Insert(entry)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/schedule/entries/%d", entry.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"entry": entry}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showScheduleEntryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	entry, err := app.models.Schedule.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"entry": entry}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateScheduleEntryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	entry, err := app.models.Schedule.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		WorkoutID       *int64     `json:"workout_id"`
+		StartsAt        *time.Time `json:"starts_at"`
+		DurationMinutes *int       `json:"duration_minutes"`
+		Timezone        *string    `json:"timezone"`
+		RRule           *string    `json:"rrule"`
+		Notes           *string    `json:"notes"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.WorkoutID != nil {
+		entry.WorkoutID = *input.WorkoutID
+	}
+	if input.StartsAt != nil {
+		entry.StartsAt = *input.StartsAt
+	}
+	if input.DurationMinutes != nil {
+		entry.DurationMinutes = *input.DurationMinutes
+	}
+	if input.Timezone != nil {
+		entry.Timezone = *input.Timezone
+	}
+	if input.RRule != nil {
+		entry.RRule = *input.RRule
+	}
+	if input.Notes != nil {
+		entry.Notes = *input.Notes
+	}
+
+	if ok := app.prepareScheduleEntry(w, r, entry); !ok {
+		return
+	}
+
+	err = app.models.Schedule.Update(entry)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"entry": entry}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteScheduleEntryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Schedule.Delete(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "schedule entry successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listScheduleEntriesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		model.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "starts_at")
+	input.Filters.SortSafelist = []string{"id", "starts_at", "-id", "-starts_at"}
+
+	if model.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	entries, metadata, err := app.models.Schedule.GetAll(user.ID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"entries": entries, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showScheduleHandler expands the user's schedule entries into the concrete
+// occurrences between from and to (inclusive dates, 30 days by default).
+func (app *application) showScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	from := app.readDate(qs, "from", v)
+	to := app.readDate(qs, "to", v)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if from == nil {
+		today := time.Now().UTC().Truncate(24 * time.Hour)
+		from = &today
+	}
+	if to == nil {
+		end := from.AddDate(0, 0, 29)
+		to = &end
+	}
+
+	v.Check(!to.Before(*from), "to", "must not be before from")
+	v.Check(to.Sub(*from) <= 366*24*time.Hour, "to", "must not be more than a year after from")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The to date is inclusive for clients.
+	end := to.AddDate(0, 0, 1)
+
+	user := app.contextGetUser(r)
+
+	entries, err := app.models.Schedule.GetAllStartingBefore(user.ID, end)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	occurrences := []*model.Occurrence{}
+	for _, entry := range entries {
+		o, err := entry.Occurrences(*from, end)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		occurrences = append(occurrences, o...)
+	}
+
+	sort.SliceStable(occurrences, func(i, j int) bool {
+		return occurrences[i].StartsAt.Before(occurrences[j].StartsAt)
+	})
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"occurrences": occurrences}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createCalendarFeedHandler issues a new secret feed URL and revokes any
+// earlier one.
+func (app *application) createCalendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	err := app.models.Tokens.DeleteAllForUser(model.ScopeCalendarFeed, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	token, err := app.models.Tokens.New(user.ID, calendarFeedTTL, model.ScopeCalendarFeed)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	feed := envelope{
+		"token":  token.Plaintext,
+		"expiry": token.Expiry,
+		"url":    fmt.Sprintf("/v1/schedule/feed/%s.ics", token.Plaintext),
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"feed": feed}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteCalendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	err := app.models.Tokens.DeleteAllForUser(model.ScopeCalendarFeed, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "calendar feed successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// calendarFeedHandler serves the schedule as iCalendar. Calendar apps can't
+// send an Authorization header, so the feed token in the path is the only
+// credential.
+func (app *application) calendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+	token := strings.TrimSuffix(params.ByName("token"), ".ics")
+
+	v := validator.New()
+	if model.ValidateTokenPlaintext(v, token); !v.Valid() {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(model.ScopeCalendarFeed, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	entries, err := app.models.Schedule.GetAllStartingBefore(user.ID, time.Time{})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	calendar := &ical.Calendar{Name: "Go To Gym"}
+
+	for _, entry := range entries {
+		loc, err := time.LoadLocation(entry.Timezone)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		start := entry.StartsAt.In(loc)
+
+		event := &ical.Event{
+			UID:         fmt.Sprintf("schedule-%d@gotogym", entry.ID),
+			Stamp:       entry.CreatedAt,
+			Start:       start,
+			End:         start.Add(time.Duration(entry.DurationMinutes) * time.Minute),
+			Summary:     entry.WorkoutName,
+			Description: entry.Notes,
+		}
+		if entry.RRule != "" {
+			rec, err := model.ParseRRule(entry.RRule)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			event.RRule = rec.String()
+		}
+		calendar.Events = append(calendar.Events, event)
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, err = calendar.WriteTo(w)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+	}
+}
+
+// prepareScheduleEntry validates the entry, checks the user can see its
+// workout and normalises the rule. It sends the error response itself.
+func (app *application) prepareScheduleEntry(w http.ResponseWriter, r *http.Request, entry *model.ScheduleEntry) bool {
+	v := validator.New()
+	if model.ValidateScheduleEntry(v, entry); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return false
+	}
+
+	workout, err := app.models.Workouts.Get(entry.WorkoutID, entry.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			v.AddError("workout_id", "must reference an existing workout")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return false
+	}
+	entry.WorkoutName = workout.Name
+
+	if entry.RRule != "" {
+		rec, _ := model.ParseRRule(entry.RRule)
+		entry.RRule = rec.String()
+	}
+	return true
+}
@@ -29,7 +29,13 @@ func (app *application) serve() error {
 		})
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
-		shutdownError <- srv.Shutdown(ctx)
+		err := srv.Shutdown(ctx)
+		app.logger.PrintInfo("completing background tasks", map[string]string{
+			"addr": srv.Addr,
+		})
+		close(app.stop)
+		app.wg.Wait()
+		shutdownError <- err
 	}()
 	app.logger.PrintInfo("starting server", map[string]string{
 		"addr": srv.Addr,
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/model"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/validator"
+	"net/http"
+	"time"
+)
+
+func (app *application) startSessionHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		WorkoutID int64  `json:"workout_id"`
+		Notes     string `json:"notes,omitempty"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	session := &model.WorkoutSession{
+		UserID:    user.ID,
+		WorkoutID: input.WorkoutID,
+		Notes:     input.Notes,
+	}
+
+	v := validator.New()
+	v.Check(session.WorkoutID > 0, "workout_id", "must be provided")
+	if model.ValidateSession(v, session); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.models.Workouts.Get(session.WorkoutID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			v.AddError("workout_id", "must reference an existing workout")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Sessions.Insert(session)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	bodyweight, err := app.models.Measurements.LatestBodyweight(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	session.SetCalories(bodyweight)
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/sessions/%d", session.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"session": session}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	ownerID := app.contextGetOwnerID(r)
+
+	session, err := app.models.Sessions.Get(id, ownerID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	session.Sets, err = app.models.Sessions.GetAllSets(session.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	bodyweight, err := app.models.Measurements.LatestBodyweight(ownerID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	session.SetCalories(bodyweight)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"session": session}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	session, err := app.models.Sessions.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		StartedAt      *time.Time `json:"started_at"`
+		Notes          *string    `json:"notes"`
+		CaloriesBurned *int       `json:"calories_burned"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.StartedAt != nil {
+		session.StartedAt = *input.StartedAt
+	}
+	if input.Notes != nil {
+		session.Notes = *input.Notes
+	}
+	if input.CaloriesBurned != nil {
+		session.CaloriesBurned = caloriesOverride(input.CaloriesBurned)
+	}
+
+	v := validator.New()
+	if model.ValidateSession(v, session); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Sessions.Update(session)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	bodyweight, err := app.models.Measurements.LatestBodyweight(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	session.SetCalories(bodyweight)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"session": session}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) finishSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	session, err := app.models.Sessions.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	v := validator.New()
+	if v.Check(!session.IsFinished(), "session", "has already been finished"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	finishedAt := time.Now()
+	session.FinishedAt = &finishedAt
+
+	err = app.models.Sessions.Update(session)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	bodyweight, err := app.models.Measurements.LatestBodyweight(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	session.SetCalories(bodyweight)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"session": session}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Sessions.Delete(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "session successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		WorkoutID int
+		From      *time.Time
+		To        *time.Time
+		model.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.WorkoutID = app.readInt(qs, "workout_id", 0, v)
+	input.From = app.readDate(qs, "from", v)
+	input.To = app.readDate(qs, "to", v)
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "-started_at")
+	input.Filters.SortSafelist = []string{"id", "started_at", "-id", "-started_at"}
+
+	if input.From != nil && input.To != nil {
+		v.Check(!input.To.Before(*input.From), "to", "must not be before from")
+	}
+
+	if model.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The to date is inclusive for clients, so the model gets the start of the
+	// following day as its exclusive upper bound.
+	if input.To != nil {
+		to := input.To.AddDate(0, 0, 1)
+		input.To = &to
+	}
+
+	ownerID := app.contextGetOwnerID(r)
+
+	bodyweight, err := app.models.Measurements.LatestBodyweight(ownerID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	sessions, metadata, err := app.models.Sessions.GetAll(ownerID, int64(input.WorkoutID), input.From, input.To, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for _, session := range sessions {
+		session.SetCalories(bodyweight)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"sessions": sessions, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) logSessionSetHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	session, err := app.models.Sessions.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		ExerciseID  int64   `json:"exercise_id"`
+		Weight      float64 `json:"weight"`
+		Reps        int     `json:"reps"`
+		RPE         float64 `json:"rpe"`
+		RestSeconds int     `json:"rest_seconds"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	set := &model.SessionSet{
+		SessionID:   session.ID,
+		ExerciseID:  input.ExerciseID,
+		Weight:      input.Weight,
+		Reps:        input.Reps,
+		RPE:         input.RPE,
+		RestSeconds: input.RestSeconds,
+	}
+
+	v := validator.New()
+	v.Check(!session.IsFinished(), "session", "has already been finished")
+	if model.ValidateSessionSet(v, set); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	exercise, err := app.models.Exercises.Get(set.ExerciseID, user.ID)
+	if err != nil && !errors.Is(err, model.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if exercise == nil || int64(exercise.WorkoutID) != session.WorkoutID {
+		v.AddError("exercise_id", "must reference an exercise of the session's workout")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	set.ExerciseName = exercise.Name
+
+	records, err := app.models.Sessions.LogSet(user.ID, set)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"set": set, "new_records": records}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -2,9 +2,12 @@ package main
 
 import (
 	"errors"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/jwt"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/mailer"
 	"github.com/holydanchik/GoToGym/pkg/go-to-gym/model"
 	"github.com/holydanchik/GoToGym/pkg/go-to-gym/validator"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -28,11 +31,28 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
+	failure, err := app.models.LoginFailures.Get(input.Email)
+	if err != nil && !errors.Is(err, model.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// A locked address is refused before its password is checked.
+	if failure != nil && failure.Locked(time.Now()) {
+		app.logger.PrintInfo("login refused for locked account", map[string]string{
+			"email":        input.Email,
+			"ip":           clientIP(r),
+			"locked_until": failure.LockedUntil.Format(time.RFC3339),
+		})
+		app.accountLockedResponse(w, r, *failure.LockedUntil)
+		return
+	}
+
 	user, err := app.models.Users.GetByEmail(input.Email)
 	if err != nil {
 		switch {
 		case errors.Is(err, model.ErrRecordNotFound):
-			app.invalidCredentialsResponse(w, r)
+			app.failedLoginResponse(w, r, input.Email, nil)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
@@ -46,11 +66,24 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 	}
 
 	if !match {
-		app.invalidCredentialsResponse(w, r)
+		app.failedLoginResponse(w, r, input.Email, user)
+		return
+	}
+
+	if failure != nil {
+		err = app.models.LoginFailures.Delete(input.Email)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	if app.jwt != nil {
+		app.writeSignedTokens(w, r, user)
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 24*time.Hour, model.ScopeAuthentication)
+	token, err := app.models.Tokens.NewForClient(user.ID, 24*time.Hour, model.ScopeAuthentication, r.UserAgent(), clientIP(r))
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -61,3 +94,363 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// createRefreshedTokensHandler trades a refresh token for a new access token
+// and a new refresh token. Each refresh token can only be used once.
+func (app *application) createRefreshedTokensHandler(w http.ResponseWriter, r *http.Request) {
+	if app.jwt == nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		TokenPlaintext string `json:"refresh_token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if model.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	userID, err := app.models.Tokens.Redeem(model.ScopeRefresh, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.models.Users.GetByID(userID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeSignedTokens(w, r, user)
+}
+
+// writeSignedTokens responds with a short-lived JWT access token carrying the
+// user's activation status and permissions, and a refresh token stored in the
+// database.
+func (app *application) writeSignedTokens(w http.ResponseWriter, r *http.Request, user *model.User) {
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	claims := jwt.Claims{
+		Subject:     strconv.FormatInt(user.ID, 10),
+		Activated:   user.Activated,
+		Permissions: permissions,
+	}
+
+	access := &model.Token{}
+	access.Plaintext, access.Expiry, err = app.jwt.Sign(claims, app.config.auth.accessTTL)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	refresh, err := app.models.Tokens.NewForClient(user.ID, app.config.auth.refreshTTL, model.ScopeRefresh, r.UserAgent(), clientIP(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": access, "refresh_token": refresh}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) lockoutPolicy() model.LockoutPolicy {
+	return model.LockoutPolicy{
+		Attempts: app.config.lockout.attempts,
+		Base:     app.config.lockout.base,
+		Max:      app.config.lockout.max,
+	}
+}
+
+// failedLoginResponse counts a failed login for email, which may not belong to
+// any user, and locks it once it has failed too often. The owner of a newly
+// locked account is emailed an unlock token.
+func (app *application) failedLoginResponse(w http.ResponseWriter, r *http.Request, email string, user *model.User) {
+	policy := app.lockoutPolicy()
+
+	failure, err := app.models.LoginFailures.Record(email, policy)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	properties := map[string]string{
+		"email":    email,
+		"ip":       clientIP(r),
+		"failures": strconv.Itoa(failure.Failures),
+	}
+	app.logger.PrintInfo("login failed", properties)
+
+	if failure.LockedUntil == nil {
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	properties["locked_until"] = failure.LockedUntil.Format(time.RFC3339)
+	app.logger.PrintInfo("account locked", properties)
+
+	if user != nil && failure.Failures == policy.Attempts {
+		err = app.sendUnlockToken(user)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	app.accountLockedResponse(w, r, *failure.LockedUntil)
+}
+
+func (app *application) sendUnlockToken(user *model.User) error {
+	token, err := app.models.Tokens.New(user.ID, 24*time.Hour, model.ScopeUnlock)
+	if err != nil {
+		return err
+	}
+
+	app.sendEmail(user.Email, mailer.TemplateUnlock, map[string]any{
+		"unlockToken": token.Plaintext,
+	})
+	return nil
+}
+
+// createUnlockTokenHandler emails a new unlock token to the owner of a locked
+// account. Like password resets it always responds 202.
+func (app *application) createUnlockTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if model.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	failure, err := app.models.LoginFailures.Get(input.Email)
+	if err != nil && !errors.Is(err, model.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if failure != nil && failure.Locked(time.Now()) {
+		user, err := app.models.Users.GetByEmail(input.Email)
+		if err != nil && !errors.Is(err, model.ErrRecordNotFound) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if user != nil {
+			err = app.sendUnlockToken(user)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+	}
+
+	message := "if that account is locked, you will receive unlock instructions"
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"message": message}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createPasswordResetTokenHandler always responds 202, so it can't be used to
+// find out which email addresses have an account.
+func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if model.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil && !errors.Is(err, model.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if user != nil && user.Activated {
+		token, err := app.models.Tokens.New(user.ID, 45*time.Minute, model.ScopePasswordReset)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.sendEmail(user.Email, mailer.TemplatePasswordReset, map[string]any{
+			"passwordResetToken": token.Plaintext,
+		})
+	}
+
+	message := "if an account with that email address exists, you will receive password reset instructions"
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"message": message}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createActivationTokenHandler emails a new activation token to a user who
+// hasn't activated their account yet. Like password resets it always responds
+// 202.
+func (app *application) createActivationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if model.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil && !errors.Is(err, model.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if user != nil && !user.Activated {
+		token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, model.ScopeActivation)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.sendEmail(user.Email, mailer.TemplateActivation, map[string]any{
+			"activationToken": token.Plaintext,
+		})
+	}
+
+	message := "if an account with that email address needs activating, you will receive activation instructions"
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"message": message}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listLoginSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	sessions, err := app.models.Tokens.GetAllSessionsForUser(user.ID, app.contextGetToken(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"sessions": sessions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteLoginSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Tokens.DeleteSession(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "session successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteAllLoginSessionsHandler logs the user out everywhere, including the
+// current session. Signed access tokens stay valid until they expire.
+func (app *application) deleteAllLoginSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	for _, scope := range model.LoginScopes {
+		err := app.models.Tokens.DeleteAllForUser(scope, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"message": "all sessions successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteExpiredTokens() {
+	count, err := app.models.Tokens.DeleteExpired()
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+	if count > 0 {
+		app.logger.PrintInfo("deleted expired tokens", map[string]string{
+			"count": strconv.FormatInt(count, 10),
+		})
+	}
+}
+
+func (app *application) deleteStaleLoginFailures() {
+	count, err := app.models.LoginFailures.DeleteStale(24 * time.Hour)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+	if count > 0 {
+		app.logger.PrintInfo("deleted stale login failures", map[string]string{
+			"count": strconv.FormatInt(count, 10),
+		})
+	}
+}
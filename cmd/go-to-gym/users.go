@@ -2,6 +2,7 @@ package main
 
 import (
 	"errors"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/mailer"
 	"github.com/holydanchik/GoToGym/pkg/go-to-gym/model"
 	"github.com/holydanchik/GoToGym/pkg/go-to-gym/validator"
 	"net/http"
@@ -51,7 +52,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.models.Permissions.AddForUser(user.ID, "workouts:read")
+	err = app.models.Roles.AddForUser(user.ID, model.RoleMember)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -63,15 +64,13 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	var res struct {
-		Token *string     `json:"token"`
-		User  *model.User `json:"user"`
-	}
-
-	res.Token = &token.Plaintext
-	res.User = user
+	app.sendEmail(user.Email, mailer.TemplateWelcome, map[string]any{
+		"activationToken": token.Plaintext,
+		"name":            user.Name,
+		"userID":          user.ID,
+	})
 
-	err = app.writeJSON(w, http.StatusAccepted, envelope{"user": res}, nil)
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"user": user}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -129,3 +128,128 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// updateUserPasswordHandler sets a new password using a password reset token,
+// signs the user out everywhere and unlocks their account.
+func (app *application) updateUserPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password       string `json:"password"`
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	model.ValidatePasswordPlaintext(v, input.Password)
+	model.ValidateTokenPlaintext(v, input.TokenPlaintext)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(model.ScopePasswordReset, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired password reset token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = user.Password.Set(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	for _, scope := range append([]string{model.ScopePasswordReset}, model.LoginScopes...) {
+		err = app.models.Tokens.DeleteAllForUser(scope, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.models.LoginFailures.Delete(user.Email)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "your password was successfully reset"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// unlockUserHandler lifts a lockout with the token emailed when the account
+// was locked.
+func (app *application) unlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if model.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(model.ScopeUnlock, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired unlock token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.LoginFailures.Delete(user.Email)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(model.ScopeUnlock, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.logger.PrintInfo("account unlocked", map[string]string{
+		"email": user.Email,
+		"ip":    clientIP(r),
+	})
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "your account was successfully unlocked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -1,47 +1,190 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/holydanchik/GoToGym/pkg/go-to-gym/model"
 	"github.com/holydanchik/GoToGym/pkg/go-to-gym/validator"
 	"net/http"
+	"strings"
 )
 
+// workoutExercisesInput is the exercises of a workout request: either catalog
+// names, or exercise objects with their prescriptions.
+type workoutExercisesInput struct {
+	Names   []string
+	Objects []workoutExerciseInput
+}
+
+// workoutExerciseInput describes an exercise of a workout in full. With an ID
+// it replaces that exercise of the workout.
+type workoutExerciseInput struct {
+	ID           int64   `json:"id"`
+	CatalogID    int64   `json:"catalog_id"`
+	Name         string  `json:"name"`
+	Sets         int     `json:"sets"`
+	Reps         int     `json:"reps"`
+	Weight       float64 `json:"weight"`
+	WeightUnit   string  `json:"weight_unit"`
+	Duration     int     `json:"duration_seconds"`
+	Distance     float64 `json:"distance"`
+	DistanceUnit string  `json:"distance_unit"`
+	Tempo        string  `json:"tempo"`
+}
+
+func (e *workoutExercisesInput) UnmarshalJSON(data []byte) error {
+	if json.Unmarshal(data, &e.Names) == nil {
+		return nil
+	}
+	e.Names = nil
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(&e.Objects)
+}
+
+// resolveWorkoutExercises builds the exercises described by a workout
+// request, resolving them against the catalog and, for those with an ID, the
+// workout's current exercises. The workout's Exercises and CatalogIDs follow
+// them. Problems are recorded on v.
+func (app *application) resolveWorkoutExercises(v *validator.Validator, workout *model.Workout, inputs []workoutExerciseInput, current []*model.Exercise) ([]*model.Exercise, error) {
+	workout.Exercises = []string{}
+	workout.CatalogIDs = []int64{}
+
+	exercises := []*model.Exercise{}
+	seen := make(map[int64]bool)
+
+	for i, input := range inputs {
+		ev := validator.New()
+
+		exercise := &model.Exercise{UserID: workout.UserID}
+		if input.ID != 0 {
+			var found *model.Exercise
+			for _, c := range current {
+				if c.ID == input.ID {
+					found = c
+				}
+			}
+			ev.Check(found != nil, "id", "must reference an exercise of the workout")
+			ev.Check(!seen[input.ID], "id", "must not be repeated")
+			seen[input.ID] = true
+			if found != nil {
+				exercise = found
+			}
+		}
+
+		if input.WeightUnit == "" {
+			input.WeightUnit = model.UnitKilograms
+		}
+		if input.DistanceUnit == "" {
+			input.DistanceUnit = model.UnitKilometers
+		}
+
+		exercise.Name = input.Name
+		exercise.Sets = input.Sets
+		exercise.Reps = input.Reps
+		exercise.Weight = input.Weight
+		exercise.WeightUnit = input.WeightUnit
+		exercise.Duration = input.Duration
+		exercise.Distance = input.Distance
+		exercise.DistanceUnit = input.DistanceUnit
+		exercise.Tempo = input.Tempo
+
+		entry, err := app.resolveCatalogEntry(ev, input.Name, input.CatalogID)
+		if err != nil {
+			return nil, err
+		}
+		if entry != nil {
+			exercise.CatalogID = entry.ID
+			exercise.Name = entry.Name
+			workout.Exercises = append(workout.Exercises, entry.Name)
+			workout.CatalogIDs = append(workout.CatalogIDs, entry.ID)
+		}
+
+		model.ValidateExercise(ev, exercise)
+		for key, message := range ev.Errors {
+			v.AddError(fmt.Sprintf("exercises[%d].%s", i, key), message)
+		}
+
+		exercises = append(exercises, exercise)
+	}
+
+	return exercises, nil
+}
+
+// createWorkoutHandler creates a workout. Its exercises are catalog names or
+// catalog_ids, or exercise objects with their prescriptions, which are all
+// created together with the workout.
 func (app *application) createWorkoutHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Name           string   `json:"name"`
-		Description    string   `json:"description,omitempty"`
-		Exercises      []string `json:"exercises"`
-		CaloriesBurned int      `json:"calories_burned,omitempty"`
+		Name           string                `json:"name"`
+		Description    string                `json:"description,omitempty"`
+		Exercises      workoutExercisesInput `json:"exercises"`
+		CatalogIDs     []int64               `json:"catalog_ids"`
+		CaloriesBurned *int                  `json:"calories_burned,omitempty"`
+		Visibility     string                `json:"visibility,omitempty"`
 	}
 	err := app.readJSON(w, r, &input)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
+	if input.Visibility == "" {
+		input.Visibility = model.VisibilityPrivate
+	}
+
+	user := app.contextGetUser(r)
+
 	workout := &model.Workout{
+		UserID:         user.ID,
 		Name:           input.Name,
 		Description:    input.Description,
-		Exercises:      input.Exercises,
-		CaloriesBurned: input.CaloriesBurned,
+		CaloriesBurned: caloriesOverride(input.CaloriesBurned),
+		Visibility:     input.Visibility,
 	}
 
 	v := validator.New()
+
+	var exercises []*model.Exercise
+	if input.Exercises.Objects != nil {
+		v.Check(len(input.CatalogIDs) == 0, "catalog_ids", "must not be combined with exercises")
+		exercises, err = app.resolveWorkoutExercises(v, workout, input.Exercises.Objects, nil)
+	} else {
+		workout.CatalogIDs, err = app.resolveCatalogIDs(v, input.Exercises.Names, input.CatalogIDs)
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	if model.ValidateWorkout(v, workout); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Workouts.Insert(workout)
+	err = app.models.Workouts.Insert(workout, exercises...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	bodyweight, err := app.models.Measurements.LatestBodyweight(user.ID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	workout.SetCalories(bodyweight)
+
+	data := envelope{"workout": workout}
+	if exercises != nil {
+		data["exercises"] = exercises
+	}
 
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/workouts/%d", workout.ID))
-	err = app.writeJSON(w, http.StatusCreated, envelope{"workout": workout}, headers)
+	err = app.writeJSON(w, http.StatusCreated, data, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -54,7 +197,9 @@ func (app *application) showWorkoutHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	workout, err := app.models.Workouts.Get(id)
+	user := app.contextGetUser(r)
+
+	workout, err := app.models.Workouts.Get(id, user.ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, model.ErrRecordNotFound):
@@ -65,6 +210,13 @@ func (app *application) showWorkoutHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	bodyweight, err := app.models.Measurements.LatestBodyweight(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	workout.SetCalories(bodyweight)
+
 	err = app.writeJSON(w, http.StatusOK, envelope{"workout": workout}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -78,7 +230,9 @@ func (app *application) updateWorkoutHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	workout, err := app.models.Workouts.Get(id)
+	user := app.contextGetUser(r)
+
+	workout, err := app.models.Workouts.Get(id, user.ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, model.ErrRecordNotFound):
@@ -89,11 +243,18 @@ func (app *application) updateWorkoutHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	if !workout.IsOwnedBy(user) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
 	var input struct {
-		Name           *string   `json:"name"`
-		Description    *string   `json:"description,omitempty"`
-		Exercises      *[]string `json:"exercises,omitempty"`
-		CaloriesBurned *int      `json:"calories_burned,omitempty"`
+		Name           *string                `json:"name"`
+		Description    *string                `json:"description,omitempty"`
+		Exercises      *workoutExercisesInput `json:"exercises,omitempty"`
+		CatalogIDs     *[]int64               `json:"catalog_ids,omitempty"`
+		CaloriesBurned *int                   `json:"calories_burned,omitempty"`
+		Visibility     *string                `json:"visibility,omitempty"`
 	}
 
 	err = app.readJSON(w, r, &input)
@@ -108,21 +269,53 @@ func (app *application) updateWorkoutHandler(w http.ResponseWriter, r *http.Requ
 	if input.Description != nil {
 		workout.Description = *input.Description
 	}
-	if input.Exercises != nil {
-		workout.Exercises = *input.Exercises
-	}
 	if input.CaloriesBurned != nil {
-		workout.CaloriesBurned = *input.CaloriesBurned
+		workout.CaloriesBurned = caloriesOverride(input.CaloriesBurned)
+	}
+	if input.Visibility != nil {
+		workout.Visibility = *input.Visibility
 	}
 
 	v := validator.New()
 
+	var exercises []*model.Exercise
+	switch {
+	case input.Exercises != nil && input.Exercises.Objects != nil:
+		v.Check(input.CatalogIDs == nil, "catalog_ids", "must not be combined with exercises")
+
+		current, err := app.models.Exercises.GetAllForWorkout(workout.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		exercises, err = app.resolveWorkoutExercises(v, workout, input.Exercises.Objects, current)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	case input.Exercises != nil || input.CatalogIDs != nil:
+		var names []string
+		var catalogIDs []int64
+		if input.Exercises != nil {
+			names = input.Exercises.Names
+		}
+		if input.CatalogIDs != nil {
+			catalogIDs = *input.CatalogIDs
+		}
+		workout.CatalogIDs, err = app.resolveCatalogIDs(v, names, catalogIDs)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
 	if model.ValidateWorkout(v, workout); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Workouts.Update(workout)
+	err = app.models.Workouts.Update(workout, exercises...)
 	if err != nil {
 		switch {
 		case errors.Is(err, model.ErrEditConflict):
@@ -133,7 +326,19 @@ func (app *application) updateWorkoutHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"workout": workout}, nil)
+	bodyweight, err := app.models.Measurements.LatestBodyweight(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	workout.SetCalories(bodyweight)
+
+	data := envelope{"workout": workout}
+	if exercises != nil {
+		data["exercises"] = exercises
+	}
+
+	err = app.writeJSON(w, http.StatusOK, data, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -145,7 +350,26 @@ func (app *application) deleteWorkoutHandler(w http.ResponseWriter, r *http.Requ
 		app.notFoundResponse(w, r)
 		return
 	}
-	err = app.models.Workouts.Delete(id)
+
+	user := app.contextGetUser(r)
+
+	workout, err := app.models.Workouts.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !workout.IsOwnedBy(user) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	err = app.models.Workouts.Delete(workout.ID, user.ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, model.ErrRecordNotFound):
@@ -175,6 +399,9 @@ func (app *application) listWorkoutsHandler(w http.ResponseWriter, r *http.Reque
 
 	input.Name = app.readString(qs, "name", "")
 	input.Exercises = app.readCSV(qs, "exercises", []string{})
+	for i := range input.Exercises {
+		input.Exercises[i] = strings.ToLower(input.Exercises[i])
+	}
 	input.CaloriesFrom = app.readInt(qs, "caloriesFrom", 0, v)
 	input.CaloriesTo = app.readInt(qs, "caloriesTo", 0, v)
 
@@ -189,14 +416,127 @@ func (app *application) listWorkoutsHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	workouts, metadata, err := app.models.Workouts.GetAll(input.Name, input.Exercises, input.CaloriesFrom, input.CaloriesTo, input.Filters)
+	user := app.contextGetUser(r)
+
+	bodyweight, err := app.models.Measurements.LatestBodyweight(user.ID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
+	workouts, metadata, err := app.models.Workouts.GetAll(user.ID, bodyweight, input.Name, input.Exercises, input.CaloriesFrom, input.CaloriesTo, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for _, workout := range workouts {
+		workout.SetCalories(bodyweight)
+	}
+
 	err = app.writeJSON(w, http.StatusOK, envelope{"workouts": workouts, "metadata": metadata}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+func (app *application) reorderWorkoutExercisesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	workout, err := app.models.Workouts.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !workout.IsOwnedBy(user) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Version     int     `json:"version"`
+		ExerciseIDs []int64 `json:"exercise_ids"`
+		Groups      []struct {
+			Kind        string  `json:"kind"`
+			RestSeconds int     `json:"rest_seconds"`
+			Rounds      int     `json:"rounds"`
+			ExerciseIDs []int64 `json:"exercise_ids"`
+		} `json:"groups"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if v.Check(input.Version > 0, "version", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if input.Version != workout.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+
+	groups := make([]*model.ExerciseGroup, 0, len(input.Groups))
+	for _, group := range input.Groups {
+		if group.Rounds == 0 {
+			group.Rounds = 1
+		}
+		groups = append(groups, &model.ExerciseGroup{
+			Kind:        group.Kind,
+			RestSeconds: group.RestSeconds,
+			Rounds:      group.Rounds,
+			ExerciseIDs: group.ExerciseIDs,
+		})
+	}
+
+	current, err := app.models.Workouts.GetExerciseIDs(workout.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if model.ValidateExerciseOrder(v, current, input.ExerciseIDs, groups); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Workouts.Reorder(workout, input.ExerciseIDs, groups)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	bodyweight, err := app.models.Measurements.LatestBodyweight(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	workout.SetCalories(bodyweight)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"workout": workout, "groups": groups}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,99 @@
+// Package cache provides an in-process cache whose entries expire after a
+// fixed time to live.
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type entry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+// Cache is safe for concurrent use. It counts hits and misses for monitoring.
+type Cache[K comparable, V any] struct {
+	mu      sync.RWMutex
+	ttl     time.Duration
+	entries map[K]entry[V]
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+func New[K comparable, V any](ttl time.Duration) *Cache[K, V] {
+	return &Cache[K, V]{
+		ttl:     ttl,
+		entries: make(map[K]entry[V]),
+	}
+}
+
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.RLock()
+	e, ok := c.entries[key]
+	c.mu.RUnlock()
+
+	if !ok || time.Now().After(e.expires) {
+		c.misses.Add(1)
+		var zero V
+		return zero, false
+	}
+	c.hits.Add(1)
+	return e.value, true
+}
+
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = entry[V]{value: value, expires: time.Now().Add(c.ttl)}
+}
+
+func (c *Cache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// DeleteFunc deletes every entry for which del returns true.
+func (c *Cache[K, V]) DeleteFunc(del func(key K, value V) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, e := range c.entries {
+		if del(key, e.value) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// DeleteExpired frees the memory of expired entries, which Get already
+// ignores.
+func (c *Cache[K, V]) DeleteExpired() {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+type Stats struct {
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+	Entries int    `json:"entries"`
+}
+
+func (c *Cache[K, V]) Stats() Stats {
+	c.mu.RLock()
+	entries := len(c.entries)
+	c.mu.RUnlock()
+
+	return Stats{
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+		Entries: entries,
+	}
+}
@@ -0,0 +1,136 @@
+package cache
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	tests := []struct {
+		name      string
+		ttl       time.Duration
+		run       func(c *Cache[string, int])
+		key       string
+		wantValue int
+		wantOK    bool
+	}{
+		{
+			name:   "missing",
+			ttl:    time.Minute,
+			run:    func(c *Cache[string, int]) {},
+			key:    "a",
+			wantOK: false,
+		},
+		{
+			name:      "set",
+			ttl:       time.Minute,
+			run:       func(c *Cache[string, int]) { c.Set("a", 1) },
+			key:       "a",
+			wantValue: 1,
+			wantOK:    true,
+		},
+		{
+			name:      "overwritten",
+			ttl:       time.Minute,
+			run:       func(c *Cache[string, int]) { c.Set("a", 1); c.Set("a", 2) },
+			key:       "a",
+			wantValue: 2,
+			wantOK:    true,
+		},
+		{
+			name:   "deleted",
+			ttl:    time.Minute,
+			run:    func(c *Cache[string, int]) { c.Set("a", 1); c.Delete("a") },
+			key:    "a",
+			wantOK: false,
+		},
+		{
+			name:   "expired",
+			ttl:    -time.Second,
+			run:    func(c *Cache[string, int]) { c.Set("a", 1) },
+			key:    "a",
+			wantOK: false,
+		},
+		{
+			name: "deleted by DeleteFunc",
+			ttl:  time.Minute,
+			run: func(c *Cache[string, int]) {
+				c.Set("user:1", 1)
+				c.DeleteFunc(func(key string, value int) bool { return strings.HasPrefix(key, "user:") })
+			},
+			key:    "user:1",
+			wantOK: false,
+		},
+		{
+			name: "kept by DeleteFunc",
+			ttl:  time.Minute,
+			run: func(c *Cache[string, int]) {
+				c.Set("user:1", 1)
+				c.Set("user:2", 2)
+				c.DeleteFunc(func(key string, value int) bool { return value == 1 })
+			},
+			key:       "user:2",
+			wantValue: 2,
+			wantOK:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New[string, int](tt.ttl)
+			tt.run(c)
+
+			value, ok := c.Get(tt.key)
+			if value != tt.wantValue || ok != tt.wantOK {
+				t.Errorf("Get(%q) = %d, %v; want %d, %v", tt.key, value, ok, tt.wantValue, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestCacheDeleteExpired(t *testing.T) {
+	tests := []struct {
+		name        string
+		ttl         time.Duration
+		wantEntries int
+	}{
+		{"live entries are kept", time.Minute, 2},
+		{"expired entries are freed", -time.Second, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New[string, int](tt.ttl)
+			c.Set("a", 1)
+			c.Set("b", 2)
+			c.DeleteExpired()
+
+			if got := c.Stats().Entries; got != tt.wantEntries {
+				t.Errorf("%d entries left; want %d", got, tt.wantEntries)
+			}
+		})
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	c := New[int, int](time.Minute)
+	c.Set(1, 1)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Get(1)
+			c.Get(2)
+		}()
+	}
+	wg.Wait()
+
+	want := Stats{Hits: 10, Misses: 10, Entries: 1}
+	if got := c.Stats(); got != want {
+		t.Errorf("Stats() = %+v; want %+v", got, want)
+	}
+}
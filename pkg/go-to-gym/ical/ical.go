@@ -0,0 +1,236 @@
+// Package ical writes minimal iCalendar (RFC 5545) feeds.
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type Calendar struct {
+	Name   string
+	Events []*Event
+}
+
+type Event struct {
+	UID         string
+	Stamp       time.Time
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Description string
+	// RRule is written verbatim, without the "RRULE:" prefix.
+	RRule string
+}
+
+const (
+	utcFormat   = "20060102T150405Z"
+	localFormat = "20060102T150405"
+)
+
+// WriteTo writes the calendar to w. Events that start outside UTC are written
+// with a TZID so recurrences keep their wall-clock time across DST changes,
+// and each such time zone is described by a VTIMEZONE.
+func (c *Calendar) WriteTo(w io.Writer) (int64, error) {
+	cw := &writer{w: bufio.NewWriter(w)}
+
+	cw.line("BEGIN:VCALENDAR")
+	cw.line("VERSION:2.0")
+	cw.line("PRODID:-//Go To Gym//Schedule//EN")
+	cw.line("CALSCALE:GREGORIAN")
+	if c.Name != "" {
+		cw.line("X-WR-CALNAME:" + escape(c.Name))
+	}
+
+	for _, zone := range c.timezones() {
+		cw.timezone(zone.loc, zone.since.Year()-1)
+	}
+
+	for _, e := range c.Events {
+		cw.line("BEGIN:VEVENT")
+		cw.line("UID:" + e.UID)
+		cw.line("DTSTAMP:" + e.Stamp.UTC().Format(utcFormat))
+		cw.line(dateTime("DTSTART", e.Start))
+		cw.line(dateTime("DTEND", e.End))
+		cw.line("SUMMARY:" + escape(e.Summary))
+		if e.Description != "" {
+			cw.line("DESCRIPTION:" + escape(e.Description))
+		}
+		if e.RRule != "" {
+			cw.line("RRULE:" + e.RRule)
+		}
+		cw.line("END:VEVENT")
+	}
+
+	cw.line("END:VCALENDAR")
+
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, cw.w.Flush()
+}
+
+type zone struct {
+	loc   *time.Location
+	since time.Time
+}
+
+// timezones returns the time zones the events start in other than UTC, in
+// order of appearance, with the earliest start in each.
+func (c *Calendar) timezones() []*zone {
+	var zones []*zone
+	seen := make(map[string]*zone)
+	for _, e := range c.Events {
+		loc := e.Start.Location()
+		if loc == time.UTC {
+			continue
+		}
+		z, ok := seen[loc.String()]
+		if !ok {
+			z = &zone{loc: loc, since: e.Start}
+			seen[loc.String()] = z
+			zones = append(zones, z)
+		}
+		if e.Start.Before(z.since) {
+			z.since = e.Start
+		}
+	}
+	return zones
+}
+
+// transition is a change of UTC offset.
+type transition struct {
+	at       time.Time
+	from, to int
+	name     string
+	dst      bool
+}
+
+// transitions returns the offset changes of loc during the given year.
+func transitions(loc *time.Location, year int) []transition {
+	var found []transition
+
+	end := time.Date(year+1, time.January, 1, 0, 0, 0, 0, time.UTC)
+	for t := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC); t.Before(end); t = t.Add(24 * time.Hour) {
+		_, before := t.In(loc).Zone()
+		_, after := t.Add(24 * time.Hour).In(loc).Zone()
+		if before == after {
+			continue
+		}
+
+		// The offset changes within this day; find the second it does.
+		lo, hi := t, t.Add(24*time.Hour)
+		for hi.Sub(lo) > time.Second {
+			mid := lo.Add(hi.Sub(lo) / 2)
+			if _, offset := mid.In(loc).Zone(); offset == before {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+
+		name, offset := hi.In(loc).Zone()
+		found = append(found, transition{at: hi, from: before, to: offset, name: name, dst: hi.In(loc).IsDST()})
+	}
+
+	return found
+}
+
+// timezone writes a VTIMEZONE for loc. Its offset changes in the given year
+// become yearly rules on the same weekday of the month, which is how DST rules
+// are written in practice.
+func (cw *writer) timezone(loc *time.Location, year int) {
+	cw.line("BEGIN:VTIMEZONE")
+	cw.line("TZID:" + loc.String())
+
+	changes := transitions(loc, year)
+	if len(changes) == 0 {
+		name, offset := time.Date(year, time.January, 1, 0, 0, 0, 0, loc).Zone()
+		cw.line("BEGIN:STANDARD")
+		cw.line("DTSTART:19700101T000000")
+		cw.line("TZOFFSETFROM:" + utcOffset(offset))
+		cw.line("TZOFFSETTO:" + utcOffset(offset))
+		cw.line("TZNAME:" + escape(name))
+		cw.line("END:STANDARD")
+	}
+
+	for _, change := range changes {
+		kind := "STANDARD"
+		if change.dst {
+			kind = "DAYLIGHT"
+		}
+
+		// DTSTART is the wall-clock time the change happens at, before it.
+		local := change.at.In(time.FixedZone("", change.from))
+		week := (local.Day()-1)/7 + 1
+		if local.AddDate(0, 0, 7).Month() != local.Month() {
+			week = -1
+		}
+
+		cw.line("BEGIN:" + kind)
+		cw.line("DTSTART:" + local.Format(localFormat))
+		cw.line(fmt.Sprintf("RRULE:FREQ=YEARLY;BYMONTH=%d;BYDAY=%d%s", local.Month(), week, strings.ToUpper(local.Weekday().String()[:2])))
+		cw.line("TZOFFSETFROM:" + utcOffset(change.from))
+		cw.line("TZOFFSETTO:" + utcOffset(change.to))
+		cw.line("TZNAME:" + escape(change.name))
+		cw.line("END:" + kind)
+	}
+
+	cw.line("END:VTIMEZONE")
+}
+
+// utcOffset formats an offset in seconds east of UTC as +HHMM, or +HHMMSS
+// when it isn't a whole number of minutes.
+func utcOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign, seconds = "-", -seconds
+	}
+	s := fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds/60%60)
+	if seconds%60 != 0 {
+		s += fmt.Sprintf("%02d", seconds%60)
+	}
+	return s
+}
+
+func dateTime(name string, t time.Time) string {
+	if t.Location() == time.UTC {
+		return name + ":" + t.Format(utcFormat)
+	}
+	return fmt.Sprintf("%s;TZID=%s:%s", name, t.Location(), t.Format(localFormat))
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+type writer struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+// line writes a content line, folding it at 75 octets as the RFC requires.
+func (cw *writer) line(s string) {
+	for len(s) > 75 {
+		cut := 75
+		// Don't split a UTF-8 sequence.
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		cw.write(s[:cut] + "\r\n")
+		s = " " + s[cut:]
+	}
+	cw.write(s + "\r\n")
+}
+
+func (cw *writer) write(s string) {
+	if cw.err != nil {
+		return
+	}
+	n, err := cw.w.WriteString(s)
+	cw.n += int64(n)
+	cw.err = err
+}
@@ -0,0 +1,114 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCalendarWriteTo(t *testing.T) {
+	load := func(name string) *time.Location {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			t.Skip("time zone database not available")
+		}
+		return loc
+	}
+	stamp := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		start time.Time
+		rrule string
+		want  []string
+	}{
+		{
+			name:  "UTC",
+			start: time.Date(2024, 1, 3, 7, 0, 0, 0, time.UTC),
+			want: []string{
+				"DTSTART:20240103T070000Z",
+				"DTEND:20240103T080000Z",
+			},
+		},
+		{
+			name:  "European daylight saving time",
+			start: time.Date(2024, 1, 3, 7, 0, 0, 0, load("Europe/Berlin")),
+			rrule: "FREQ=WEEKLY;BYDAY=WE",
+			want: []string{
+				"BEGIN:VTIMEZONE\r\nTZID:Europe/Berlin\r\n",
+				"BEGIN:DAYLIGHT\r\nDTSTART:20230326T020000\r\nRRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU\r\nTZOFFSETFROM:+0100\r\nTZOFFSETTO:+0200\r\nTZNAME:CEST\r\nEND:DAYLIGHT",
+				"BEGIN:STANDARD\r\nDTSTART:20231029T030000\r\nRRULE:FREQ=YEARLY;BYMONTH=10;BYDAY=-1SU\r\nTZOFFSETFROM:+0200\r\nTZOFFSETTO:+0100\r\nTZNAME:CET\r\nEND:STANDARD",
+				"DTSTART;TZID=Europe/Berlin:20240103T070000",
+				"DTEND;TZID=Europe/Berlin:20240103T080000",
+				"RRULE:FREQ=WEEKLY;BYDAY=WE",
+			},
+		},
+		{
+			name:  "American daylight saving time",
+			start: time.Date(2024, 1, 3, 18, 0, 0, 0, load("America/New_York")),
+			want: []string{
+				"BEGIN:DAYLIGHT\r\nDTSTART:20230312T020000\r\nRRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=2SU\r\nTZOFFSETFROM:-0500\r\nTZOFFSETTO:-0400\r\nTZNAME:EDT\r\nEND:DAYLIGHT",
+				"BEGIN:STANDARD\r\nDTSTART:20231105T020000\r\nRRULE:FREQ=YEARLY;BYMONTH=11;BYDAY=1SU\r\nTZOFFSETFROM:-0400\r\nTZOFFSETTO:-0500\r\nTZNAME:EST\r\nEND:STANDARD",
+			},
+		},
+		{
+			name:  "no daylight saving time",
+			start: time.Date(2024, 1, 3, 7, 0, 0, 0, load("Asia/Kolkata")),
+			want: []string{
+				"BEGIN:STANDARD\r\nDTSTART:19700101T000000\r\nTZOFFSETFROM:+0530\r\nTZOFFSETTO:+0530\r\nTZNAME:IST\r\nEND:STANDARD",
+				"DTSTART;TZID=Asia/Kolkata:20240103T070000",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calendar := &Calendar{Name: "Go To Gym", Events: []*Event{{
+				UID:     "schedule-1@gotogym",
+				Stamp:   stamp,
+				Start:   tt.start,
+				End:     tt.start.Add(time.Hour),
+				Summary: "Legs",
+				RRule:   tt.rrule,
+			}}}
+
+			var b strings.Builder
+			_, err := calendar.WriteTo(&b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := b.String()
+
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("feed does not contain %q:\n%s", want, got)
+				}
+			}
+			if zones := strings.Count(got, "BEGIN:VTIMEZONE"); tt.start.Location() == time.UTC && zones != 0 {
+				t.Errorf("feed has %d VTIMEZONE components; want none for UTC", zones)
+			}
+		})
+	}
+}
+
+func TestUTCOffset(t *testing.T) {
+	tests := []struct {
+		seconds int
+		want    string
+	}{
+		{0, "+0000"},
+		{3600, "+0100"},
+		{-5 * 3600, "-0500"},
+		{5*3600 + 30*60, "+0530"},
+		{-(9*3600 + 30*60), "-0930"},
+		{4075, "+010755"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := utcOffset(tt.seconds); got != tt.want {
+				t.Errorf("utcOffset(%d) = %q; want %q", tt.seconds, got, tt.want)
+			}
+		})
+	}
+}
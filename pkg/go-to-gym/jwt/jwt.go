@@ -0,0 +1,183 @@
+// Package jwt signs and verifies the compact JSON Web Tokens used for
+// stateless authentication, with HS256 or EdDSA (Ed25519) keys.
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("jwt: invalid token")
+	ErrExpiredToken = errors.New("jwt: token has expired")
+)
+
+// leeway allows for clock drift between servers.
+const leeway = 30 * time.Second
+
+type Claims struct {
+	Subject   string `json:"sub"`
+	Issuer    string `json:"iss"`
+	Audience  string `json:"aud"`
+	IssuedAt  int64  `json:"iat"`
+	NotBefore int64  `json:"nbf"`
+	Expiry    int64  `json:"exp"`
+
+	Activated   bool     `json:"act"`
+	Permissions []string `json:"perms"`
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+}
+
+// Key signs and verifies tokens. Tokens are only accepted if they were signed
+// with the key's own algorithm, and with its issuer and audience.
+type Key struct {
+	alg      string
+	secret   []byte
+	private  ed25519.PrivateKey
+	public   ed25519.PublicKey
+	issuer   string
+	audience string
+}
+
+func NewHMAC(secret []byte, issuer, audience string) *Key {
+	return &Key{alg: "HS256", secret: secret, issuer: issuer, audience: audience}
+}
+
+func NewEd25519(private ed25519.PrivateKey, issuer, audience string) *Key {
+	return &Key{
+		alg:      "EdDSA",
+		private:  private,
+		public:   private.Public().(ed25519.PublicKey),
+		issuer:   issuer,
+		audience: audience,
+	}
+}
+
+// Sign fills in the issuer, audience and times of claims and returns the
+// signed token, valid for ttl.
+func (k *Key) Sign(claims Claims, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now()
+	expiry := now.Add(ttl)
+
+	claims.Issuer = k.issuer
+	claims.Audience = k.audience
+	claims.IssuedAt = now.Unix()
+	claims.NotBefore = now.Unix()
+	claims.Expiry = expiry.Unix()
+
+	h, err := json.Marshal(header{Alg: k.alg, Typ: "JWT"})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	signingInput := encode(h) + "." + encode(c)
+	return signingInput + "." + encode(k.sign([]byte(signingInput))), time.Unix(claims.Expiry, 0), nil
+}
+
+// Parse verifies token and returns its claims.
+func (k *Key) Parse(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	h, err := decode(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var hdr header
+	if err = json.Unmarshal(h, &hdr); err != nil || hdr.Alg != k.alg {
+		return nil, ErrInvalidToken
+	}
+
+	signature, err := decode(parts[2])
+	if err != nil || !k.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return nil, ErrInvalidToken
+	}
+
+	c, err := decode(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims Claims
+	if err = json.Unmarshal(c, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if claims.Issuer != k.issuer || claims.Audience != k.audience || claims.Subject == "" {
+		return nil, ErrInvalidToken
+	}
+
+	now := time.Now()
+	if now.Add(leeway).Unix() < claims.NotBefore {
+		return nil, ErrInvalidToken
+	}
+	if now.Add(-leeway).Unix() >= claims.Expiry {
+		return nil, ErrExpiredToken
+	}
+	return &claims, nil
+}
+
+// LooksLikeJWT reports whether token has the shape of a compact JWT, as
+// opposed to an opaque database token.
+func LooksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// ParseEd25519PrivateKey reads a PEM encoded PKCS #8 Ed25519 private key, as
+// written by "openssl genpkey -algorithm ed25519".
+func ParseEd25519PrivateKey(data []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("jwt: no PEM data found")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("jwt: not an Ed25519 private key")
+	}
+	return private, nil
+}
+
+func (k *Key) sign(data []byte) []byte {
+	if k.alg == "EdDSA" {
+		return ed25519.Sign(k.private, data)
+	}
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func (k *Key) verify(data, signature []byte) bool {
+	if k.alg == "EdDSA" {
+		return ed25519.Verify(k.public, data, signature)
+	}
+	return hmac.Equal(k.sign(data), signature)
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
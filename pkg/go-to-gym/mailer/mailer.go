@@ -0,0 +1,129 @@
+// Package mailer renders the application's emails from templates and delivers
+// them over SMTP or into an outbox.
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	ttemplate "text/template"
+	"time"
+)
+
+//go:embed "templates"
+var templateFS embed.FS
+
+// Template files, each defining a "subject", "plainBody" and "htmlBody".
+const (
+	TemplateWelcome       = "user_welcome.tmpl"
+	TemplateActivation    = "token_activation.tmpl"
+	TemplatePasswordReset = "token_password_reset.tmpl"
+	TemplateCoachInvite   = "token_coach_invitation.tmpl"
+	TemplateUnlock        = "token_unlock.tmpl"
+	TemplateEmailChange   = "token_email_change.tmpl"
+)
+
+type Mailer interface {
+	Send(recipient, templateFile string, data any) error
+}
+
+type Message struct {
+	From      string
+	To        string
+	Subject   string
+	PlainBody string
+	HTMLBody  string
+	Date      time.Time
+}
+
+// Render executes templateFile with data. The subject and plain text body are
+// rendered as text, the HTML body with html/template escaping.
+func Render(sender, recipient, templateFile string, data any) (*Message, error) {
+	text, err := ttemplate.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+	html, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &Message{From: sender, To: recipient, Date: time.Now()}
+
+	var buf strings.Builder
+	if err = text.ExecuteTemplate(&buf, "subject", data); err != nil {
+		return nil, err
+	}
+	msg.Subject = strings.TrimSpace(buf.String())
+
+	buf.Reset()
+	if err = text.ExecuteTemplate(&buf, "plainBody", data); err != nil {
+		return nil, err
+	}
+	msg.PlainBody = buf.String()
+
+	buf.Reset()
+	if err = html.ExecuteTemplate(&buf, "htmlBody", data); err != nil {
+		return nil, err
+	}
+	msg.HTMLBody = buf.String()
+
+	return msg, nil
+}
+
+// Bytes formats the message as a multipart/alternative MIME message.
+func (msg *Message) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	body := multipart.NewWriter(&buf)
+
+	header := func(key, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+	}
+	header("From", msg.From)
+	header("To", msg.To)
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", msg.Date.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", `multipart/alternative; boundary="`+body.Boundary()+`"`)
+	buf.WriteString("\r\n")
+
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", msg.PlainBody},
+		{"text/html; charset=utf-8", msg.HTMLBody},
+	} {
+		w, err := body.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err = qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err = qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func address(s string) (string, error) {
+	addr, err := mail.ParseAddress(s)
+	if err != nil {
+		return "", fmt.Errorf("mailer: invalid address %q: %w", s, err)
+	}
+	return addr.Address, nil
+}
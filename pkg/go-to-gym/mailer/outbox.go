@@ -0,0 +1,64 @@
+package mailer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Outbox keeps messages instead of delivering them, for development and tests.
+// It writes each message either to a stream or as an .eml file in a directory.
+type Outbox struct {
+	mu     sync.Mutex
+	w      io.Writer
+	dir    string
+	sender string
+	count  int
+}
+
+func NewOutbox(w io.Writer, sender string) *Outbox {
+	return &Outbox{w: w, sender: sender}
+}
+
+func NewDirOutbox(dir, sender string) (*Outbox, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	return &Outbox{dir: dir, sender: sender}, nil
+}
+
+func (o *Outbox) Send(recipient, templateFile string, data any) error {
+	msg, err := Render(o.sender, recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+	body, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.count++
+
+	if o.dir == "" {
+		_, err = fmt.Fprintf(o.w, "----- message %d -----\r\n%s\r\n", o.count, body)
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%03d-%s.eml",
+		msg.Date.UTC().Format("20060102T150405"), o.count, strings.TrimSuffix(templateFile, ".tmpl"))
+	return os.WriteFile(filepath.Join(o.dir, name), body, 0o644)
+}
+
+// Count returns the number of messages sent so far.
+func (o *Outbox) Count() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.count
+}
@@ -0,0 +1,97 @@
+package mailer
+
+import (
+	"crypto/tls"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// SMTP delivers messages through an SMTP server, upgrading the connection
+// with STARTTLS when the server offers it.
+type SMTP struct {
+	host     string
+	port     int
+	username string
+	password string
+	sender   string
+	timeout  time.Duration
+}
+
+func NewSMTP(host string, port int, username, password, sender string) *SMTP {
+	return &SMTP{
+		host:     host,
+		port:     port,
+		username: username,
+		password: password,
+		sender:   sender,
+		timeout:  10 * time.Second,
+	}
+}
+
+func (m *SMTP) Send(recipient, templateFile string, data any) error {
+	msg, err := Render(m.sender, recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+	body, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	from, err := address(m.sender)
+	if err != nil {
+		return err
+	}
+	to, err := address(recipient)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(m.host, strconv.Itoa(m.port)), m.timeout)
+	if err != nil {
+		return err
+	}
+	err = conn.SetDeadline(time.Now().Add(m.timeout))
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err = c.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+			return err
+		}
+	}
+	if m.username != "" {
+		if err = c.Auth(smtp.PlainAuth("", m.username, m.password, m.host)); err != nil {
+			return err
+		}
+	}
+
+	if err = c.Mail(from); err != nil {
+		return err
+	}
+	if err = c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(body); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
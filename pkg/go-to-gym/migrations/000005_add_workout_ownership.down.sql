@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS exercises_user_id_idx;
+DROP INDEX IF EXISTS workouts_user_id_idx;
+ALTER TABLE exercises DROP COLUMN IF EXISTS user_id;
+ALTER TABLE workouts DROP CONSTRAINT IF EXISTS workouts_visibility_check;
+ALTER TABLE workouts DROP COLUMN IF EXISTS visibility;
+ALTER TABLE workouts DROP COLUMN IF EXISTS user_id;
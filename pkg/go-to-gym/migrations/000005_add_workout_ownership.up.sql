@@ -0,0 +1,34 @@
+ALTER TABLE workouts
+    ADD COLUMN IF NOT EXISTS user_id    bigint REFERENCES users ON DELETE CASCADE,
+    ADD COLUMN IF NOT EXISTS visibility text NOT NULL DEFAULT 'private';
+
+ALTER TABLE exercises
+    ADD COLUMN IF NOT EXISTS user_id bigint REFERENCES users ON DELETE CASCADE;
+
+ALTER TABLE workouts
+    ADD CONSTRAINT workouts_visibility_check CHECK (visibility IN ('private', 'shared', 'public'));
+
+-- Existing programs were visible to everybody, so they are handed over to the
+-- admin account and kept public. The admin is the 'admin@example.com' user if
+-- present, otherwise the oldest user holding 'workouts:write'.
+UPDATE workouts
+SET user_id    = COALESCE(
+        (SELECT id FROM users WHERE email = 'admin@example.com'),
+        (SELECT users.id
+         FROM users
+                  INNER JOIN users_permissions ON users_permissions.user_id = users.id
+                  INNER JOIN permissions ON users_permissions.permission_id = permissions.id
+         WHERE permissions.code = 'workouts:write'
+         ORDER BY users.id
+         LIMIT 1)),
+    visibility = 'public'
+WHERE user_id IS NULL;
+
+UPDATE exercises
+SET user_id = workouts.user_id
+FROM workouts
+WHERE exercises.workout_id = workouts.id
+  AND exercises.user_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS workouts_user_id_idx ON workouts (user_id);
+CREATE INDEX IF NOT EXISTS exercises_user_id_idx ON exercises (user_id);
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS workout_sessions
+(
+    id          bigserial PRIMARY KEY,
+    created_at  timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    user_id     bigint                      NOT NULL REFERENCES users ON DELETE CASCADE,
+    workout_id  INT REFERENCES workouts (id) ON DELETE SET NULL,
+    started_at  timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    finished_at timestamp(0) with time zone,
+    notes       text                        NOT NULL DEFAULT '',
+    version     integer                     NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS session_sets
+(
+    id            bigserial PRIMARY KEY,
+    performed_at  timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    session_id    bigint                      NOT NULL REFERENCES workout_sessions ON DELETE CASCADE,
+    exercise_id   INT REFERENCES exercises (id) ON DELETE SET NULL,
+    exercise_name VARCHAR(255)                NOT NULL,
+    weight        numeric(7, 2)               NOT NULL DEFAULT 0,
+    reps          INT                         NOT NULL,
+    rpe           numeric(3, 1)               NOT NULL DEFAULT 0,
+    rest_seconds  INT                         NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS workout_sessions_user_id_started_at_idx ON workout_sessions (user_id, started_at);
+CREATE INDEX IF NOT EXISTS session_sets_session_id_idx ON session_sets (session_id);
@@ -0,0 +1,15 @@
+UPDATE exercises
+SET reps = duration_seconds / 60
+WHERE name IN ('Running', 'Cycling')
+  AND reps = 0
+  AND duration_seconds > 0;
+
+ALTER TABLE exercises
+    DROP CONSTRAINT IF EXISTS exercises_distance_unit_check,
+    DROP CONSTRAINT IF EXISTS exercises_weight_unit_check,
+    DROP COLUMN IF EXISTS tempo,
+    DROP COLUMN IF EXISTS distance_unit,
+    DROP COLUMN IF EXISTS distance,
+    DROP COLUMN IF EXISTS duration_seconds,
+    DROP COLUMN IF EXISTS weight_unit,
+    DROP COLUMN IF EXISTS weight;
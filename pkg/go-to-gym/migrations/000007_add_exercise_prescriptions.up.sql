@@ -0,0 +1,18 @@
+ALTER TABLE exercises
+    ADD COLUMN IF NOT EXISTS weight           numeric(7, 2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS weight_unit      text          NOT NULL DEFAULT 'kg',
+    ADD COLUMN IF NOT EXISTS duration_seconds INT           NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS distance         numeric(8, 3) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS distance_unit    text          NOT NULL DEFAULT 'km',
+    ADD COLUMN IF NOT EXISTS tempo            text          NOT NULL DEFAULT '';
+
+ALTER TABLE exercises
+    ADD CONSTRAINT exercises_weight_unit_check CHECK (weight_unit IN ('kg', 'lb')),
+    ADD CONSTRAINT exercises_distance_unit_check CHECK (distance_unit IN ('km', 'mi'));
+
+-- Cardio entries used to store their minutes in reps.
+UPDATE exercises
+SET duration_seconds = reps * 60,
+    reps             = 0
+WHERE name IN ('Running', 'Cycling')
+  AND duration_seconds = 0;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS personal_records
+(
+    id            bigserial PRIMARY KEY,
+    achieved_at   timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    user_id       bigint                      NOT NULL REFERENCES users ON DELETE CASCADE,
+    exercise_name VARCHAR(255)                NOT NULL,
+    record_type   text                        NOT NULL,
+    value         numeric(10, 2)              NOT NULL,
+    weight        numeric(7, 2)               NOT NULL DEFAULT 0,
+    reps          INT                         NOT NULL DEFAULT 0,
+    session_id    bigint                      NOT NULL REFERENCES workout_sessions ON DELETE CASCADE,
+    set_id        bigint                      NOT NULL REFERENCES session_sets ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS personal_records_user_id_exercise_idx ON personal_records (user_id, lower(exercise_name));
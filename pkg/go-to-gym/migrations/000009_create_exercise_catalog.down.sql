@@ -0,0 +1,17 @@
+DELETE FROM permissions WHERE code = 'catalog:write';
+
+DROP INDEX IF EXISTS exercises_workout_id_idx;
+
+ALTER TABLE workouts
+    ADD COLUMN IF NOT EXISTS exercises TEXT[] NOT NULL DEFAULT '{}';
+
+UPDATE workouts
+SET exercises = ARRAY(SELECT exercises.name FROM exercises WHERE exercises.workout_id = workouts.id ORDER BY exercises.id);
+
+ALTER TABLE workouts
+    ALTER COLUMN exercises DROP DEFAULT;
+
+ALTER TABLE exercises
+    DROP COLUMN IF EXISTS catalog_id;
+
+DROP TABLE IF EXISTS catalog_exercises;
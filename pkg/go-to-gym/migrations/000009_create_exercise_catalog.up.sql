@@ -0,0 +1,98 @@
+CREATE TABLE IF NOT EXISTS catalog_exercises
+(
+    id                bigserial PRIMARY KEY,
+    created_at        timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name              VARCHAR(255)                NOT NULL,
+    aliases           text[]                      NOT NULL DEFAULT '{}',
+    primary_muscles   text[]                      NOT NULL DEFAULT '{}',
+    secondary_muscles text[]                      NOT NULL DEFAULT '{}',
+    equipment         text                        NOT NULL DEFAULT '',
+    category          text                        NOT NULL DEFAULT 'other',
+    version           integer                     NOT NULL DEFAULT 1
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS catalog_exercises_name_idx ON catalog_exercises (lower(name));
+
+INSERT INTO catalog_exercises (name, aliases, primary_muscles, secondary_muscles, equipment, category)
+VALUES ('Squats', '{Squat,Back Squat}', '{quadriceps,glutes}', '{hamstrings,core}', 'barbell', 'strength'),
+       ('Lunges', '{Lunge}', '{quadriceps,glutes}', '{hamstrings,calves}', 'bodyweight', 'strength'),
+       ('Leg Press', '{}', '{quadriceps}', '{glutes,hamstrings}', 'machine', 'strength'),
+       ('Bicep Curls', '{Biceps Curl,Curls}', '{biceps}', '{forearms}', 'dumbbell', 'strength'),
+       ('Hammer Curls', '{Hammer Curl}', '{biceps,forearms}', '{}', 'dumbbell', 'strength'),
+       ('Dips', '{Dip}', '{triceps,chest}', '{shoulders}', 'bodyweight', 'strength'),
+       ('Shoulder Press', '{Overhead Press,OHP,Military Press}', '{shoulders}', '{triceps}', 'barbell', 'strength'),
+       ('Bench Press', '{Bench}', '{chest}', '{triceps,shoulders}', 'barbell', 'strength'),
+       ('Push-ups', '{Push-up,Pushups,Push ups}', '{chest}', '{triceps,shoulders,core}', 'bodyweight', 'strength'),
+       ('Dumbbell Flyes', '{Dumbbell Fly,Flyes}', '{chest}', '{shoulders}', 'dumbbell', 'strength'),
+       ('Planks', '{Plank}', '{core}', '{shoulders}', 'bodyweight', 'strength'),
+       ('Russian Twists', '{Russian Twist}', '{core}', '{}', 'bodyweight', 'strength'),
+       ('Leg Raises', '{Leg Raise}', '{core}', '{}', 'bodyweight', 'strength'),
+       ('Crunches', '{Crunch}', '{core}', '{}', 'bodyweight', 'strength'),
+       ('Deadlifts', '{Deadlift}', '{hamstrings,glutes,back}', '{forearms,core}', 'barbell', 'strength'),
+       ('Pull-ups', '{Pull-up,Pullups,Chin-ups}', '{back}', '{biceps,forearms}', 'bodyweight', 'strength'),
+       ('Rows', '{Row,Barbell Row,Bent-over Row}', '{back}', '{biceps,shoulders}', 'barbell', 'strength'),
+       ('Running', '{Run,Jogging}', '{quadriceps,hamstrings,calves}', '{glutes}', 'none', 'cardio'),
+       ('Running in Place', '{}', '{quadriceps,calves}', '{}', 'none', 'cardio'),
+       ('Cycling', '{Bike,Biking}', '{quadriceps}', '{hamstrings,calves,glutes}', 'bike', 'cardio'),
+       ('Jumping Jacks', '{Jumping Jack}', '{full_body}', '{}', 'none', 'cardio'),
+       ('Jumping Rope', '{Jump Rope,Skipping}', '{calves}', '{shoulders,forearms}', 'jump rope', 'cardio'),
+       ('Burpees', '{Burpee}', '{full_body}', '{}', 'none', 'plyometrics'),
+       ('Mountain Climbers', '{Mountain Climber}', '{core}', '{shoulders,quadriceps}', 'none', 'cardio'),
+       ('High Knees', '{}', '{quadriceps}', '{core,calves}', 'none', 'cardio'),
+       ('Downward-Facing Dog', '{Downward Dog}', '{hamstrings,calves}', '{shoulders}', 'mat', 'mobility'),
+       ('Warrior Pose', '{}', '{quadriceps,glutes}', '{core}', 'mat', 'mobility'),
+       ('Triangle Pose', '{}', '{hamstrings,core}', '{}', 'mat', 'mobility'),
+       ('Cat-Cow', '{}', '{back,core}', '{}', 'mat', 'mobility'),
+       ('Childs Pose', '{Child''s Pose}', '{back}', '{}', 'mat', 'mobility')
+ON CONFLICT DO NOTHING;
+
+-- Anything else users typed into a workout becomes an uncategorised entry.
+INSERT INTO catalog_exercises (name)
+SELECT DISTINCT ON (lower(names.name)) names.name
+FROM (SELECT unnest(exercises) AS name
+      FROM workouts
+      UNION ALL
+      SELECT name
+      FROM exercises) AS names
+WHERE NOT EXISTS (SELECT 1
+                  FROM catalog_exercises
+                  WHERE lower(catalog_exercises.name) = lower(names.name)
+                     OR lower(names.name) IN (SELECT lower(alias) FROM unnest(catalog_exercises.aliases) AS alias))
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE exercises
+    ADD COLUMN IF NOT EXISTS catalog_id bigint REFERENCES catalog_exercises ON DELETE RESTRICT;
+
+UPDATE exercises
+SET catalog_id = catalog_exercises.id,
+    name       = catalog_exercises.name
+FROM catalog_exercises
+WHERE exercises.catalog_id IS NULL
+  AND (lower(catalog_exercises.name) = lower(exercises.name)
+    OR lower(exercises.name) IN (SELECT lower(alias) FROM unnest(catalog_exercises.aliases) AS alias));
+
+-- The exercises rows become the only list of a workout's exercises, so every
+-- array entry without a matching row gets one.
+INSERT INTO exercises (user_id, name, sets, reps, workout_id, catalog_id)
+SELECT workouts.user_id, catalog_exercises.name, 0, 0, workouts.id, catalog_exercises.id
+FROM workouts
+         CROSS JOIN LATERAL unnest(workouts.exercises) WITH ORDINALITY AS names(name, position)
+         INNER JOIN catalog_exercises
+                    ON lower(catalog_exercises.name) = lower(names.name)
+                        OR lower(names.name) IN (SELECT lower(alias) FROM unnest(catalog_exercises.aliases) AS alias)
+WHERE NOT EXISTS (SELECT 1
+                  FROM exercises
+                  WHERE exercises.workout_id = workouts.id
+                    AND exercises.catalog_id = catalog_exercises.id)
+ORDER BY workouts.id, names.position;
+
+ALTER TABLE exercises
+    ALTER COLUMN catalog_id SET NOT NULL;
+
+ALTER TABLE workouts
+    DROP COLUMN IF EXISTS exercises;
+
+CREATE INDEX IF NOT EXISTS exercises_workout_id_idx ON exercises (workout_id);
+
+INSERT INTO permissions (code)
+VALUES ('catalog:write');
@@ -0,0 +1,5 @@
+ALTER TABLE exercises
+    DROP COLUMN IF EXISTS group_id,
+    DROP COLUMN IF EXISTS position;
+
+DROP TABLE IF EXISTS exercise_groups;
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS exercise_groups
+(
+    id           bigserial PRIMARY KEY,
+    workout_id   INT  NOT NULL REFERENCES workouts (id) ON DELETE CASCADE,
+    kind         text NOT NULL,
+    rest_seconds INT  NOT NULL DEFAULT 0,
+    rounds       INT  NOT NULL DEFAULT 1,
+    CONSTRAINT exercise_groups_kind_check CHECK (kind IN ('superset', 'circuit', 'giant_set'))
+);
+
+ALTER TABLE exercises
+    ADD COLUMN IF NOT EXISTS position INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS group_id bigint REFERENCES exercise_groups ON DELETE SET NULL;
+
+UPDATE exercises
+SET position = numbered.position
+FROM (SELECT id, row_number() OVER (PARTITION BY workout_id ORDER BY id) AS position
+      FROM exercises) AS numbered
+WHERE exercises.id = numbered.id;
+
+CREATE INDEX IF NOT EXISTS exercise_groups_workout_id_idx ON exercise_groups (workout_id);
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS programs
+(
+    id               bigserial PRIMARY KEY,
+    created_at       timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    user_id          bigint                      NOT NULL REFERENCES users ON DELETE CASCADE,
+    name             VARCHAR(255)                NOT NULL,
+    description      text                        NOT NULL DEFAULT '',
+    weeks            INT                         NOT NULL,
+    visibility       text                        NOT NULL DEFAULT 'private',
+    progression_rule text                        NOT NULL DEFAULT 'none',
+    increment        numeric(6, 2)               NOT NULL DEFAULT 0,
+    reps_min         INT                         NOT NULL DEFAULT 0,
+    reps_max         INT                         NOT NULL DEFAULT 0,
+    wave_percents    numeric(5, 2)[]             NOT NULL DEFAULT '{}',
+    deload_weeks     INT[]                       NOT NULL DEFAULT '{}',
+    deload_percent   numeric(5, 2)               NOT NULL DEFAULT 0,
+    version          integer                     NOT NULL DEFAULT 1,
+    CONSTRAINT programs_visibility_check CHECK (visibility IN ('private', 'shared', 'public'))
+);
+
+CREATE TABLE IF NOT EXISTS program_days
+(
+    program_id bigint NOT NULL REFERENCES programs ON DELETE CASCADE,
+    week       INT    NOT NULL,
+    day        INT    NOT NULL,
+    workout_id INT    NOT NULL REFERENCES workouts (id) ON DELETE CASCADE,
+    PRIMARY KEY (program_id, week, day)
+);
+
+CREATE INDEX IF NOT EXISTS programs_user_id_idx ON programs (user_id);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS scheduled_workouts
+(
+    id               bigserial PRIMARY KEY,
+    created_at       timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    user_id          bigint                      NOT NULL REFERENCES users ON DELETE CASCADE,
+    workout_id       INT                         NOT NULL REFERENCES workouts (id) ON DELETE CASCADE,
+    starts_at        timestamp(0) with time zone NOT NULL,
+    duration_minutes INT                         NOT NULL DEFAULT 60,
+    timezone         text                        NOT NULL DEFAULT 'UTC',
+    rrule            text                        NOT NULL DEFAULT '',
+    notes            text                        NOT NULL DEFAULT '',
+    version          integer                     NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS scheduled_workouts_user_id_starts_at_idx ON scheduled_workouts (user_id, starts_at);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS measurements
+(
+    id          bigserial PRIMARY KEY,
+    created_at  timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    user_id     bigint                      NOT NULL REFERENCES users ON DELETE CASCADE,
+    measured_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    kind        text                        NOT NULL,
+    value       numeric(7, 2)               NOT NULL,
+    unit        text                        NOT NULL,
+    notes       text                        NOT NULL DEFAULT '',
+    version     integer                     NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS measurements_user_id_kind_measured_at_idx ON measurements (user_id, kind, measured_at);
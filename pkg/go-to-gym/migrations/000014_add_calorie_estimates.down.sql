@@ -0,0 +1,9 @@
+ALTER TABLE workout_sessions
+    DROP COLUMN IF EXISTS calories_burned;
+
+UPDATE workouts
+SET calories_burned = 0
+WHERE calories_burned IS NULL;
+
+ALTER TABLE catalog_exercises
+    DROP COLUMN IF EXISTS met;
@@ -0,0 +1,48 @@
+-- MET values follow the Compendium of Physical Activities.
+ALTER TABLE catalog_exercises
+    ADD COLUMN IF NOT EXISTS met numeric(4, 1) NOT NULL DEFAULT 4.0;
+
+UPDATE catalog_exercises
+SET met = CASE category
+              WHEN 'strength' THEN 5.0
+              WHEN 'cardio' THEN 7.0
+              WHEN 'plyometrics' THEN 8.0
+              WHEN 'mobility' THEN 2.5
+              ELSE 4.0
+    END;
+
+UPDATE catalog_exercises
+SET met = CASE lower(name)
+              WHEN 'squats' THEN 6.0
+              WHEN 'deadlifts' THEN 6.0
+              WHEN 'bench press' THEN 6.0
+              WHEN 'rows' THEN 6.0
+              WHEN 'shoulder press' THEN 6.0
+              WHEN 'bicep curls' THEN 3.5
+              WHEN 'hammer curls' THEN 3.5
+              WHEN 'dumbbell flyes' THEN 3.5
+              WHEN 'planks' THEN 3.8
+              WHEN 'crunches' THEN 3.8
+              WHEN 'russian twists' THEN 3.8
+              WHEN 'leg raises' THEN 3.8
+              WHEN 'push-ups' THEN 8.0
+              WHEN 'pull-ups' THEN 8.0
+              WHEN 'dips' THEN 8.0
+              WHEN 'running' THEN 9.8
+              WHEN 'running in place' THEN 8.0
+              WHEN 'cycling' THEN 7.5
+              WHEN 'jumping jacks' THEN 7.7
+              WHEN 'jumping rope' THEN 11.8
+              WHEN 'mountain climbers' THEN 8.0
+              WHEN 'high knees' THEN 8.0
+              ELSE met
+    END;
+
+-- A workout's calories_burned is now a manual override; NULL means the
+-- server estimates it.
+UPDATE workouts
+SET calories_burned = NULL
+WHERE calories_burned = 0;
+
+ALTER TABLE workout_sessions
+    ADD COLUMN IF NOT EXISTS calories_burned integer;
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS tokens_user_id_scope_idx;
+DROP INDEX IF EXISTS tokens_expiry_idx;
+
+ALTER TABLE tokens
+    DROP COLUMN IF EXISTS ip,
+    DROP COLUMN IF EXISTS user_agent,
+    DROP COLUMN IF EXISTS last_used_at,
+    DROP COLUMN IF EXISTS created_at,
+    DROP COLUMN IF EXISTS id;
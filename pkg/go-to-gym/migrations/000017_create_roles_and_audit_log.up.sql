@@ -0,0 +1,54 @@
+CREATE TABLE IF NOT EXISTS roles
+(
+    id          bigserial PRIMARY KEY,
+    code        text NOT NULL UNIQUE,
+    description text NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS roles_permissions
+(
+    role_id       bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+    permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+CREATE TABLE IF NOT EXISTS users_roles
+(
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    role_id bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+    PRIMARY KEY (user_id, role_id)
+);
+
+INSERT INTO permissions (code)
+VALUES ('users:admin');
+
+INSERT INTO roles (code, description)
+VALUES ('member', 'Reads workouts and the exercise catalog.'),
+       ('coach', 'Also writes workouts and the exercise catalog.'),
+       ('admin', 'Everything, including managing roles and permissions.');
+
+INSERT INTO roles_permissions
+SELECT roles.id, permissions.id
+FROM roles,
+     permissions
+WHERE (roles.code = 'member' AND permissions.code = 'workouts:read')
+   OR (roles.code = 'coach' AND permissions.code IN ('workouts:read', 'workouts:write', 'catalog:write'))
+   OR roles.code = 'admin';
+
+-- Everyone registered so far becomes a member; their direct permissions stay.
+INSERT INTO users_roles
+SELECT users.id, roles.id
+FROM users,
+     roles
+WHERE roles.code = 'member';
+
+CREATE TABLE IF NOT EXISTS audit_log
+(
+    id             bigserial PRIMARY KEY,
+    created_at     timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    actor_id       bigint                      REFERENCES users ON DELETE SET NULL,
+    action         text                        NOT NULL,
+    target_user_id bigint                      REFERENCES users ON DELETE SET NULL,
+    details        jsonb                       NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_target_user_id_idx ON audit_log (target_user_id);
+CREATE INDEX IF NOT EXISTS audit_log_actor_id_idx ON audit_log (actor_id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS coach_assignments;
+DROP TABLE IF EXISTS coach_clients;
+DELETE FROM permissions WHERE code = 'clients:coach';
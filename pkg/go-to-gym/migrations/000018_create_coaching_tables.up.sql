@@ -0,0 +1,37 @@
+CREATE TABLE IF NOT EXISTS coach_clients
+(
+    id              bigserial PRIMARY KEY,
+    created_at      timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    coach_id        bigint                      NOT NULL REFERENCES users ON DELETE CASCADE,
+    client_id       bigint                      NOT NULL REFERENCES users ON DELETE CASCADE,
+    status          text                        NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'active')),
+    invitation_hash bytea,
+    accepted_at     timestamp(0) with time zone,
+    UNIQUE (coach_id, client_id),
+    CHECK (coach_id <> client_id)
+);
+
+CREATE INDEX IF NOT EXISTS coach_clients_client_id_idx ON coach_clients (client_id);
+
+CREATE TABLE IF NOT EXISTS coach_assignments
+(
+    id         bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    link_id    bigint                      NOT NULL REFERENCES coach_clients ON DELETE CASCADE,
+    workout_id bigint REFERENCES workouts ON DELETE CASCADE,
+    program_id bigint REFERENCES programs ON DELETE CASCADE,
+    notes      text                        NOT NULL DEFAULT '',
+    CHECK ((workout_id IS NULL) <> (program_id IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS coach_assignments_link_id_idx ON coach_assignments (link_id);
+
+INSERT INTO permissions (code)
+VALUES ('clients:coach');
+
+INSERT INTO roles_permissions
+SELECT roles.id, permissions.id
+FROM roles,
+     permissions
+WHERE roles.code IN ('coach', 'admin')
+  AND permissions.code = 'clients:coach';
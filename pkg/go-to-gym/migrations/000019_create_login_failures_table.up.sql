@@ -0,0 +1,11 @@
+-- Failed logins are counted per email address, whether or not it has an
+-- account, so lockouts don't reveal which addresses are registered.
+CREATE TABLE IF NOT EXISTS login_failures
+(
+    email          text PRIMARY KEY,
+    failures       integer                     NOT NULL DEFAULT 0,
+    last_failed_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    locked_until   timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS login_failures_last_failed_at_idx ON login_failures (last_failed_at);
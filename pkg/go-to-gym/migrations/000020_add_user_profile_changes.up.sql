@@ -0,0 +1,7 @@
+-- pending_email holds a new address until it is confirmed, and delete_after
+-- is when an account whose deletion was requested will be deleted.
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS pending_email text,
+    ADD COLUMN IF NOT EXISTS delete_after  timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS users_delete_after_idx ON users (delete_after) WHERE delete_after IS NOT NULL;
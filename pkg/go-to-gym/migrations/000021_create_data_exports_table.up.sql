@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS data_exports
+(
+    id          bigserial PRIMARY KEY,
+    created_at  timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    user_id     bigint                      NOT NULL REFERENCES users ON DELETE CASCADE,
+    status      text                        NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'ready', 'failed')),
+    finished_at timestamp(0) with time zone,
+    expiry      timestamp(0) with time zone,
+    size        bigint                      NOT NULL DEFAULT 0,
+    archive     bytea
+);
+
+CREATE INDEX IF NOT EXISTS data_exports_user_id_idx ON data_exports (user_id);
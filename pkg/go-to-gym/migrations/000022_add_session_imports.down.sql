@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS workout_sessions_import_key_idx;
+
+ALTER TABLE workout_sessions
+    DROP COLUMN IF EXISTS import_key,
+    DROP COLUMN IF EXISTS distance_km;
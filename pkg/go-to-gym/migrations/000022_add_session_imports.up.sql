@@ -0,0 +1,7 @@
+-- distance_km is the distance of a run or ride, and import_key identifies a
+-- session imported from another app so importing it again is skipped.
+ALTER TABLE workout_sessions
+    ADD COLUMN IF NOT EXISTS distance_km numeric(7, 2) NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS import_key  text          NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX IF NOT EXISTS workout_sessions_import_key_idx ON workout_sessions (user_id, import_key) WHERE import_key <> '';
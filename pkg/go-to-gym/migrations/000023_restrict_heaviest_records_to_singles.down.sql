@@ -0,0 +1,21 @@
+-- Rebuilds the heaviest_weight record history from the logged sets, counting sets of any reps.
+DELETE FROM personal_records
+WHERE record_type = 'heaviest_weight';
+
+INSERT INTO personal_records (user_id, exercise_name, record_type, value, weight, reps, session_id, set_id, achieved_at)
+SELECT user_id, exercise_name, 'heaviest_weight', weight, weight, reps, session_id, id, performed_at
+FROM (SELECT workout_sessions.user_id,
+             session_sets.exercise_name,
+             session_sets.weight,
+             session_sets.reps,
+             session_sets.session_id,
+             session_sets.id,
+             session_sets.performed_at,
+             MAX(session_sets.weight) OVER (PARTITION BY workout_sessions.user_id, lower(session_sets.exercise_name)
+                 ORDER BY session_sets.performed_at, session_sets.id
+                 ROWS BETWEEN UNBOUNDED PRECEDING AND 1 PRECEDING) AS previous_best
+      FROM session_sets
+               INNER JOIN workout_sessions ON workout_sessions.id = session_sets.session_id
+      WHERE session_sets.weight > 0) AS sets
+WHERE previous_best IS NULL
+   OR weight > previous_best;
@@ -0,0 +1,335 @@
+package model
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/validator"
+	"github.com/lib/pq"
+	"net"
+	"strings"
+	"time"
+)
+
+// APIKeyPrefix starts every API key, which is how authenticate tells them
+// apart from other bearer tokens.
+const APIKeyPrefix = "gtg_"
+
+type APIKey struct {
+	ID          int64       `json:"id"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UserID      int64       `json:"-"`
+	Name        string      `json:"name"`
+	Prefix      string      `json:"prefix"`
+	Plaintext   string      `json:"key,omitempty"`
+	Hash        []byte      `json:"-"`
+	Permissions Permissions `json:"permissions"`
+	Expiry      *time.Time  `json:"expiry"`
+	AllowedIPs  []string    `json:"allowed_ips"`
+	LastUsedAt  *time.Time  `json:"last_used_at"`
+	LastUsedIP  string      `json:"last_used_ip,omitempty"`
+	Version     int         `json:"version"`
+}
+
+// generate sets a new random key. Only its hash is stored, and Prefix is kept
+// so the user can tell their keys apart.
+func (k *APIKey) generate() error {
+	randomBytes := make([]byte, 20)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return err
+	}
+
+	k.Plaintext = APIKeyPrefix + base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	k.Prefix = k.Plaintext[:len(APIKeyPrefix)+8]
+
+	hash := sha256.Sum256([]byte(k.Plaintext))
+	k.Hash = hash[:]
+	return nil
+}
+
+// AllowsIP reports whether the key may be used from ip. Keys without an
+// allow-list can be used from anywhere.
+func (k *APIKey) AllowsIP(ip string) bool {
+	if len(k.AllowedIPs) == 0 {
+		return true
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, allowed := range k.AllowedIPs {
+		if _, network, err := net.ParseCIDR(allowed); err == nil {
+			if network.Contains(addr) {
+				return true
+			}
+		} else if allowedAddr := net.ParseIP(allowed); allowedAddr != nil && allowedAddr.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateAPIKey checks the key, whose permissions must be a subset of the
+// owner's.
+func ValidateAPIKey(v *validator.Validator, k *APIKey, ownerPermissions Permissions) {
+	v.Check(k.Name != "", "name", "must be provided")
+	v.Check(len(k.Name) <= 100, "name", "must not be more than 100 bytes long")
+
+	v.Check(len(k.Permissions) > 0, "permissions", "at least one permission must be provided")
+	v.Check(validator.Unique(k.Permissions), "permissions", "must not contain duplicate values")
+	for _, code := range k.Permissions {
+		v.Check(ownerPermissions.Include(code), "permissions", "must be a subset of your permissions")
+	}
+
+	if k.Expiry != nil {
+		v.Check(k.Expiry.After(time.Now()), "expiry", "must be in the future")
+	}
+
+	v.Check(len(k.AllowedIPs) <= 50, "allowed_ips", "must not contain more than 50 entries")
+	for _, allowed := range k.AllowedIPs {
+		_, _, err := net.ParseCIDR(allowed)
+		v.Check(err == nil || net.ParseIP(allowed) != nil, "allowed_ips", "must contain IP addresses or CIDR ranges")
+	}
+}
+
+func ValidateAPIKeyPlaintext(v *validator.Validator, keyPlaintext string) {
+	v.Check(strings.HasPrefix(keyPlaintext, APIKeyPrefix), "key", "must be an API key")
+	v.Check(len(keyPlaintext) == len(APIKeyPrefix)+32, "key", "must be 36 bytes long")
+}
+
+type APIKeyModel struct {
+	DB *sql.DB
+}
+
+// Insert generates the key, whose plaintext is only available on the returned
+// struct.
+func (m APIKeyModel) Insert(key *APIKey) error {
+	err := key.generate()
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO api_keys (user_id, name, prefix, hash, permissions, expiry, allowed_ips)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at, version`
+
+	args := []interface{}{
+		key.UserID,
+		key.Name,
+		key.Prefix,
+		key.Hash,
+		pq.Array(key.Permissions),
+		key.Expiry,
+		pq.Array(key.AllowedIPs),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&key.ID, &key.CreatedAt, &key.Version)
+}
+
+const apiKeyColumns = `api_keys.id, api_keys.created_at, api_keys.user_id, api_keys.name, api_keys.prefix,
+		       api_keys.permissions, api_keys.expiry, api_keys.allowed_ips, api_keys.last_used_at,
+		       api_keys.last_used_ip, api_keys.version`
+
+func scanAPIKey(key *APIKey) []interface{} {
+	return []interface{}{
+		&key.ID,
+		&key.CreatedAt,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		pq.Array(&key.Permissions),
+		&key.Expiry,
+		pq.Array(&key.AllowedIPs),
+		&key.LastUsedAt,
+		&key.LastUsedIP,
+		&key.Version,
+	}
+}
+
+func (m APIKeyModel) Get(id, userID int64) (*APIKey, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT ` + apiKeyColumns + `
+		FROM api_keys
+		WHERE id = $1 AND user_id = $2`
+
+	var key APIKey
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(scanAPIKey(&key)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &key, nil
+}
+
+func (m APIKeyModel) GetAllForUser(userID int64) ([]*APIKey, error) {
+	query := `
+		SELECT ` + apiKeyColumns + `
+		FROM api_keys
+		WHERE user_id = $1
+		ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+	for rows.Next() {
+		var key APIKey
+		err := rows.Scan(scanAPIKey(&key)...)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, &key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// GetForKey returns an unexpired key with its owner. The key's permissions
+// are narrowed to those the owner still has.
+func (m APIKeyModel) GetForKey(keyPlaintext string) (*APIKey, *User, error) {
+	keyHash := sha256.Sum256([]byte(keyPlaintext))
+
+	query := `
+		SELECT api_keys.id, api_keys.created_at, api_keys.user_id, api_keys.name, api_keys.prefix,
+		       ARRAY(SELECT permissions.code
+		             FROM permissions
+		             WHERE permissions.code = ANY(api_keys.permissions)
+		             AND (permissions.id IN (SELECT permission_id FROM users_permissions WHERE user_id = users.id)
+		                  OR permissions.id IN (SELECT roles_permissions.permission_id
+		                                        FROM roles_permissions
+		                                        INNER JOIN users_roles ON users_roles.role_id = roles_permissions.role_id
+		                                        WHERE users_roles.user_id = users.id))),
+		       api_keys.expiry, api_keys.allowed_ips, api_keys.last_used_at, api_keys.last_used_ip, api_keys.version,
+		       users.id, users.created_at, users.name, users.email, users.password_hash, users.activated,
+		       users.delete_after, users.version
+		FROM api_keys
+		INNER JOIN users ON users.id = api_keys.user_id
+		WHERE api_keys.hash = $1
+		AND (api_keys.expiry IS NULL OR api_keys.expiry > NOW())`
+
+	var key APIKey
+	var user User
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	dest := append(scanAPIKey(&key),
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.DeleteAfter,
+		&user.Version,
+	)
+
+	err := m.DB.QueryRowContext(ctx, query, keyHash[:]).Scan(dest...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrRecordNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+	return &key, &user, nil
+}
+
+func (m APIKeyModel) Update(key *APIKey) error {
+	query := `
+		UPDATE api_keys
+		SET name = $1, permissions = $2, expiry = $3, allowed_ips = $4, version = version + 1
+		WHERE id = $5 AND user_id = $6 AND version = $7
+		RETURNING version`
+
+	args := []interface{}{
+		key.Name,
+		pq.Array(key.Permissions),
+		key.Expiry,
+		pq.Array(key.AllowedIPs),
+		key.ID,
+		key.UserID,
+		key.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&key.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m APIKeyModel) Delete(id, userID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM api_keys
+		WHERE id = $1 AND user_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Touch records that a key was just used from ip. Like TokenModel.Touch it
+// writes at most once a minute per key, unless the IP changed.
+func (m APIKeyModel) Touch(id int64, ip string) error {
+	query := `
+		UPDATE api_keys
+		SET last_used_at = NOW(), last_used_ip = $2
+		WHERE id = $1
+		AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute' OR last_used_ip <> $2)`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, id, ip)
+	return err
+}
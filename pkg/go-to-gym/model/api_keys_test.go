@@ -0,0 +1,33 @@
+package model
+
+import "testing"
+
+func TestAPIKeyAllowsIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		allowedIPs []string
+		ip         string
+		want       bool
+	}{
+		{"no allow-list", nil, "203.0.113.7", true},
+		{"listed address", []string{"203.0.113.7"}, "203.0.113.7", true},
+		{"unlisted address", []string{"203.0.113.7"}, "203.0.113.8", false},
+		{"inside a range", []string{"198.51.100.0/24"}, "198.51.100.200", true},
+		{"outside a range", []string{"198.51.100.0/24"}, "198.51.101.1", false},
+		{"one of several", []string{"203.0.113.7", "10.0.0.0/8"}, "10.1.2.3", true},
+		{"IPv6 range", []string{"2001:db8::/32"}, "2001:db8::1", true},
+		{"IPv6 outside a range", []string{"2001:db8::/32"}, "2001:db9::1", false},
+		{"IPv4-mapped IPv6 address", []string{"203.0.113.7"}, "::ffff:203.0.113.7", true},
+		{"not an address", []string{"203.0.113.7"}, "localhost", false},
+		{"empty address", []string{"0.0.0.0/0"}, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := &APIKey{AllowedIPs: tt.allowedIPs}
+			if got := key.AllowsIP(tt.ip); got != tt.want {
+				t.Errorf("AllowsIP(%q) with %v = %v; want %v", tt.ip, tt.allowedIPs, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	AuditRoleGranted       = "role.granted"
+	AuditRoleRevoked       = "role.revoked"
+	AuditPermissionGranted = "permission.granted"
+	AuditPermissionRevoked = "permission.revoked"
+)
+
+// AuditEntry records an administrative change: who made it, what it was and
+// whose account it affected.
+type AuditEntry struct {
+	ID           int64             `json:"id"`
+	CreatedAt    time.Time         `json:"created_at"`
+	ActorID      *int64            `json:"actor_id"`
+	Action       string            `json:"action"`
+	TargetUserID *int64            `json:"target_user_id"`
+	Details      map[string]string `json:"details"`
+}
+
+type AuditModel struct {
+	DB *sql.DB
+}
+
+func (m AuditModel) Insert(entry *AuditEntry) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return insertAuditEntry(ctx, m.DB, entry)
+}
+
+func insertAuditEntry(ctx context.Context, q Querier, entry *AuditEntry) error {
+	details, err := json.Marshal(entry.Details)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO audit_log (actor_id, action, target_user_id, details)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`
+
+	return q.QueryRowContext(ctx, query, entry.ActorID, entry.Action, entry.TargetUserID, details).
+		Scan(&entry.ID, &entry.CreatedAt)
+}
+
+// recordChange executes the statement in query and inserts entry into the
+// audit log, in one transaction.
+func recordChange(db *sql.DB, entry *AuditEntry, query string, args ...interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	err = insertAuditEntry(ctx, tx, entry)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetAll returns audit entries, filtered by the user who made the change, the
+// user it affected and the action when those are non-zero.
+func (m AuditModel) GetAll(actorID, targetUserID int64, action string, filters Filters) ([]*AuditEntry, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, actor_id, action, target_user_id, details
+		FROM audit_log
+		WHERE (actor_id = $1 OR $1 = 0)
+		AND (target_user_id = $2 OR $2 = 0)
+		AND (action = $3 OR $3 = '')
+		ORDER BY %s %s, id DESC
+		LIMIT $4 OFFSET $5`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{actorID, targetUserID, action, filters.limit(), filters.offset()}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	entries := []*AuditEntry{}
+
+	for rows.Next() {
+		var entry AuditEntry
+		var details []byte
+
+		err := rows.Scan(
+			&totalRecords,
+			&entry.ID,
+			&entry.CreatedAt,
+			&entry.ActorID,
+			&entry.Action,
+			&entry.TargetUserID,
+			&details,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		err = json.Unmarshal(details, &entry.Details)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		entries = append(entries, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return entries, metadata, nil
+}
@@ -0,0 +1,115 @@
+package model
+
+import (
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/cache"
+	"slices"
+	"time"
+)
+
+// AuthCache keeps the users behind tokens, keyed by token hash, and users'
+// permissions for a short time, so authenticated requests can skip the
+// database. The models that change users, tokens, roles or permissions
+// invalidate the affected entries themselves. A nil *AuthCache caches nothing.
+type AuthCache struct {
+	users       *cache.Cache[string, tokenUser]
+	permissions *cache.Cache[int64, Permissions]
+}
+
+type tokenUser struct {
+	user   User
+	expiry time.Time
+}
+
+// NewAuthCache returns a cache whose entries live for ttl, or nil if ttl
+// isn't positive.
+func NewAuthCache(ttl time.Duration) *AuthCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &AuthCache{
+		users:       cache.New[string, tokenUser](ttl),
+		permissions: cache.New[int64, Permissions](ttl),
+	}
+}
+
+func tokenCacheKey(scope string, hash []byte) string {
+	return scope + ":" + string(hash)
+}
+
+func (c *AuthCache) getUser(scope string, hash []byte) (*User, bool) {
+	if c == nil {
+		return nil, false
+	}
+	cached, ok := c.users.Get(tokenCacheKey(scope, hash))
+	if !ok || !cached.expiry.After(time.Now()) {
+		return nil, false
+	}
+	// Callers may change the user they get, so each gets its own copy.
+	user := cached.user
+	return &user, true
+}
+
+func (c *AuthCache) setUser(scope string, hash []byte, user *User, expiry time.Time) {
+	if c == nil {
+		return
+	}
+	c.users.Set(tokenCacheKey(scope, hash), tokenUser{user: *user, expiry: expiry})
+}
+
+func (c *AuthCache) getPermissions(userID int64) (Permissions, bool) {
+	if c == nil {
+		return nil, false
+	}
+	permissions, ok := c.permissions.Get(userID)
+	return slices.Clone(permissions), ok
+}
+
+func (c *AuthCache) setPermissions(userID int64, permissions Permissions) {
+	if c == nil {
+		return
+	}
+	c.permissions.Set(userID, slices.Clone(permissions))
+}
+
+// invalidateToken forgets the user behind one token.
+func (c *AuthCache) invalidateToken(scope string, hash []byte) {
+	if c == nil {
+		return
+	}
+	c.users.Delete(tokenCacheKey(scope, hash))
+}
+
+// invalidateUser forgets everything cached about a user.
+func (c *AuthCache) invalidateUser(userID int64) {
+	if c == nil {
+		return
+	}
+	c.users.DeleteFunc(func(_ string, cached tokenUser) bool {
+		return cached.user.ID == userID
+	})
+	c.permissions.Delete(userID)
+}
+
+// DeleteExpired frees the memory of expired entries.
+func (c *AuthCache) DeleteExpired() {
+	if c == nil {
+		return
+	}
+	c.users.DeleteExpired()
+	c.permissions.DeleteExpired()
+}
+
+type AuthCacheStats struct {
+	Users       cache.Stats `json:"users"`
+	Permissions cache.Stats `json:"permissions"`
+}
+
+func (c *AuthCache) Stats() AuthCacheStats {
+	if c == nil {
+		return AuthCacheStats{}
+	}
+	return AuthCacheStats{
+		Users:       c.users.Stats(),
+		Permissions: c.permissions.Stats(),
+	}
+}
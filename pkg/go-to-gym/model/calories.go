@@ -0,0 +1,80 @@
+package model
+
+import (
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/validator"
+	"math"
+)
+
+const (
+	CaloriesEstimated = "estimated"
+	CaloriesManual    = "manual"
+)
+
+// ReferenceBodyweight is the bodyweight in kilograms used for estimates when
+// the user hasn't recorded one.
+const ReferenceBodyweight = 70.0
+
+// Calories is the energy a workout or session burns, either estimated by the
+// server or entered by the user.
+type Calories struct {
+	Value  int    `json:"value"`
+	Source string `json:"source"`
+}
+
+// Estimates use kcal = MET × bodyweight (kg) × hours, so the queries below
+// return the energy per kilogram of bodyweight, i.e. the sum of MET × hours.
+//
+// An exercise takes its duration_seconds, or for a sets × reps prescription
+// 3 seconds per rep plus 90 seconds of rest between sets.
+const workoutEnergySQL = `(
+	SELECT COALESCE(SUM(catalog_exercises.met * CASE
+	           WHEN exercises.duration_seconds > 0 THEN exercises.duration_seconds
+	           ELSE exercises.sets * exercises.reps * 3 + GREATEST(exercises.sets - 1, 0) * 90
+	       END / 3600.0), 0)
+	FROM exercises
+	INNER JOIN catalog_exercises ON catalog_exercises.id = exercises.catalog_id
+	WHERE exercises.workout_id = workouts.id)`
+
+// A finished session uses its elapsed time at the average MET of its sets, or
+// without sets, such as an imported run, of its workout's exercises. An
+// unfinished one adds up its logged sets at 3 seconds per rep plus their rest
+// (90 seconds if none was logged). Sets of deleted exercises count as MET 4.
+const sessionEnergySQL = `(
+	SELECT CASE
+	           WHEN workout_sessions.finished_at IS NOT NULL AND COUNT(session_sets.id) > 0
+	               THEN COALESCE(AVG(catalog_exercises.met), 4.0) *
+	                    EXTRACT(EPOCH FROM workout_sessions.finished_at - workout_sessions.started_at) / 3600.0
+	           WHEN workout_sessions.finished_at IS NOT NULL
+	               THEN COALESCE((SELECT AVG(workout_catalog.met)
+	                              FROM exercises AS workout_exercises
+	                              INNER JOIN catalog_exercises AS workout_catalog ON workout_catalog.id = workout_exercises.catalog_id
+	                              WHERE workout_exercises.workout_id = workout_sessions.workout_id), 0) *
+	                    EXTRACT(EPOCH FROM workout_sessions.finished_at - workout_sessions.started_at) / 3600.0
+	           ELSE COALESCE(SUM(COALESCE(catalog_exercises.met, 4.0) *
+	                             (session_sets.reps * 3 +
+	                              CASE WHEN session_sets.rest_seconds > 0 THEN session_sets.rest_seconds ELSE 90 END) /
+	                             3600.0), 0)
+	       END
+	FROM session_sets
+	LEFT JOIN exercises ON exercises.id = session_sets.exercise_id
+	LEFT JOIN catalog_exercises ON catalog_exercises.id = exercises.catalog_id
+	WHERE session_sets.session_id = workout_sessions.id)`
+
+// calories returns the manual override if there is one, or else the estimate
+// for someone weighing bodyweight kilograms.
+func calories(override *int, energyPerKg, bodyweight float64) *Calories {
+	if override != nil {
+		return &Calories{Value: *override, Source: CaloriesManual}
+	}
+	if bodyweight <= 0 {
+		bodyweight = ReferenceBodyweight
+	}
+	return &Calories{Value: int(math.Round(energyPerKg * bodyweight)), Source: CaloriesEstimated}
+}
+
+func validateCaloriesOverride(v *validator.Validator, override *int) {
+	if override != nil {
+		v.Check(*override > 0, "calories_burned", "must be greater than zero")
+		v.Check(*override <= 20_000, "calories_burned", "must not be more than 20000")
+	}
+}
@@ -0,0 +1,330 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/validator"
+	"github.com/lib/pq"
+	"time"
+)
+
+var (
+	ErrDuplicateCatalogName = errors.New("duplicate catalog name")
+	ErrCatalogEntryInUse    = errors.New("catalog entry in use")
+)
+
+var (
+	CatalogCategories = []string{"strength", "cardio", "mobility", "plyometrics", "other"}
+	MuscleGroups      = []string{
+		"chest", "back", "shoulders", "biceps", "triceps", "forearms", "core",
+		"quadriceps", "hamstrings", "glutes", "calves", "full_body",
+	}
+)
+
+type CatalogExercise struct {
+	ID               int64     `json:"id"`
+	CreatedAt        time.Time `json:"-"`
+	Name             string    `json:"name"`
+	Aliases          []string  `json:"aliases"`
+	PrimaryMuscles   []string  `json:"primary_muscles"`
+	SecondaryMuscles []string  `json:"secondary_muscles"`
+	Equipment        string    `json:"equipment,omitempty"`
+	Category         string    `json:"category"`
+	MET              float64   `json:"met"`
+	Version          int       `json:"version"`
+}
+
+func ValidateCatalogExercise(v *validator.Validator, c *CatalogExercise) {
+	v.Check(c.Name != "", "name", "must be provided")
+	v.Check(len(c.Name) <= 100, "name", "must not be more than 100 characters long")
+	v.Check(len(c.Aliases) <= 20, "aliases", "must not contain more than 20 entries")
+	v.Check(validator.Unique(c.Aliases), "aliases", "must not contain duplicate values")
+	for _, alias := range c.Aliases {
+		v.Check(alias != "" && len(alias) <= 100, "aliases", "must be between 1 and 100 characters long")
+	}
+	v.Check(len(c.PrimaryMuscles) > 0, "primary_muscles", "at least one muscle group must be provided")
+	v.Check(validator.Unique(c.PrimaryMuscles), "primary_muscles", "must not contain duplicate values")
+	for _, muscle := range c.PrimaryMuscles {
+		v.Check(validator.In(muscle, MuscleGroups...), "primary_muscles", "contains an unknown muscle group")
+	}
+	v.Check(validator.Unique(c.SecondaryMuscles), "secondary_muscles", "must not contain duplicate values")
+	for _, muscle := range c.SecondaryMuscles {
+		v.Check(validator.In(muscle, MuscleGroups...), "secondary_muscles", "contains an unknown muscle group")
+	}
+	v.Check(len(c.Equipment) <= 100, "equipment", "must not be more than 100 characters long")
+	v.Check(validator.In(c.Category, CatalogCategories...), "category", "invalid category")
+	v.Check(c.MET >= 1 && c.MET <= 25, "met", "must be between 1 and 25")
+}
+
+// CategoryMET is the MET value a new catalog entry gets when none is given.
+func CategoryMET(category string) float64 {
+	switch category {
+	case "strength":
+		return 5.0
+	case "cardio":
+		return 7.0
+	case "plyometrics":
+		return 8.0
+	case "mobility":
+		return 2.5
+	default:
+		return 4.0
+	}
+}
+
+type CatalogModel struct {
+	DB *sql.DB
+}
+
+func (m CatalogModel) Insert(entry *CatalogExercise) error {
+	query := `
+		INSERT INTO catalog_exercises (name, aliases, primary_muscles, secondary_muscles, equipment, category, met)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at, version`
+
+	args := []interface{}{
+		entry.Name,
+		pq.Array(entry.Aliases),
+		pq.Array(entry.PrimaryMuscles),
+		pq.Array(entry.SecondaryMuscles),
+		entry.Equipment,
+		entry.Category,
+		entry.MET,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&entry.ID, &entry.CreatedAt, &entry.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "catalog_exercises_name_idx"`:
+			return ErrDuplicateCatalogName
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m CatalogModel) Get(id int64) (*CatalogExercise, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, created_at, name, aliases, primary_muscles, secondary_muscles, equipment, category, met, version
+		FROM catalog_exercises
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.scanOne(m.DB.QueryRowContext(ctx, query, id))
+}
+
+// GetByName looks an entry up by its name or one of its aliases, ignoring case.
+func (m CatalogModel) GetByName(name string) (*CatalogExercise, error) {
+	query := `
+		SELECT id, created_at, name, aliases, primary_muscles, secondary_muscles, equipment, category, met, version
+		FROM catalog_exercises
+		WHERE lower(name) = lower($1)
+		OR lower($1) IN (SELECT lower(alias) FROM unnest(aliases) AS alias)
+		ORDER BY lower(name) = lower($1) DESC, id ASC
+		LIMIT 1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.scanOne(m.DB.QueryRowContext(ctx, query, name))
+}
+
+func (m CatalogModel) scanOne(row *sql.Row) (*CatalogExercise, error) {
+	var entry CatalogExercise
+
+	err := row.Scan(
+		&entry.ID,
+		&entry.CreatedAt,
+		&entry.Name,
+		pq.Array(&entry.Aliases),
+		pq.Array(&entry.PrimaryMuscles),
+		pq.Array(&entry.SecondaryMuscles),
+		&entry.Equipment,
+		&entry.Category,
+		&entry.MET,
+		&entry.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &entry, nil
+}
+
+// Update also renames the exercises rows pointing at the entry, so workouts
+// always show the catalog name, and bumps the version of the workouts renamed.
+func (m CatalogModel) Update(entry *CatalogExercise) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE catalog_exercises
+		SET name = $1, aliases = $2, primary_muscles = $3, secondary_muscles = $4, equipment = $5, category = $6,
+		    met = $7, version = version + 1
+		WHERE id = $8 AND version = $9
+		RETURNING version`
+
+	args := []interface{}{
+		entry.Name,
+		pq.Array(entry.Aliases),
+		pq.Array(entry.PrimaryMuscles),
+		pq.Array(entry.SecondaryMuscles),
+		entry.Equipment,
+		entry.Category,
+		entry.MET,
+		entry.ID,
+		entry.Version,
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&entry.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "catalog_exercises_name_idx"`:
+			return ErrDuplicateCatalogName
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	query = `
+		WITH renamed AS (
+			UPDATE exercises
+			SET name = $1
+			WHERE catalog_id = $2 AND name <> $1
+			RETURNING workout_id
+		)
+		SELECT DISTINCT workout_id
+		FROM renamed
+		WHERE workout_id IS NOT NULL`
+
+	rows, err := tx.QueryContext(ctx, query, entry.Name, entry.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var workoutIDs []int
+	for rows.Next() {
+		var id int
+		err := rows.Scan(&id)
+		if err != nil {
+			return err
+		}
+		workoutIDs = append(workoutIDs, id)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	err = touchWorkouts(ctx, tx, workoutIDs...)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m CatalogModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM catalog_exercises
+		WHERE id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code.Name() == "foreign_key_violation" {
+			return ErrCatalogEntryInUse
+		}
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (m CatalogModel) GetAll(name, muscle, equipment, category string, filters Filters) ([]*CatalogExercise, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, name, aliases, primary_muscles, secondary_muscles, equipment, category, met, version
+		FROM catalog_exercises
+		WHERE (to_tsvector('simple', name || ' ' || array_to_string(aliases, ' ')) @@ plainto_tsquery('simple', $1) OR $1 = '')
+		AND ($2 = ANY(primary_muscles) OR $2 = ANY(secondary_muscles) OR $2 = '')
+		AND (lower(equipment) = lower($3) OR $3 = '')
+		AND (category = $4 OR $4 = '')
+		ORDER BY %s %s, id ASC
+		LIMIT $5 OFFSET $6`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{name, muscle, equipment, category, filters.limit(), filters.offset()}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	var entries []*CatalogExercise
+
+	for rows.Next() {
+		var entry CatalogExercise
+
+		err := rows.Scan(
+			&totalRecords,
+			&entry.ID,
+			&entry.CreatedAt,
+			&entry.Name,
+			pq.Array(&entry.Aliases),
+			pq.Array(&entry.PrimaryMuscles),
+			pq.Array(&entry.SecondaryMuscles),
+			&entry.Equipment,
+			&entry.Category,
+			&entry.MET,
+			&entry.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		entries = append(entries, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return entries, metadata, nil
+}
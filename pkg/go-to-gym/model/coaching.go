@@ -0,0 +1,340 @@
+package model
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/validator"
+	"time"
+)
+
+const (
+	CoachingPending = "pending"
+	CoachingActive  = "active"
+)
+
+var ErrAlreadyCoached = errors.New("already coached")
+
+// CoachingLink connects a coach with a client. It is pending until the client
+// accepts the coach's invitation; only then can the coach see the client's
+// data.
+type CoachingLink struct {
+	ID         int64      `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Coach      LinkedUser `json:"coach"`
+	Client     LinkedUser `json:"client"`
+	Status     string     `json:"status"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+}
+
+type LinkedUser struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// Assignment is a workout or program a coach has given a client, which the
+// client can read even if it is private.
+type Assignment struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	LinkID    int64     `json:"link_id"`
+	CoachID   int64     `json:"coach_id"`
+	ClientID  int64     `json:"client_id"`
+	WorkoutID *int64    `json:"workout_id,omitempty"`
+	ProgramID *int64    `json:"program_id,omitempty"`
+	Notes     string    `json:"notes,omitempty"`
+}
+
+func ValidateAssignment(v *validator.Validator, a *Assignment) {
+	v.Check((a.WorkoutID == nil) != (a.ProgramID == nil), "workout_id", "exactly one of workout_id and program_id must be provided")
+	v.Check(len(a.Notes) <= 1000, "notes", "must not be more than 1000 bytes long")
+}
+
+// assignedSQL selects the workouts or programs (column is workout_id or
+// program_id) assigned to the user in $2 by a coach they have accepted.
+func assignedSQL(column string) string {
+	return `
+		SELECT coach_assignments.` + column + `
+		FROM coach_assignments
+		INNER JOIN coach_clients ON coach_clients.id = coach_assignments.link_id
+		WHERE coach_clients.client_id = $2 AND coach_clients.status = 'active'`
+}
+
+// assignedWorkoutsSQL selects the workouts assigned to the user in $2 by a
+// coach they have accepted, directly or as days of an assigned program.
+func assignedWorkoutsSQL() string {
+	return assignedSQL("workout_id") + `
+		UNION
+		SELECT program_days.workout_id
+		FROM program_days
+		WHERE program_days.program_id IN (` + assignedSQL("program_id") + `)`
+}
+
+type CoachingModel struct {
+	DB *sql.DB
+}
+
+// Invite creates a pending link for the invitation token, or points an
+// existing pending link at the new token.
+func (m CoachingModel) Invite(coachID, clientID int64, invitation *Token) (*CoachingLink, error) {
+	query := `
+		INSERT INTO coach_clients (coach_id, client_id, invitation_hash)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (coach_id, client_id) DO UPDATE
+		SET invitation_hash = EXCLUDED.invitation_hash
+		WHERE coach_clients.status = 'pending'
+		RETURNING id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int64
+	err := m.DB.QueryRowContext(ctx, query, coachID, clientID, invitation.Hash).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrAlreadyCoached
+		default:
+			return nil, err
+		}
+	}
+	return m.get(ctx, id)
+}
+
+// Accept activates the link the client was invited to with tokenPlaintext.
+func (m CoachingModel) Accept(clientID int64, tokenPlaintext string) (*CoachingLink, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+		UPDATE coach_clients
+		SET status = 'active', accepted_at = NOW(), invitation_hash = NULL
+		WHERE client_id = $1 AND invitation_hash = $2 AND status = 'pending'
+		RETURNING id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int64
+	err := m.DB.QueryRowContext(ctx, query, clientID, tokenHash[:]).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return m.get(ctx, id)
+}
+
+const linkColumns = `coach_clients.id, coach_clients.created_at, coach_clients.status, coach_clients.accepted_at,
+		       coaches.id, coaches.name, coaches.email, clients.id, clients.name, clients.email`
+
+const linkJoins = `
+		INNER JOIN users AS coaches ON coaches.id = coach_clients.coach_id
+		INNER JOIN users AS clients ON clients.id = coach_clients.client_id`
+
+func scanLink(scan func(dest ...interface{}) error) (*CoachingLink, error) {
+	var link CoachingLink
+	err := scan(
+		&link.ID,
+		&link.CreatedAt,
+		&link.Status,
+		&link.AcceptedAt,
+		&link.Coach.ID,
+		&link.Coach.Name,
+		&link.Coach.Email,
+		&link.Client.ID,
+		&link.Client.Name,
+		&link.Client.Email,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+func (m CoachingModel) get(ctx context.Context, id int64) (*CoachingLink, error) {
+	query := `
+		SELECT ` + linkColumns + `
+		FROM coach_clients` + linkJoins + `
+		WHERE coach_clients.id = $1`
+
+	link, err := scanLink(m.DB.QueryRowContext(ctx, query, id).Scan)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return link, nil
+}
+
+// GetActive returns the accepted link between a coach and a client.
+func (m CoachingModel) GetActive(coachID, clientID int64) (*CoachingLink, error) {
+	query := `
+		SELECT ` + linkColumns + `
+		FROM coach_clients` + linkJoins + `
+		WHERE coach_clients.coach_id = $1 AND coach_clients.client_id = $2 AND coach_clients.status = 'active'`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	link, err := scanLink(m.DB.QueryRowContext(ctx, query, coachID, clientID).Scan)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return link, nil
+}
+
+// GetAllForCoach returns the coach's clients, and GetAllForClient the
+// client's coaches, pending invitations included.
+func (m CoachingModel) GetAllForCoach(coachID int64) ([]*CoachingLink, error) {
+	return m.getAll(`coach_clients.coach_id = $1`, coachID)
+}
+
+func (m CoachingModel) GetAllForClient(clientID int64) ([]*CoachingLink, error) {
+	return m.getAll(`coach_clients.client_id = $1`, clientID)
+}
+
+func (m CoachingModel) getAll(where string, userID int64) ([]*CoachingLink, error) {
+	query := `
+		SELECT ` + linkColumns + `
+		FROM coach_clients` + linkJoins + `
+		WHERE ` + where + `
+		ORDER BY coach_clients.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []*CoachingLink{}
+	for rows.Next() {
+		link, err := scanLink(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+// Delete ends a link, or withdraws or declines an invitation. Either the
+// coach or the client may do it.
+func (m CoachingModel) Delete(id, userID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM coach_clients
+		WHERE id = $1 AND (coach_id = $2 OR client_id = $2)`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (m CoachingModel) InsertAssignment(assignment *Assignment) error {
+	query := `
+		INSERT INTO coach_assignments (link_id, workout_id, program_id, notes)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{assignment.LinkID, assignment.WorkoutID, assignment.ProgramID, assignment.Notes}
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&assignment.ID, &assignment.CreatedAt)
+}
+
+// GetAllAssignments returns what the client's accepted coaches have assigned
+// to them, only from coachID unless it is zero.
+func (m CoachingModel) GetAllAssignments(coachID, clientID int64) ([]*Assignment, error) {
+	query := `
+		SELECT coach_assignments.id, coach_assignments.created_at, coach_assignments.link_id,
+		       coach_clients.coach_id, coach_clients.client_id, coach_assignments.workout_id,
+		       coach_assignments.program_id, coach_assignments.notes
+		FROM coach_assignments
+		INNER JOIN coach_clients ON coach_clients.id = coach_assignments.link_id
+		WHERE coach_clients.client_id = $1
+		AND coach_clients.status = 'active'
+		AND (coach_clients.coach_id = $2 OR $2 = 0)
+		ORDER BY coach_assignments.id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, clientID, coachID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assignments := []*Assignment{}
+	for rows.Next() {
+		var a Assignment
+		err := rows.Scan(&a.ID, &a.CreatedAt, &a.LinkID, &a.CoachID, &a.ClientID, &a.WorkoutID, &a.ProgramID, &a.Notes)
+		if err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, &a)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return assignments, nil
+}
+
+// DeleteAssignment removes an assignment made by coachID.
+func (m CoachingModel) DeleteAssignment(id, coachID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM coach_assignments
+		USING coach_clients
+		WHERE coach_assignments.link_id = coach_clients.id
+		AND coach_assignments.id = $1
+		AND coach_clients.coach_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id, coachID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/validator"
+	"github.com/lib/pq"
+	"time"
+)
+
+const (
+	GroupSuperset = "superset"
+	GroupCircuit  = "circuit"
+	GroupGiantSet = "giant_set"
+)
+
+// ExerciseGroup bundles consecutive exercises of a workout that are performed
+// back to back, with RestSeconds of rest after each round.
+type ExerciseGroup struct {
+	ID          int64   `json:"id"`
+	WorkoutID   int64   `json:"workout_id"`
+	Kind        string  `json:"kind"`
+	RestSeconds int     `json:"rest_seconds"`
+	Rounds      int     `json:"rounds"`
+	ExerciseIDs []int64 `json:"exercise_ids"`
+}
+
+// ValidateExerciseOrder checks that order lists every exercise of the workout
+// exactly once and that each group is a valid run of consecutive exercises.
+func ValidateExerciseOrder(v *validator.Validator, current []int64, order []int64, groups []*ExerciseGroup) {
+	known := make(map[int64]bool, len(current))
+	for _, id := range current {
+		known[id] = true
+	}
+
+	position := make(map[int64]int, len(order))
+	for i, id := range order {
+		if !known[id] {
+			v.AddError("exercise_ids", "must only contain exercises of this workout")
+		}
+		if _, exists := position[id]; exists {
+			v.AddError("exercise_ids", "must not contain duplicate values")
+		}
+		position[id] = i
+	}
+	v.Check(len(order) == len(current), "exercise_ids", "must list every exercise of the workout")
+
+	grouped := make(map[int64]bool)
+	for _, group := range groups {
+		v.Check(validator.In(group.Kind, GroupSuperset, GroupCircuit, GroupGiantSet), "groups", "kind must be one of superset, circuit or giant_set")
+		v.Check(group.RestSeconds >= 0 && group.RestSeconds <= 3600, "groups", "rest_seconds must be between 0 and 3600")
+		v.Check(group.Rounds >= 1 && group.Rounds <= 50, "groups", "rounds must be between 1 and 50")
+
+		switch group.Kind {
+		case GroupSuperset:
+			v.Check(len(group.ExerciseIDs) == 2, "groups", "a superset must contain exactly 2 exercises")
+		case GroupGiantSet:
+			v.Check(len(group.ExerciseIDs) >= 3, "groups", "a giant set must contain at least 3 exercises")
+		default:
+			v.Check(len(group.ExerciseIDs) >= 2, "groups", "a circuit must contain at least 2 exercises")
+		}
+
+		for i, id := range group.ExerciseIDs {
+			p, ok := position[id]
+			if !ok {
+				v.AddError("groups", "must only contain exercises listed in exercise_ids")
+				continue
+			}
+			if grouped[id] {
+				v.AddError("groups", "an exercise can only belong to one group")
+			}
+			grouped[id] = true
+			if i > 0 && position[group.ExerciseIDs[i-1]] != p-1 {
+				v.AddError("groups", "must contain consecutive exercises in program order")
+			}
+		}
+	}
+}
+
+// GetExerciseGroups returns the groups of a workout with their exercises in
+// program order.
+func (m WorkoutModel) GetExerciseGroups(workoutID int64) ([]*ExerciseGroup, error) {
+	query := `
+		SELECT exercise_groups.id, exercise_groups.workout_id, exercise_groups.kind, exercise_groups.rest_seconds,
+		       exercise_groups.rounds,
+		       ARRAY(SELECT exercises.id FROM exercises WHERE exercises.group_id = exercise_groups.id ORDER BY exercises.position)
+		FROM exercise_groups
+		WHERE exercise_groups.workout_id = $1
+		ORDER BY (SELECT MIN(exercises.position) FROM exercises WHERE exercises.group_id = exercise_groups.id), exercise_groups.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, workoutID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []*ExerciseGroup{}
+
+	for rows.Next() {
+		var group ExerciseGroup
+
+		err := rows.Scan(
+			&group.ID,
+			&group.WorkoutID,
+			&group.Kind,
+			&group.RestSeconds,
+			&group.Rounds,
+			pq.Array(&group.ExerciseIDs),
+		)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, &group)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+func (m WorkoutModel) GetExerciseIDs(workoutID int64) ([]int64, error) {
+	query := `
+		SELECT ARRAY(SELECT id FROM exercises WHERE workout_id = $1 ORDER BY position, id)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var ids []int64
+	err := m.DB.QueryRowContext(ctx, query, workoutID).Scan(pq.Array(&ids))
+	return ids, err
+}
+
+// Reorder replaces the order and grouping of the workout's exercises in one
+// transaction. It bumps the workout version, so a stale version fails with
+// ErrEditConflict and leaves everything untouched.
+func (m WorkoutModel) Reorder(workout *Workout, order []int64, groups []*ExerciseGroup) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE workouts
+		SET version = version + 1
+		WHERE id = $1 AND version = $2 AND user_id = $3
+		RETURNING version`
+
+	err = tx.QueryRowContext(ctx, query, workout.ID, workout.Version, workout.UserID).Scan(&workout.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM exercise_groups WHERE workout_id = $1`, workout.ID)
+	if err != nil {
+		return err
+	}
+
+	groupOf := make(map[int64]int64)
+
+	query = `
+		INSERT INTO exercise_groups (workout_id, kind, rest_seconds, rounds)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`
+
+	for _, group := range groups {
+		group.WorkoutID = workout.ID
+		err = tx.QueryRowContext(ctx, query, group.WorkoutID, group.Kind, group.RestSeconds, group.Rounds).Scan(&group.ID)
+		if err != nil {
+			return err
+		}
+		for _, id := range group.ExerciseIDs {
+			groupOf[id] = group.ID
+		}
+	}
+
+	query = `
+		UPDATE exercises
+		SET position = $1, group_id = NULLIF($2, 0)
+		WHERE id = $3 AND workout_id = $4`
+
+	for i, id := range order {
+		_, err = tx.ExecContext(ctx, query, i+1, groupOf[id], id, workout.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	query = `
+		SELECT ARRAY(SELECT name FROM exercises WHERE workout_id = $1 ORDER BY position, id),
+		       ARRAY(SELECT catalog_id FROM exercises WHERE workout_id = $1 ORDER BY position, id)`
+
+	err = tx.QueryRowContext(ctx, query, workout.ID).Scan(pq.Array(&workout.Exercises), pq.Array(&workout.CatalogIDs))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
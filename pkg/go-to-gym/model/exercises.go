@@ -6,17 +6,46 @@ import (
 	"errors"
 	"fmt"
 	"github.com/holydanchik/GoToGym/pkg/go-to-gym/validator"
+	"github.com/lib/pq"
+	"regexp"
 	"time"
 )
 
+// TempoRX matches lifting tempos such as "3-1-1-0" or "2-0-X-1": eccentric,
+// bottom pause, concentric and top pause, where X means explosive.
+var TempoRX = regexp.MustCompile(`^([0-9]|X)-([0-9]|X)-([0-9]|X)-([0-9]|X)$`)
+
 type Exercise struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"-"`
-	Name      string    `json:"name"`
-	Sets      int       `json:"sets"`
-	Reps      int       `json:"reps"`
-	WorkoutID int       `json:"workout_id,omitempty"`
-	Version   int       `json:"version"`
+	ID           int64     `json:"id"`
+	CreatedAt    time.Time `json:"-"`
+	UserID       int64     `json:"user_id,omitempty"`
+	CatalogID    int64     `json:"catalog_id"`
+	Name         string    `json:"name"`
+	Sets         int       `json:"sets"`
+	Reps         int       `json:"reps"`
+	Weight       float64   `json:"weight,omitempty"`
+	WeightUnit   string    `json:"weight_unit,omitempty"`
+	Duration     int       `json:"duration_seconds,omitempty"`
+	Distance     float64   `json:"distance,omitempty"`
+	DistanceUnit string    `json:"distance_unit,omitempty"`
+	Tempo        string    `json:"tempo,omitempty"`
+	WorkoutID    int       `json:"workout_id,omitempty"`
+	Position     int       `json:"position"`
+	GroupID      int64     `json:"group_id,omitempty"`
+	Version      int       `json:"version"`
+}
+
+// ConvertUnits rewrites the weight and distance of the exercise into the given
+// unit system. An empty system leaves the values as they were entered.
+func (e *Exercise) ConvertUnits(system string) {
+	switch system {
+	case UnitsMetric:
+		e.Weight, e.WeightUnit = convertWeight(e.Weight, e.WeightUnit, UnitKilograms), UnitKilograms
+		e.Distance, e.DistanceUnit = convertDistance(e.Distance, e.DistanceUnit, UnitKilometers), UnitKilometers
+	case UnitsImperial:
+		e.Weight, e.WeightUnit = convertWeight(e.Weight, e.WeightUnit, UnitPounds), UnitPounds
+		e.Distance, e.DistanceUnit = convertDistance(e.Distance, e.DistanceUnit, UnitMiles), UnitMiles
+	}
 }
 
 func ValidateExercise(v *validator.Validator, e *Exercise) {
@@ -24,48 +53,112 @@ func ValidateExercise(v *validator.Validator, e *Exercise) {
 	v.Check(len(e.Name) <= 100, "name", "must not be more than 100 characters long")
 	v.Check(e.Sets >= 0, "sets", "must be a non-negative value")
 	v.Check(e.Reps >= 0, "reps", "must be a non-negative value")
+	v.Check(e.Weight >= 0, "weight", "must be a non-negative value")
+	v.Check(e.Weight <= 10_000, "weight", "must not be more than 10000")
+	v.Check(validator.In(e.WeightUnit, UnitKilograms, UnitPounds), "weight_unit", "must be either kg or lb")
+	v.Check(e.Duration >= 0, "duration_seconds", "must be a non-negative value")
+	v.Check(e.Duration <= 24*60*60, "duration_seconds", "must not be more than 24 hours")
+	v.Check(e.Distance >= 0, "distance", "must be a non-negative value")
+	v.Check(e.Distance <= 1000, "distance", "must not be more than 1000")
+	v.Check(validator.In(e.DistanceUnit, UnitKilometers, UnitMiles), "distance_unit", "must be either km or mi")
+	v.Check(e.Tempo == "" || validator.Matches(e.Tempo, TempoRX), "tempo", "must be four phases like 3-1-1-0, using X for explosive")
 }
 
 type ExerciseModel struct {
 	DB *sql.DB
 }
 
+// Insert appends the exercise to its workout and bumps the workout version in
+// the same transaction.
 func (m ExerciseModel) Insert(exercise *Exercise) error {
-	query := `
-		INSERT INTO exercises (name, sets, reps, workout_id)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, created_at, version`
-
-	args := []interface{}{exercise.Name, exercise.Sets, exercise.Reps, exercise.WorkoutID}
-
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&exercise.ID, &exercise.CreatedAt, &exercise.Version)
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertExercise(ctx, tx, exercise)
+	if err != nil {
+		return err
+	}
+
+	err = touchWorkouts(ctx, tx, exercise.WorkoutID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertExercise appends an exercise to its workout.
+func insertExercise(ctx context.Context, q Querier, exercise *Exercise) error {
+	query := `
+		INSERT INTO exercises (user_id, catalog_id, name, sets, reps, weight, weight_unit, duration_seconds, distance, distance_unit, tempo, workout_id, position)
+		VALUES (NULLIF($1, 0), $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12,
+		        (SELECT COALESCE(MAX(position), 0) + 1 FROM exercises WHERE workout_id = $12))
+		RETURNING id, created_at, position, version`
+
+	args := []interface{}{
+		exercise.UserID,
+		exercise.CatalogID,
+		exercise.Name,
+		exercise.Sets,
+		exercise.Reps,
+		exercise.Weight,
+		exercise.WeightUnit,
+		exercise.Duration,
+		exercise.Distance,
+		exercise.DistanceUnit,
+		exercise.Tempo,
+		exercise.WorkoutID,
+	}
+
+	return q.QueryRowContext(ctx, query, args...).Scan(&exercise.ID, &exercise.CreatedAt, &exercise.Position, &exercise.Version)
 }
 
-func (m ExerciseModel) Get(id int64) (*Exercise, error) {
+// Get returns the exercise if the user owns it, or its workout is shared,
+// public or assigned to the user by their coach.
+func (m ExerciseModel) Get(id int64, userID int64) (*Exercise, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 
 	query := `
-		SELECT id, created_at, name, sets, reps, workout_id, version
+		SELECT exercises.id, exercises.created_at, COALESCE(exercises.user_id, 0), exercises.catalog_id, exercises.name,
+		       exercises.sets, exercises.reps, exercises.weight, exercises.weight_unit, exercises.duration_seconds,
+		       exercises.distance, exercises.distance_unit, exercises.tempo, exercises.workout_id, exercises.position,
+		       COALESCE(exercises.group_id, 0), exercises.version
 		FROM exercises
-		WHERE id = $1`
+		LEFT JOIN workouts ON workouts.id = exercises.workout_id
+		WHERE exercises.id = $1
+		AND (exercises.user_id = $2 OR workouts.visibility IN ('shared', 'public')
+		     OR workouts.id IN (` + assignedWorkoutsSQL() + `))`
 
 	var exercise Exercise
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(
 		&exercise.ID,
 		&exercise.CreatedAt,
+		&exercise.UserID,
+		&exercise.CatalogID,
 		&exercise.Name,
 		&exercise.Sets,
 		&exercise.Reps,
+		&exercise.Weight,
+		&exercise.WeightUnit,
+		&exercise.Duration,
+		&exercise.Distance,
+		&exercise.DistanceUnit,
+		&exercise.Tempo,
 		&exercise.WorkoutID,
+		&exercise.Position,
+		&exercise.GroupID,
 		&exercise.Version,
 	)
 
@@ -81,26 +174,72 @@ func (m ExerciseModel) Get(id int64) (*Exercise, error) {
 	return &exercise, nil
 }
 
+// Update saves the exercise and bumps the version of its workout in the same
+// transaction. Moving it to another workout takes it out of its group and bumps
+// the version of the workout it left as well.
 func (m ExerciseModel) Update(exercise *Exercise) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var previousWorkoutID int
+	err = tx.QueryRowContext(ctx, `SELECT workout_id FROM exercises WHERE id = $1`, exercise.ID).Scan(&previousWorkoutID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	err = updateExercise(ctx, tx, exercise)
+	if err != nil {
+		return err
+	}
+
+	err = touchWorkouts(ctx, tx, previousWorkoutID, exercise.WorkoutID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// updateExercise saves the exercise. An exercise moved to another workout
+// leaves its group, since groups never span workouts.
+func updateExercise(ctx context.Context, q Querier, exercise *Exercise) error {
 	query := `
 		UPDATE exercises
-		SET name = $1, sets = $2, reps = $3, workout_id = $4, version = version + 1
-		WHERE id = $5 and version = $6
-		RETURNING version`
+		SET name = $1, sets = $2, reps = $3, weight = $4, weight_unit = $5, duration_seconds = $6,
+		    distance = $7, distance_unit = $8, tempo = $9, workout_id = $10, catalog_id = $11,
+		    group_id = CASE WHEN workout_id = $10 THEN group_id END, version = version + 1
+		WHERE id = $12 and version = $13 AND user_id = $14
+		RETURNING COALESCE(group_id, 0), version`
 
 	args := []interface{}{
 		exercise.Name,
 		exercise.Sets,
 		exercise.Reps,
+		exercise.Weight,
+		exercise.WeightUnit,
+		exercise.Duration,
+		exercise.Distance,
+		exercise.DistanceUnit,
+		exercise.Tempo,
 		exercise.WorkoutID,
+		exercise.CatalogID,
 		exercise.ID,
 		exercise.Version,
+		exercise.UserID,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&exercise.Version)
+	err := q.QueryRowContext(ctx, query, args...).Scan(&exercise.GroupID, &exercise.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -113,50 +252,105 @@ func (m ExerciseModel) Update(exercise *Exercise) error {
 	return nil
 }
 
-func (m ExerciseModel) Delete(id int64) error {
+// Delete removes the exercise and bumps the version of its workout in the same
+// transaction.
+func (m ExerciseModel) Delete(id int64, userID int64) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
 	query := `
 		DELETE FROM exercises
-		WHERE id = $1`
+		WHERE id = $1 AND user_id = $2
+		RETURNING workout_id`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, id)
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	rowsAffected, err := result.RowsAffected()
+	var workoutID int
+	err = tx.QueryRowContext(ctx, query, id, userID).Scan(&workoutID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	err = touchWorkouts(ctx, tx, workoutID)
 	if err != nil {
 		return err
 	}
 
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
+	return tx.Commit()
+}
+
+// touchWorkout is touchWorkouts for a single workout, reading back its new
+// version.
+func touchWorkout(ctx context.Context, q Querier, workout *Workout) error {
+	err := touchWorkouts(ctx, q, int(workout.ID))
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return q.QueryRowContext(ctx, `SELECT version FROM workouts WHERE id = $1`, workout.ID).Scan(&workout.Version)
 }
 
-func (m ExerciseModel) GetAll(name string, paramWorkoutID int, from, to int, filters Filters) ([]*Exercise, Metadata, error) {
+// touchWorkouts bumps the version of workouts whose exercises changed and
+// dissolves any of their groups left with too few exercises for their kind.
+func touchWorkouts(ctx context.Context, q Querier, workoutIDs ...int) error {
+	ids := make([]int64, len(workoutIDs))
+	for i, id := range workoutIDs {
+		ids[i] = int64(id)
+	}
+
+	_, err := q.ExecContext(ctx, `UPDATE workouts SET version = version + 1 WHERE id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	query := `
+		DELETE FROM exercise_groups
+		WHERE workout_id = ANY($1)
+		AND (SELECT count(*) FROM exercises WHERE exercises.group_id = exercise_groups.id)
+		    < CASE kind WHEN 'giant_set' THEN 3 ELSE 2 END`
+
+	_, err = q.ExecContext(ctx, query, pq.Array(ids))
+	return err
+}
+
+// GetAll lists the exercises of a workout. The weight and distance bounds are
+// given in kilograms and kilometres and compared against the values converted
+// from their stored units.
+func (m ExerciseModel) GetAll(name string, paramWorkoutID int, from, to int, weightFrom, weightTo float64, durationFrom, durationTo int, distanceFrom, distanceTo float64, filters Filters) ([]*Exercise, Metadata, error) {
 	query := fmt.Sprintf(`
-		SELECT count(*) OVER(), id, created_at, name, sets, reps, workout_id, version
+		SELECT count(*) OVER(), id, created_at, COALESCE(user_id, 0), catalog_id, name, sets, reps, weight, weight_unit,
+		       duration_seconds, distance, distance_unit, tempo, workout_id, position, COALESCE(group_id, 0), version
 		FROM exercises
 		WHERE (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '')
 		AND workout_id = $2
 		AND (sets >= $3 OR $3 = 0)
 		AND (sets <= $4 OR $4 = 0)
-		ORDER BY %s %s, id ASC
-		LIMIT $5 OFFSET $6`, filters.sortColumn(), filters.sortDirection())
+		AND (CASE weight_unit WHEN 'lb' THEN weight * %[3]f ELSE weight END >= $5 OR $5 = 0)
+		AND (CASE weight_unit WHEN 'lb' THEN weight * %[3]f ELSE weight END <= $6 OR $6 = 0)
+		AND (duration_seconds >= $7 OR $7 = 0)
+		AND (duration_seconds <= $8 OR $8 = 0)
+		AND (CASE distance_unit WHEN 'mi' THEN distance * %[4]f ELSE distance END >= $9 OR $9 = 0)
+		AND (CASE distance_unit WHEN 'mi' THEN distance * %[4]f ELSE distance END <= $10 OR $10 = 0)
+		ORDER BY %[1]s %[2]s, id ASC
+		LIMIT $11 OFFSET $12`, filters.sortColumn(), filters.sortDirection(), kilogramsPerPound, kilometersPerMile)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []interface{}{name, paramWorkoutID, from, to, filters.limit(), filters.offset()}
+	args := []interface{}{name, paramWorkoutID, from, to, weightFrom, weightTo, durationFrom, durationTo, distanceFrom, distanceTo, filters.limit(), filters.offset()}
 
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -174,10 +368,20 @@ func (m ExerciseModel) GetAll(name string, paramWorkoutID int, from, to int, fil
 			&totalRecords,
 			&exercise.ID,
 			&exercise.CreatedAt,
+			&exercise.UserID,
+			&exercise.CatalogID,
 			&exercise.Name,
 			&exercise.Sets,
 			&exercise.Reps,
+			&exercise.Weight,
+			&exercise.WeightUnit,
+			&exercise.Duration,
+			&exercise.Distance,
+			&exercise.DistanceUnit,
+			&exercise.Tempo,
 			&exercise.WorkoutID,
+			&exercise.Position,
+			&exercise.GroupID,
 			&exercise.Version,
 		)
 		if err != nil {
@@ -193,3 +397,57 @@ func (m ExerciseModel) GetAll(name string, paramWorkoutID int, from, to int, fil
 	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
 	return exercises, metadata, nil
 }
+
+// GetAllForWorkout returns every exercise of a workout in program order.
+func (m ExerciseModel) GetAllForWorkout(workoutID int64) ([]*Exercise, error) {
+	query := `
+		SELECT id, created_at, COALESCE(user_id, 0), catalog_id, name, sets, reps, weight, weight_unit,
+		       duration_seconds, distance, distance_unit, tempo, workout_id, position, COALESCE(group_id, 0), version
+		FROM exercises
+		WHERE workout_id = $1
+		ORDER BY position, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, workoutID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exercises := []*Exercise{}
+
+	for rows.Next() {
+		var exercise Exercise
+
+		err := rows.Scan(
+			&exercise.ID,
+			&exercise.CreatedAt,
+			&exercise.UserID,
+			&exercise.CatalogID,
+			&exercise.Name,
+			&exercise.Sets,
+			&exercise.Reps,
+			&exercise.Weight,
+			&exercise.WeightUnit,
+			&exercise.Duration,
+			&exercise.Distance,
+			&exercise.DistanceUnit,
+			&exercise.Tempo,
+			&exercise.WorkoutID,
+			&exercise.Position,
+			&exercise.GroupID,
+			&exercise.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		exercises = append(exercises, &exercise)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return exercises, nil
+}
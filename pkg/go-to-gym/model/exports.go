@@ -0,0 +1,173 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+// DataExport is an archive of everything stored about a user, built in the
+// background. The archive itself is only loaded by GetArchive.
+type DataExport struct {
+	ID         int64      `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UserID     int64      `json:"-"`
+	Status     string     `json:"status"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Expiry     *time.Time `json:"expiry,omitempty"`
+	Size       int64      `json:"size,omitempty"`
+}
+
+type ExportModel struct {
+	DB *sql.DB
+}
+
+func (m ExportModel) Insert(export *DataExport) error {
+	query := `
+		INSERT INTO data_exports (user_id)
+		VALUES ($1)
+		RETURNING id, created_at, status`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, export.UserID).Scan(&export.ID, &export.CreatedAt, &export.Status)
+}
+
+func (m ExportModel) Get(id, userID int64) (*DataExport, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, created_at, user_id, status, finished_at, expiry, size
+		FROM data_exports
+		WHERE id = $1 AND user_id = $2
+		AND (expiry IS NULL OR expiry > NOW())`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var export DataExport
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(
+		&export.ID,
+		&export.CreatedAt,
+		&export.UserID,
+		&export.Status,
+		&export.FinishedAt,
+		&export.Expiry,
+		&export.Size,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &export, nil
+}
+
+// GetPending returns the user's export that is still being built, if any.
+func (m ExportModel) GetPending(userID int64) (*DataExport, error) {
+	query := `
+		SELECT id
+		FROM data_exports
+		WHERE user_id = $1 AND status = 'pending'
+		ORDER BY id DESC
+		LIMIT 1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int64
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return m.Get(id, userID)
+}
+
+// GetArchive returns the ZIP archive of a ready export that hasn't expired.
+func (m ExportModel) GetArchive(id, userID int64) ([]byte, error) {
+	query := `
+		SELECT archive
+		FROM data_exports
+		WHERE id = $1 AND user_id = $2 AND status = 'ready' AND expiry > NOW()`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var archive []byte
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(&archive)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return archive, nil
+}
+
+// Finish stores the archive of an export, which can then be downloaded until
+// ttl has passed.
+func (m ExportModel) Finish(export *DataExport, archive []byte, ttl time.Duration) error {
+	query := `
+		UPDATE data_exports
+		SET status = 'ready', finished_at = NOW(), expiry = NOW() + $2 * interval '1 second',
+		    size = $3, archive = $4
+		WHERE id = $1
+		RETURNING status, finished_at, expiry, size`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	args := []interface{}{export.ID, ttl.Seconds(), len(archive), archive}
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&export.Status, &export.FinishedAt, &export.Expiry, &export.Size)
+}
+
+func (m ExportModel) Fail(export *DataExport) error {
+	query := `
+		UPDATE data_exports
+		SET status = 'failed', finished_at = NOW()
+		WHERE id = $1
+		RETURNING status, finished_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, export.ID).Scan(&export.Status, &export.FinishedAt)
+}
+
+// DeleteExpired deletes exports past their expiry, and those still pending
+// after an hour, which were lost when a server stopped.
+func (m ExportModel) DeleteExpired() (int64, error) {
+	query := `
+		DELETE FROM data_exports
+		WHERE expiry < NOW()
+		OR (status = 'pending' AND created_at < NOW() - INTERVAL '1 hour')
+		OR (status = 'failed' AND finished_at < NOW() - INTERVAL '1 day')`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -11,7 +11,14 @@ func PopulateDatabase(models model.Models) error {
 	}
 
 	for _, exercise := range exercises {
-		err := models.Exercises.Insert(&exercise)
+		entry, err := models.Catalog.GetByName(exercise.Name)
+		if err != nil {
+			return err
+		}
+		exercise.CatalogID = entry.ID
+		exercise.WeightUnit = model.UnitKilograms
+		exercise.DistanceUnit = model.UnitKilometers
+		err = models.Exercises.Insert(&exercise)
 		if err != nil {
 			return err
 		}
@@ -20,31 +27,31 @@ func PopulateDatabase(models model.Models) error {
 }
 
 var workouts = []model.Workout{
-	{Name: "Legs", Description: "Legs + Arms program", Exercises: []string{"Squats", "Lunges", "Leg Press", "Bicep Curls", "Dips", "Shoulder Press"}, CaloriesBurned: 520},
-	{Name: "Chest", Description: "Chest + Core program", Exercises: []string{"Bench Press", "Push-ups", "Dumbbell Flyes", "Planks", "Russian Twists", "Leg Raises"}, CaloriesBurned: 400},
-	{Name: "Back", Description: "Back Day program", Exercises: []string{"Deadlifts", "Pull-ups", "Rows"}, CaloriesBurned: 250},
-	{Name: "Cardio", Description: "Cardio Workout program", Exercises: []string{"Running", "Cycling", "Jumping Jacks"}, CaloriesBurned: 300},
-	{Name: "Full Body", Description: "Full Body Workout program", Exercises: []string{"Squats", "Push-ups", "Pull-ups", "Planks"}, CaloriesBurned: 350},
+	{Name: "Legs", Description: "Legs + Arms program", Visibility: model.VisibilityPublic},
+	{Name: "Chest", Description: "Chest + Core program", Visibility: model.VisibilityPublic},
+	{Name: "Back", Description: "Back Day program", Visibility: model.VisibilityPublic},
+	{Name: "Cardio", Description: "Cardio Workout program", Visibility: model.VisibilityPublic},
+	{Name: "Full Body", Description: "Full Body Workout program", Visibility: model.VisibilityPublic},
 }
 
 var exercises = []model.Exercise{
-	{Name: "Squats", Sets: 3, Reps: 5, WorkoutID: 1},
+	{Name: "Squats", Sets: 3, Reps: 5, Weight: 80, WorkoutID: 1},
 	{Name: "Lunges", Sets: 2, Reps: 12, WorkoutID: 1},
 	{Name: "Leg Press", Sets: 4, Reps: 12, WorkoutID: 1},
 	{Name: "Bicep Curls", Sets: 3, Reps: 12, WorkoutID: 1},
 	{Name: "Dips", Sets: 3, Reps: 10, WorkoutID: 1},
 	{Name: "Shoulder Press", Sets: 2, Reps: 20, WorkoutID: 1},
-	{Name: "Bench Press", Sets: 4, Reps: 8, WorkoutID: 2},
+	{Name: "Bench Press", Sets: 4, Reps: 8, Weight: 60, Tempo: "3-1-1-0", WorkoutID: 2},
 	{Name: "Push-ups", Sets: 3, Reps: 15, WorkoutID: 2},
 	{Name: "Dumbbell Flyes", Sets: 3, Reps: 12, WorkoutID: 2},
 	{Name: "Planks", Sets: 3, Reps: 60, WorkoutID: 2},
 	{Name: "Russian Twists", Sets: 3, Reps: 20, WorkoutID: 2},
 	{Name: "Leg Raises", Sets: 3, Reps: 15, WorkoutID: 2},
-	{Name: "Deadlifts", Sets: 4, Reps: 6, WorkoutID: 3},
+	{Name: "Deadlifts", Sets: 4, Reps: 6, Weight: 100, WorkoutID: 3},
 	{Name: "Pull-ups", Sets: 3, Reps: 10, WorkoutID: 3},
 	{Name: "Rows", Sets: 3, Reps: 12, WorkoutID: 3},
-	{Name: "Running", Sets: 1, Reps: 30, WorkoutID: 4},
-	{Name: "Cycling", Sets: 1, Reps: 30, WorkoutID: 4},
+	{Name: "Running", Sets: 1, Duration: 30 * 60, Distance: 5, WorkoutID: 4},
+	{Name: "Cycling", Sets: 1, Duration: 30 * 60, Distance: 12, WorkoutID: 4},
 	{Name: "Jumping Jacks", Sets: 1, Reps: 60, WorkoutID: 4},
 	{Name: "Squats", Sets: 3, Reps: 10, WorkoutID: 5},
 	{Name: "Push-ups", Sets: 3, Reps: 20, WorkoutID: 5},
@@ -0,0 +1,141 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// LoginFailure counts the failed logins for an email address since the last
+// successful one.
+type LoginFailure struct {
+	Email        string
+	Failures     int
+	LastFailedAt time.Time
+	LockedUntil  *time.Time
+}
+
+// Locked reports whether logins are refused at t.
+func (f *LoginFailure) Locked(t time.Time) bool {
+	return f.LockedUntil != nil && t.Before(*f.LockedUntil)
+}
+
+// LockoutPolicy allows Attempts failed logins, then locks the account for
+// Base, doubling with every further failure up to Max.
+type LockoutPolicy struct {
+	Attempts int
+	Base     time.Duration
+	Max      time.Duration
+}
+
+// Duration returns how long to lock an account after its nth failed login.
+func (p LockoutPolicy) Duration(failures int) time.Duration {
+	if p.Attempts < 1 || failures < p.Attempts {
+		return 0
+	}
+	d := p.Base
+	for i := p.Attempts; i < failures && d < p.Max; i++ {
+		d *= 2
+	}
+	return min(d, p.Max)
+}
+
+type LoginFailureModel struct {
+	DB *sql.DB
+}
+
+func (m LoginFailureModel) Get(email string) (*LoginFailure, error) {
+	query := `
+		SELECT email, failures, last_failed_at, locked_until
+		FROM login_failures
+		WHERE email = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var failure LoginFailure
+	err := m.DB.QueryRowContext(ctx, query, email).Scan(
+		&failure.Email,
+		&failure.Failures,
+		&failure.LastFailedAt,
+		&failure.LockedUntil,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &failure, nil
+}
+
+// Record counts a failed login for email and locks it as the policy says.
+func (m LoginFailureModel) Record(email string, policy LockoutPolicy) (*LoginFailure, error) {
+	query := `
+		INSERT INTO login_failures (email, failures)
+		VALUES ($1, 1)
+		ON CONFLICT (email) DO UPDATE
+		SET failures = login_failures.failures + 1, last_failed_at = NOW()
+		RETURNING failures, last_failed_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	failure := LoginFailure{Email: email}
+	err := m.DB.QueryRowContext(ctx, query, email).Scan(&failure.Failures, &failure.LastFailedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	d := policy.Duration(failure.Failures)
+	if d == 0 {
+		return &failure, nil
+	}
+
+	query = `
+		UPDATE login_failures
+		SET locked_until = NOW() + $2 * interval '1 second'
+		WHERE email = $1
+		RETURNING locked_until`
+
+	err = m.DB.QueryRowContext(ctx, query, email, d.Seconds()).Scan(&failure.LockedUntil)
+	if err != nil {
+		return nil, err
+	}
+	return &failure, nil
+}
+
+// Delete forgets the failed logins for email, after a successful login or
+// when the user unlocks their account.
+func (m LoginFailureModel) Delete(email string) error {
+	query := `
+		DELETE FROM login_failures
+		WHERE email = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, email)
+	return err
+}
+
+// DeleteStale forgets failures older than maxAge that no longer lock their
+// address, and returns how many addresses it forgot.
+func (m LoginFailureModel) DeleteStale(maxAge time.Duration) (int64, error) {
+	query := `
+		DELETE FROM login_failures
+		WHERE last_failed_at < NOW() - $1 * interval '1 second'
+		AND (locked_until IS NULL OR locked_until < NOW())`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, maxAge.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
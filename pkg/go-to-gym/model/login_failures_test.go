@@ -0,0 +1,35 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutPolicyDuration(t *testing.T) {
+	policy := LockoutPolicy{Attempts: 5, Base: time.Minute, Max: 15 * time.Minute}
+
+	tests := []struct {
+		name     string
+		policy   LockoutPolicy
+		failures int
+		want     time.Duration
+	}{
+		{"no failures", policy, 0, 0},
+		{"below the attempts", policy, 4, 0},
+		{"at the attempts", policy, 5, time.Minute},
+		{"one more", policy, 6, 2 * time.Minute},
+		{"doubling", policy, 8, 8 * time.Minute},
+		{"capped", policy, 9, 15 * time.Minute},
+		{"far beyond the cap", policy, 1000, 15 * time.Minute},
+		{"base above the cap", LockoutPolicy{Attempts: 1, Base: time.Hour, Max: time.Minute}, 1, time.Minute},
+		{"disabled", LockoutPolicy{Attempts: 0, Base: time.Minute, Max: time.Hour}, 100, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Duration(tt.failures); got != tt.want {
+				t.Errorf("Duration(%d) = %v; want %v", tt.failures, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,431 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/validator"
+	"time"
+)
+
+const (
+	MeasurementBodyweight = "bodyweight"
+	MeasurementBodyFat    = "body_fat"
+)
+
+// MeasurementKinds lists everything that can be measured. Apart from
+// bodyweight and body fat these are circumferences.
+var MeasurementKinds = []string{
+	MeasurementBodyweight, MeasurementBodyFat,
+	"neck", "shoulders", "chest", "waist", "hips", "biceps", "forearm", "thigh", "calf",
+}
+
+type Measurement struct {
+	ID         int64     `json:"id"`
+	CreatedAt  time.Time `json:"-"`
+	UserID     int64     `json:"-"`
+	MeasuredAt time.Time `json:"measured_at"`
+	Kind       string    `json:"kind"`
+	Value      float64   `json:"value"`
+	Unit       string    `json:"unit"`
+	Notes      string    `json:"notes,omitempty"`
+	Version    int       `json:"version"`
+}
+
+// MeasurementUnit returns the unit a kind of measurement is reported in for
+// the unit system.
+func MeasurementUnit(kind, system string) string {
+	switch {
+	case kind == MeasurementBodyFat:
+		return UnitPercent
+	case kind == MeasurementBodyweight && system == UnitsImperial:
+		return UnitPounds
+	case kind == MeasurementBodyweight:
+		return UnitKilograms
+	case system == UnitsImperial:
+		return UnitInches
+	default:
+		return UnitCentimeters
+	}
+}
+
+// ConvertUnits rewrites the value into the given unit system. An empty system
+// leaves it as it was entered.
+func (m *Measurement) ConvertUnits(system string) {
+	if system == "" {
+		return
+	}
+	unit := MeasurementUnit(m.Kind, system)
+	switch m.Kind {
+	case MeasurementBodyweight:
+		m.Value = convertWeight(m.Value, m.Unit, unit)
+	case MeasurementBodyFat:
+	default:
+		m.Value = convertLength(m.Value, m.Unit, unit)
+	}
+	m.Unit = unit
+}
+
+func ValidateMeasurement(v *validator.Validator, m *Measurement) {
+	v.Check(validator.In(m.Kind, MeasurementKinds...), "kind", "invalid measurement kind")
+	v.Check(!m.MeasuredAt.IsZero(), "measured_at", "must be provided")
+	v.Check(m.MeasuredAt.Before(time.Now().Add(time.Hour)), "measured_at", "must not be in the future")
+	v.Check(m.Value > 0, "value", "must be greater than zero")
+	v.Check(len(m.Notes) <= 1000, "notes", "must not be more than 1000 bytes long")
+
+	switch m.Kind {
+	case MeasurementBodyweight:
+		v.Check(validator.In(m.Unit, UnitKilograms, UnitPounds), "unit", "must be either kg or lb")
+		v.Check(convertWeight(m.Value, m.Unit, UnitKilograms) <= 500, "value", "must not be more than 500 kg")
+	case MeasurementBodyFat:
+		v.Check(m.Unit == UnitPercent, "unit", "must be %")
+		v.Check(m.Value < 100, "value", "must be less than 100")
+	default:
+		v.Check(validator.In(m.Unit, UnitCentimeters, UnitInches), "unit", "must be either cm or in")
+		v.Check(convertLength(m.Value, m.Unit, UnitCentimeters) <= 300, "value", "must not be more than 300 cm")
+	}
+}
+
+type TrendPoint struct {
+	Date          string  `json:"date"`
+	Value         float64 `json:"value"`
+	MovingAverage float64 `json:"moving_average"`
+}
+
+type MeasurementTrend struct {
+	Kind       string        `json:"kind"`
+	Unit       string        `json:"unit"`
+	Window     int           `json:"window_days"`
+	Points     []*TrendPoint `json:"points"`
+	WeeklyRate *float64      `json:"weekly_rate"`
+}
+
+// Trend summarises measurements of one kind, ordered by time, as one point per
+// day (the mean of that day's values) with a trailing moving average over
+// window days. Days before since only feed the moving average. WeeklyRate is
+// the least-squares slope of the moving average, per week; it is nil with
+// fewer than two days of data.
+func Trend(measurements []*Measurement, kind string, since time.Time, window int, system string) *MeasurementTrend {
+	if system == "" {
+		system = UnitsMetric
+	}
+
+	trend := &MeasurementTrend{
+		Kind:   kind,
+		Unit:   MeasurementUnit(kind, system),
+		Window: window,
+		Points: []*TrendPoint{},
+	}
+
+	var days []time.Time
+	sums := make(map[time.Time]float64)
+	counts := make(map[time.Time]int)
+
+	for _, m := range measurements {
+		m.ConvertUnits(system)
+		day := m.MeasuredAt.UTC().Truncate(24 * time.Hour)
+		if counts[day] == 0 {
+			days = append(days, day)
+		}
+		sums[day] += m.Value
+		counts[day]++
+	}
+
+	var xs, ys []float64
+
+	for i, day := range days {
+		value := sums[day] / float64(counts[day])
+
+		var total float64
+		var n int
+		for j := i; j >= 0 && days[j].After(day.AddDate(0, 0, -window)); j-- {
+			total += sums[days[j]] / float64(counts[days[j]])
+			n++
+		}
+		average := total / float64(n)
+
+		if day.Before(since) {
+			continue
+		}
+
+		trend.Points = append(trend.Points, &TrendPoint{
+			Date:          day.Format("2006-01-02"),
+			Value:         round2(value),
+			MovingAverage: round2(average),
+		})
+
+		xs = append(xs, day.Sub(since).Hours()/24)
+		ys = append(ys, average)
+	}
+
+	if len(xs) >= 2 {
+		rate := round2(slope(xs, ys) * 7)
+		trend.WeeklyRate = &rate
+	}
+	return trend
+}
+
+func slope(xs, ys []float64) float64 {
+	var meanX, meanY float64
+	for i := range xs {
+		meanX += xs[i]
+		meanY += ys[i]
+	}
+	meanX /= float64(len(xs))
+	meanY /= float64(len(ys))
+
+	var num, den float64
+	for i := range xs {
+		num += (xs[i] - meanX) * (ys[i] - meanY)
+		den += (xs[i] - meanX) * (xs[i] - meanX)
+	}
+	if den == 0 {
+		return 0
+	}
+	return num / den
+}
+
+type MeasurementModel struct {
+	DB *sql.DB
+}
+
+func (m MeasurementModel) Insert(measurement *Measurement) error {
+	query := `
+		INSERT INTO measurements (user_id, measured_at, kind, value, unit, notes)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at, version`
+
+	args := []interface{}{
+		measurement.UserID,
+		measurement.MeasuredAt,
+		measurement.Kind,
+		measurement.Value,
+		measurement.Unit,
+		measurement.Notes,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&measurement.ID, &measurement.CreatedAt, &measurement.Version)
+}
+
+func (m MeasurementModel) Get(id int64, userID int64) (*Measurement, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, created_at, user_id, measured_at, kind, value, unit, notes, version
+		FROM measurements
+		WHERE id = $1 AND user_id = $2`
+
+	var measurement Measurement
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(
+		&measurement.ID,
+		&measurement.CreatedAt,
+		&measurement.UserID,
+		&measurement.MeasuredAt,
+		&measurement.Kind,
+		&measurement.Value,
+		&measurement.Unit,
+		&measurement.Notes,
+		&measurement.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &measurement, nil
+}
+
+func (m MeasurementModel) Update(measurement *Measurement) error {
+	query := `
+		UPDATE measurements
+		SET measured_at = $1, kind = $2, value = $3, unit = $4, notes = $5, version = version + 1
+		WHERE id = $6 AND version = $7 AND user_id = $8
+		RETURNING version`
+
+	args := []interface{}{
+		measurement.MeasuredAt,
+		measurement.Kind,
+		measurement.Value,
+		measurement.Unit,
+		measurement.Notes,
+		measurement.ID,
+		measurement.Version,
+		measurement.UserID,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&measurement.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m MeasurementModel) Delete(id int64, userID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM measurements
+		WHERE id = $1 AND user_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (m MeasurementModel) GetAll(userID int64, kind string, from, to *time.Time, filters Filters) ([]*Measurement, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, user_id, measured_at, kind, value, unit, notes, version
+		FROM measurements
+		WHERE user_id = $1
+		AND (kind = $2 OR $2 = '')
+		AND ($3::timestamptz IS NULL OR measured_at >= $3)
+		AND ($4::timestamptz IS NULL OR measured_at < $4)
+		ORDER BY %s %s, id ASC
+		LIMIT $5 OFFSET $6`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{userID, kind, from, to, filters.limit(), filters.offset()}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	var measurements []*Measurement
+
+	for rows.Next() {
+		var measurement Measurement
+
+		err := rows.Scan(
+			&totalRecords,
+			&measurement.ID,
+			&measurement.CreatedAt,
+			&measurement.UserID,
+			&measurement.MeasuredAt,
+			&measurement.Kind,
+			&measurement.Value,
+			&measurement.Unit,
+			&measurement.Notes,
+			&measurement.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		measurements = append(measurements, &measurement)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return measurements, metadata, nil
+}
+
+// GetSeries returns every measurement of a kind in [from, to), oldest first.
+func (m MeasurementModel) GetSeries(userID int64, kind string, from, to time.Time) ([]*Measurement, error) {
+	query := `
+		SELECT id, created_at, user_id, measured_at, kind, value, unit, notes, version
+		FROM measurements
+		WHERE user_id = $1 AND kind = $2 AND measured_at >= $3 AND measured_at < $4
+		ORDER BY measured_at, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, kind, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var measurements []*Measurement
+
+	for rows.Next() {
+		var measurement Measurement
+
+		err := rows.Scan(
+			&measurement.ID,
+			&measurement.CreatedAt,
+			&measurement.UserID,
+			&measurement.MeasuredAt,
+			&measurement.Kind,
+			&measurement.Value,
+			&measurement.Unit,
+			&measurement.Notes,
+			&measurement.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		measurements = append(measurements, &measurement)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return measurements, nil
+}
+
+// LatestBodyweight returns the user's most recent bodyweight in kilograms, or
+// 0 if they never recorded one.
+func (m MeasurementModel) LatestBodyweight(userID int64) (float64, error) {
+	query := `
+		SELECT value, unit
+		FROM measurements
+		WHERE user_id = $1 AND kind = 'bodyweight'
+		ORDER BY measured_at DESC, id DESC
+		LIMIT 1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var value float64
+	var unit string
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&value, &unit)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, nil
+		default:
+			return 0, err
+		}
+	}
+	return convertWeight(value, unit, UnitKilograms), nil
+}
@@ -0,0 +1,129 @@
+package model
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSlope(t *testing.T) {
+	tests := []struct {
+		name   string
+		xs, ys []float64
+		want   float64
+	}{
+		{"flat", []float64{0, 1, 2}, []float64{5, 5, 5}, 0},
+		{"rising", []float64{0, 1, 2, 3}, []float64{1, 3, 5, 7}, 2},
+		{"falling", []float64{0, 7, 14}, []float64{80, 79.3, 78.6}, -0.1},
+		{"noisy", []float64{0, 1, 2, 3}, []float64{1, 2, 2, 3}, 0.6},
+		{"single x", []float64{4, 4}, []float64{1, 2}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := slope(tt.xs, tt.ys); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("slope(%v, %v) = %v; want %v", tt.xs, tt.ys, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrend(t *testing.T) {
+	start := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	day := func(n int) time.Time { return start.AddDate(0, 0, n) }
+	midnight := func(n int) time.Time { return day(n).Truncate(24 * time.Hour) }
+	bodyweight := func(n int, value float64) *Measurement {
+		return &Measurement{MeasuredAt: day(n), Kind: MeasurementBodyweight, Value: value, Unit: UnitKilograms}
+	}
+	rate := func(value float64) *float64 { return &value }
+
+	tests := []struct {
+		name         string
+		measurements []*Measurement
+		since        time.Time
+		window       int
+		system       string
+		wantUnit     string
+		wantPoints   []TrendPoint
+		wantRate     *float64
+	}{
+		{
+			name:       "no measurements",
+			since:      midnight(0),
+			window:     7,
+			wantUnit:   UnitKilograms,
+			wantPoints: nil,
+		},
+		{
+			name:         "one day is not a trend",
+			measurements: []*Measurement{bodyweight(0, 80)},
+			since:        midnight(0),
+			window:       7,
+			wantUnit:     UnitKilograms,
+			wantPoints:   []TrendPoint{{"2024-01-01", 80, 80}},
+		},
+		{
+			name:         "values of a day are averaged",
+			measurements: []*Measurement{bodyweight(0, 80), bodyweight(0, 81), bodyweight(7, 80)},
+			since:        midnight(0),
+			window:       1,
+			wantUnit:     UnitKilograms,
+			wantPoints:   []TrendPoint{{"2024-01-01", 80.5, 80.5}, {"2024-01-08", 80, 80}},
+			wantRate:     rate(-0.5),
+		},
+		{
+			name:         "moving average",
+			measurements: []*Measurement{bodyweight(0, 81), bodyweight(1, 80), bodyweight(2, 79), bodyweight(3, 78)},
+			since:        midnight(0),
+			window:       2,
+			wantUnit:     UnitKilograms,
+			wantPoints:   []TrendPoint{{"2024-01-01", 81, 81}, {"2024-01-02", 80, 80.5}, {"2024-01-03", 79, 79.5}, {"2024-01-04", 78, 78.5}},
+			wantRate:     rate(-5.95),
+		},
+		{
+			name:         "days before since only feed the average",
+			measurements: []*Measurement{bodyweight(0, 82), bodyweight(1, 80), bodyweight(2, 80)},
+			since:        midnight(1),
+			window:       2,
+			wantUnit:     UnitKilograms,
+			wantPoints:   []TrendPoint{{"2024-01-02", 80, 81}, {"2024-01-03", 80, 80}},
+			wantRate:     rate(-7),
+		},
+		{
+			name:         "imperial",
+			measurements: []*Measurement{bodyweight(0, 100), bodyweight(7, 99)},
+			since:        midnight(0),
+			window:       1,
+			system:       UnitsImperial,
+			wantUnit:     UnitPounds,
+			wantPoints:   []TrendPoint{{"2024-01-01", 220.46, 220.46}, {"2024-01-08", 218.26, 218.26}},
+			wantRate:     rate(-2.2),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trend := Trend(tt.measurements, MeasurementBodyweight, tt.since, tt.window, tt.system)
+
+			if trend.Unit != tt.wantUnit {
+				t.Errorf("unit = %q; want %q", trend.Unit, tt.wantUnit)
+			}
+			if len(trend.Points) != len(tt.wantPoints) {
+				t.Fatalf("got %d points; want %d", len(trend.Points), len(tt.wantPoints))
+			}
+			for i, point := range trend.Points {
+				if *point != tt.wantPoints[i] {
+					t.Errorf("point %d = %+v; want %+v", i, *point, tt.wantPoints[i])
+				}
+			}
+			switch {
+			case tt.wantRate == nil && trend.WeeklyRate != nil:
+				t.Errorf("weekly rate = %v; want none", *trend.WeeklyRate)
+			case tt.wantRate != nil && trend.WeeklyRate == nil:
+				t.Errorf("no weekly rate; want %v", *tt.wantRate)
+			case tt.wantRate != nil && *trend.WeeklyRate != *tt.wantRate:
+				t.Errorf("weekly rate = %v; want %v", *trend.WeeklyRate, *tt.wantRate)
+			}
+		})
+	}
+}
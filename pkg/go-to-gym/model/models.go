@@ -1,6 +1,7 @@
 package model
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 )
@@ -10,20 +11,56 @@ var (
 	ErrEditConflict   = errors.New("edit conflict")
 )
 
+// Querier runs queries on a *sql.DB, or on a *sql.Tx so that they take part
+// in a transaction.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
 type Models struct {
-	Workouts    WorkoutModel
-	Exercises   ExerciseModel
-	Permissions PermissionModel
-	Tokens      TokenModel
-	Users       UserModel
+	AuthCache     *AuthCache
+	APIKeys       APIKeyModel
+	Audit         AuditModel
+	Catalog       CatalogModel
+	Coaching      CoachingModel
+	Workouts      WorkoutModel
+	Exercises     ExerciseModel
+	Exports       ExportModel
+	LoginFailures LoginFailureModel
+	Measurements  MeasurementModel
+	Permissions   PermissionModel
+	Programs      ProgramModel
+	Records       RecordModel
+	Roles         RoleModel
+	Schedule      ScheduleModel
+	Sessions      SessionModel
+	Tokens        TokenModel
+	Users         UserModel
 }
 
-func NewModels(db *sql.DB) Models {
+// NewModels returns the models, sharing authCache between those that read or
+// change what it caches. authCache may be nil.
+func NewModels(db *sql.DB, authCache *AuthCache) Models {
 	return Models{
-		Workouts:    WorkoutModel{DB: db},
-		Exercises:   ExerciseModel{DB: db},
-		Permissions: PermissionModel{DB: db},
-		Tokens:      TokenModel{DB: db},
-		Users:       UserModel{DB: db},
+		AuthCache:     authCache,
+		APIKeys:       APIKeyModel{DB: db},
+		Audit:         AuditModel{DB: db},
+		Catalog:       CatalogModel{DB: db},
+		Coaching:      CoachingModel{DB: db},
+		Workouts:      WorkoutModel{DB: db},
+		Exercises:     ExerciseModel{DB: db},
+		Exports:       ExportModel{DB: db},
+		LoginFailures: LoginFailureModel{DB: db},
+		Measurements:  MeasurementModel{DB: db},
+		Permissions:   PermissionModel{DB: db, Cache: authCache},
+		Programs:      ProgramModel{DB: db},
+		Records:       RecordModel{DB: db},
+		Roles:         RoleModel{DB: db, Cache: authCache},
+		Schedule:      ScheduleModel{DB: db},
+		Sessions:      SessionModel{DB: db},
+		Tokens:        TokenModel{DB: db, Cache: authCache},
+		Users:         UserModel{DB: db, Cache: authCache},
 	}
 }
@@ -19,24 +19,66 @@ func (p Permissions) Include(code string) bool {
 }
 
 type PermissionModel struct {
-	DB *sql.DB
+	DB    *sql.DB
+	Cache *AuthCache
 }
 
+// GetAllForUser returns the user's permissions, granted directly or through
+// their roles.
 func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
+	if permissions, ok := m.Cache.getPermissions(userID); ok {
+		return permissions, nil
+	}
+
+	query := `
+		SELECT permissions.code
+		FROM permissions
+		INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
+		WHERE users_permissions.user_id = $1
+		UNION
+		SELECT permissions.code
+		FROM permissions
+		INNER JOIN roles_permissions ON roles_permissions.permission_id = permissions.id
+		INNER JOIN users_roles ON users_roles.role_id = roles_permissions.role_id
+		WHERE users_roles.user_id = $1
+		ORDER BY 1`
+	permissions, err := m.queryCodes(query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	m.Cache.setPermissions(userID, permissions)
+	return permissions, nil
+}
+
+// GetDirectForUser returns only the permissions granted to the user directly.
+func (m PermissionModel) GetDirectForUser(userID int64) (Permissions, error) {
 	query := `
 		SELECT permissions.code
 		FROM permissions
 		INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
-		INNER JOIN users ON users_permissions.user_id = users.id
-		WHERE users.id = $1`
+		WHERE users_permissions.user_id = $1
+		ORDER BY permissions.code`
+	return m.queryCodes(query, userID)
+}
+
+func (m PermissionModel) GetAll() (Permissions, error) {
+	query := `
+		SELECT DISTINCT code
+		FROM permissions
+		ORDER BY code`
+	return m.queryCodes(query)
+}
+
+func (m PermissionModel) queryCodes(query string, args ...interface{}) (Permissions, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	rows, err := m.DB.QueryContext(ctx, query, userID)
+	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var permissions Permissions
+	permissions := Permissions{}
 	for rows.Next() {
 		var permission string
 		err := rows.Scan(&permission)
@@ -51,12 +93,43 @@ func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 	return permissions, nil
 }
 
-func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
-	query := `
+const (
+	addUserPermissionsSQL = `
 		INSERT INTO users_permissions
-		SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)`
+		SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+		ON CONFLICT DO NOTHING`
+	removeUserPermissionsSQL = `
+		DELETE FROM users_permissions
+		USING permissions
+		WHERE users_permissions.permission_id = permissions.id
+		AND users_permissions.user_id = $1
+		AND permissions.code = ANY($2)`
+)
+
+func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
+	_, err := m.DB.ExecContext(ctx, addUserPermissionsSQL, userID, pq.Array(codes))
+	m.Cache.invalidateUser(userID)
+	return err
+}
+
+func (m PermissionModel) RemoveForUser(userID int64, codes ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, removeUserPermissionsSQL, userID, pq.Array(codes))
+	m.Cache.invalidateUser(userID)
+	return err
+}
+
+// ChangeForUser grants or revokes a direct permission and records the change
+// in the audit log, in one transaction.
+func (m PermissionModel) ChangeForUser(userID int64, code string, grant bool, entry *AuditEntry) error {
+	query := removeUserPermissionsSQL
+	if grant {
+		query = addUserPermissionsSQL
+	}
+	err := recordChange(m.DB, entry, query, userID, pq.Array([]string{code}))
+	m.Cache.invalidateUser(userID)
 	return err
 }
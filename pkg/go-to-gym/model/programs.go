@@ -0,0 +1,538 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/validator"
+	"github.com/lib/pq"
+	"math"
+	"time"
+)
+
+const (
+	ProgressionNone       = "none"
+	ProgressionLinear     = "linear"
+	ProgressionDouble     = "double"
+	ProgressionPercentage = "percentage"
+)
+
+type Program struct {
+	ID          int64         `json:"id"`
+	CreatedAt   time.Time     `json:"-"`
+	UserID      int64         `json:"user_id"`
+	Name        string        `json:"name"`
+	Description string        `json:"description,omitempty"`
+	Weeks       int           `json:"weeks"`
+	Days        []*ProgramDay `json:"days"`
+	Progression Progression   `json:"progression"`
+	Visibility  string        `json:"visibility"`
+	Version     int           `json:"version"`
+}
+
+// ProgramDay puts a workout on day Day (1-7) of a week. Week 0 repeats the
+// day every week; a day with a concrete week number overrides it for that
+// week only.
+type ProgramDay struct {
+	Week      int   `json:"week"`
+	Day       int   `json:"day"`
+	WorkoutID int64 `json:"workout_id"`
+}
+
+// Progression describes how loads move from one session to the next.
+//
+//   - linear adds Increment kg whenever every prescribed rep was completed.
+//   - double climbs from RepsMin to RepsMax at the same weight, then adds
+//     Increment kg and drops back to RepsMin.
+//   - percentage prescribes WavePercents of the estimated 1RM, cycling
+//     through the list one entry per week.
+//
+// Weeks listed in DeloadWeeks use DeloadPercent of the load and half the sets.
+type Progression struct {
+	Rule          string    `json:"rule"`
+	Increment     float64   `json:"increment,omitempty"`
+	RepsMin       int       `json:"reps_min,omitempty"`
+	RepsMax       int       `json:"reps_max,omitempty"`
+	WavePercents  []float64 `json:"wave_percents,omitempty"`
+	DeloadWeeks   []int64   `json:"deload_weeks,omitempty"`
+	DeloadPercent float64   `json:"deload_percent,omitempty"`
+}
+
+// arrays returns WavePercents and DeloadWeeks ready to bind. Rules without
+// waves or deloads leave them nil, which would be NULL in their NOT NULL
+// columns, so those are bound as empty arrays.
+func (pr Progression) arrays() (driver.Valuer, driver.Valuer) {
+	wavePercents, deloadWeeks := pr.WavePercents, pr.DeloadWeeks
+	if wavePercents == nil {
+		wavePercents = []float64{}
+	}
+	if deloadWeeks == nil {
+		deloadWeeks = []int64{}
+	}
+	return pq.Array(wavePercents), pq.Array(deloadWeeks)
+}
+
+func (p *Program) IsOwnedBy(user *User) bool {
+	return p.UserID == user.ID
+}
+
+// Day returns the program day scheduled for day of week, preferring an
+// override for that week over the repeating day. It returns nil for rest days.
+func (p *Program) Day(week, day int) *ProgramDay {
+	var repeating *ProgramDay
+	for _, d := range p.Days {
+		if d.Day != day {
+			continue
+		}
+		if d.Week == week {
+			return d
+		}
+		if d.Week == 0 {
+			repeating = d
+		}
+	}
+	return repeating
+}
+
+func (p *Program) IsDeloadWeek(week int) bool {
+	for _, w := range p.Progression.DeloadWeeks {
+		if int(w) == week {
+			return true
+		}
+	}
+	return false
+}
+
+func ValidateProgram(v *validator.Validator, p *Program) {
+	v.Check(p.Name != "", "name", "must be provided")
+	v.Check(len(p.Name) <= 100, "name", "must not be more than 100 characters long")
+	v.Check(len(p.Description) <= 1000, "description", "must not be more than 1000 bytes long")
+	v.Check(p.Weeks >= 1 && p.Weeks <= 52, "weeks", "must be between 1 and 52")
+	v.Check(validator.In(p.Visibility, VisibilityPrivate, VisibilityShared, VisibilityPublic), "visibility", "must be one of private, shared or public")
+
+	v.Check(len(p.Days) > 0, "days", "at least one day must be provided")
+	seen := make(map[[2]int]bool)
+	for _, d := range p.Days {
+		v.Check(d.Week >= 0 && d.Week <= p.Weeks, "days", "week must be between 0 and the number of weeks")
+		v.Check(d.Day >= 1 && d.Day <= 7, "days", "day must be between 1 and 7")
+		v.Check(d.WorkoutID > 0, "days", "workout_id must be provided")
+		if seen[[2]int{d.Week, d.Day}] {
+			v.AddError("days", "must not contain the same week and day twice")
+		}
+		seen[[2]int{d.Week, d.Day}] = true
+	}
+
+	pr := p.Progression
+	v.Check(validator.In(pr.Rule, ProgressionNone, ProgressionLinear, ProgressionDouble, ProgressionPercentage), "progression.rule", "must be one of none, linear, double or percentage")
+	v.Check(pr.Increment >= 0 && pr.Increment <= 100, "progression.increment", "must be between 0 and 100")
+	switch pr.Rule {
+	case ProgressionLinear:
+		v.Check(pr.Increment > 0, "progression.increment", "must be provided for linear progression")
+	case ProgressionDouble:
+		v.Check(pr.Increment > 0, "progression.increment", "must be provided for double progression")
+		v.Check(pr.RepsMin >= 1, "progression.reps_min", "must be at least 1")
+		v.Check(pr.RepsMax >= pr.RepsMin, "progression.reps_max", "must not be less than reps_min")
+		v.Check(pr.RepsMax <= 100, "progression.reps_max", "must not be more than 100")
+	case ProgressionPercentage:
+		v.Check(len(pr.WavePercents) > 0, "progression.wave_percents", "must be provided for percentage progression")
+		for _, percent := range pr.WavePercents {
+			v.Check(percent > 0 && percent <= 110, "progression.wave_percents", "must be between 0 and 110")
+		}
+	}
+	deloads := make(map[int64]bool)
+	for _, week := range pr.DeloadWeeks {
+		v.Check(week >= 1 && int(week) <= p.Weeks, "progression.deload_weeks", "must be within the program")
+		if deloads[week] {
+			v.AddError("progression.deload_weeks", "must not contain duplicate values")
+		}
+		deloads[week] = true
+	}
+	if len(pr.DeloadWeeks) > 0 {
+		v.Check(pr.DeloadPercent > 0 && pr.DeloadPercent <= 100, "progression.deload_percent", "must be between 0 and 100")
+	}
+}
+
+// Prescription is the concrete target for one exercise of a program day.
+// Weights are in kilograms.
+type Prescription struct {
+	ExerciseID   int64   `json:"exercise_id"`
+	ExerciseName string  `json:"exercise_name"`
+	Sets         int     `json:"sets"`
+	Reps         int     `json:"reps"`
+	Weight       float64 `json:"weight,omitempty"`
+	WeightUnit   string  `json:"weight_unit,omitempty"`
+	Duration     int     `json:"duration_seconds,omitempty"`
+	Tempo        string  `json:"tempo,omitempty"`
+	GroupID      int64   `json:"group_id,omitempty"`
+	Deload       bool    `json:"deload,omitempty"`
+	Basis        string  `json:"basis"`
+}
+
+// Prescribe renders the prescription for exercise in the given week. last
+// holds the sets the user logged for the exercise in their most recent
+// session with it, and oneRepMax their best estimated 1RM (0 if unknown).
+func (p *Program) Prescribe(week int, exercise *Exercise, last []*SessionSet, oneRepMax float64) *Prescription {
+	rx := &Prescription{
+		ExerciseID:   exercise.ID,
+		ExerciseName: exercise.Name,
+		Sets:         exercise.Sets,
+		Reps:         exercise.Reps,
+		Weight:       convertWeight(exercise.Weight, exercise.WeightUnit, UnitKilograms),
+		Duration:     exercise.Duration,
+		Tempo:        exercise.Tempo,
+		GroupID:      exercise.GroupID,
+		Basis:        "workout",
+	}
+
+	pr := p.Progression
+
+	switch pr.Rule {
+	case ProgressionLinear:
+		if weight, completed := lastPerformance(last, rx.Reps); weight > 0 {
+			rx.Weight, rx.Basis = weight, "history"
+			if completed {
+				rx.Weight += pr.Increment
+			}
+		}
+	case ProgressionDouble:
+		rx.Reps = pr.RepsMin
+		if weight, _ := lastPerformance(last, 0); weight > 0 {
+			rx.Weight, rx.Basis = weight, "history"
+			reps := minReps(last, weight)
+			switch {
+			case reps >= pr.RepsMax:
+				rx.Weight += pr.Increment
+			case reps >= pr.RepsMin:
+				rx.Reps = reps + 1
+			}
+		}
+	case ProgressionPercentage:
+		if oneRepMax == 0 && rx.Weight > 0 && rx.Reps > 0 {
+			oneRepMax = Estimate1RM(rx.Weight, rx.Reps)
+		} else if oneRepMax > 0 {
+			rx.Basis = "history"
+		}
+		if oneRepMax > 0 {
+			percent := pr.WavePercents[(week-1)%len(pr.WavePercents)]
+			rx.Weight = oneRepMax * percent / 100
+		}
+	}
+
+	if p.IsDeloadWeek(week) {
+		rx.Deload = true
+		rx.Weight = rx.Weight * pr.DeloadPercent / 100
+		rx.Sets = (rx.Sets + 1) / 2
+	}
+
+	rx.Weight = roundToPlate(rx.Weight)
+	if rx.Weight > 0 {
+		rx.WeightUnit = UnitKilograms
+	}
+	return rx
+}
+
+// lastPerformance returns the top weight of the logged sets and whether every
+// set at that weight reached reps.
+func lastPerformance(sets []*SessionSet, reps int) (float64, bool) {
+	var top float64
+	for _, set := range sets {
+		top = math.Max(top, set.Weight)
+	}
+	return top, top > 0 && minReps(sets, top) >= reps
+}
+
+func minReps(sets []*SessionSet, weight float64) int {
+	reps := -1
+	for _, set := range sets {
+		if set.Weight == weight && (reps < 0 || set.Reps < reps) {
+			reps = set.Reps
+		}
+	}
+	return reps
+}
+
+// roundToPlate rounds a load to the nearest 2.5 kg, the smallest step most
+// gyms can load.
+func roundToPlate(weight float64) float64 {
+	return math.Round(weight/2.5) * 2.5
+}
+
+type ProgramModel struct {
+	DB *sql.DB
+}
+
+func (m ProgramModel) Insert(program *Program) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO programs (user_id, name, description, weeks, visibility, progression_rule, increment, reps_min,
+		                      reps_max, wave_percents, deload_weeks, deload_percent)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING id, created_at, version`
+
+	pr := program.Progression
+	wavePercents, deloadWeeks := pr.arrays()
+	args := []interface{}{
+		program.UserID,
+		program.Name,
+		program.Description,
+		program.Weeks,
+		program.Visibility,
+		pr.Rule,
+		pr.Increment,
+		pr.RepsMin,
+		pr.RepsMax,
+		wavePercents,
+		deloadWeeks,
+		pr.DeloadPercent,
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&program.ID, &program.CreatedAt, &program.Version)
+	if err != nil {
+		return err
+	}
+
+	err = insertProgramDays(ctx, tx, program)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func insertProgramDays(ctx context.Context, tx *sql.Tx, program *Program) error {
+	query := `
+		INSERT INTO program_days (program_id, week, day, workout_id)
+		VALUES ($1, $2, $3, $4)`
+
+	for _, d := range program.Days {
+		_, err := tx.ExecContext(ctx, query, program.ID, d.Week, d.Day, d.WorkoutID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns the program if it belongs to the user, isn't private or was
+// assigned to the user by their coach.
+func (m ProgramModel) Get(id int64, userID int64) (*Program, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, created_at, user_id, name, description, weeks, visibility, progression_rule, increment, reps_min,
+		       reps_max, wave_percents, deload_weeks, deload_percent, version
+		FROM programs
+		WHERE id = $1
+		AND (user_id = $2 OR visibility IN ('shared', 'public') OR id IN (` + assignedSQL("program_id") + `))`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	program, err := scanProgram(m.DB.QueryRowContext(ctx, query, id, userID).Scan)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	program.Days, err = m.getDays(ctx, program.ID)
+	if err != nil {
+		return nil, err
+	}
+	return program, nil
+}
+
+func scanProgram(scan func(dest ...interface{}) error, extra ...interface{}) (*Program, error) {
+	var program Program
+
+	dest := append(extra,
+		&program.ID,
+		&program.CreatedAt,
+		&program.UserID,
+		&program.Name,
+		&program.Description,
+		&program.Weeks,
+		&program.Visibility,
+		&program.Progression.Rule,
+		&program.Progression.Increment,
+		&program.Progression.RepsMin,
+		&program.Progression.RepsMax,
+		pq.Array(&program.Progression.WavePercents),
+		pq.Array(&program.Progression.DeloadWeeks),
+		&program.Progression.DeloadPercent,
+		&program.Version,
+	)
+
+	if err := scan(dest...); err != nil {
+		return nil, err
+	}
+	return &program, nil
+}
+
+func (m ProgramModel) getDays(ctx context.Context, programID int64) ([]*ProgramDay, error) {
+	query := `
+		SELECT week, day, workout_id
+		FROM program_days
+		WHERE program_id = $1
+		ORDER BY week, day`
+
+	rows, err := m.DB.QueryContext(ctx, query, programID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := []*ProgramDay{}
+
+	for rows.Next() {
+		var d ProgramDay
+		if err := rows.Scan(&d.Week, &d.Day, &d.WorkoutID); err != nil {
+			return nil, err
+		}
+		days = append(days, &d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return days, nil
+}
+
+func (m ProgramModel) Update(program *Program) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE programs
+		SET name = $1, description = $2, weeks = $3, visibility = $4, progression_rule = $5, increment = $6,
+		    reps_min = $7, reps_max = $8, wave_percents = $9, deload_weeks = $10, deload_percent = $11,
+		    version = version + 1
+		WHERE id = $12 AND version = $13 AND user_id = $14
+		RETURNING version`
+
+	pr := program.Progression
+	wavePercents, deloadWeeks := pr.arrays()
+	args := []interface{}{
+		program.Name,
+		program.Description,
+		program.Weeks,
+		program.Visibility,
+		pr.Rule,
+		pr.Increment,
+		pr.RepsMin,
+		pr.RepsMax,
+		wavePercents,
+		deloadWeeks,
+		pr.DeloadPercent,
+		program.ID,
+		program.Version,
+		program.UserID,
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&program.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM program_days WHERE program_id = $1`, program.ID)
+	if err != nil {
+		return err
+	}
+
+	err = insertProgramDays(ctx, tx, program)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m ProgramModel) Delete(id int64, userID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM programs
+		WHERE id = $1 AND user_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetAll lists the user's own programs and every public one. Days are left
+// out; they are returned by Get.
+func (m ProgramModel) GetAll(userID int64, name string, filters Filters) ([]*Program, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, user_id, name, description, weeks, visibility, progression_rule,
+		       increment, reps_min, reps_max, wave_percents, deload_weeks, deload_percent, version
+		FROM programs
+		WHERE (user_id = $1 OR visibility = 'public')
+		AND (to_tsvector('simple', name) @@ plainto_tsquery('simple', $2) OR $2 = '')
+		ORDER BY %s %s, id ASC
+		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{userID, name, filters.limit(), filters.offset()}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	var programs []*Program
+
+	for rows.Next() {
+		program, err := scanProgram(rows.Scan, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		programs = append(programs, program)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return programs, metadata, nil
+}
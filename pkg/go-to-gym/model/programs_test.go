@@ -0,0 +1,35 @@
+package model
+
+import (
+	"database/sql/driver"
+	"testing"
+)
+
+func TestProgressionArrays(t *testing.T) {
+	tests := []struct {
+		name             string
+		progression      Progression
+		wantWavePercents driver.Value
+		wantDeloadWeeks  driver.Value
+	}{
+		{"none", Progression{Rule: ProgressionNone}, "{}", "{}"},
+		{"linear without deloads", Progression{Rule: ProgressionLinear, Increment: 2.5}, "{}", "{}"},
+		{"percentage", Progression{Rule: ProgressionPercentage, WavePercents: []float64{65, 75, 85}}, "{65,75,85}", "{}"},
+		{"deloads", Progression{Rule: ProgressionLinear, Increment: 2.5, DeloadWeeks: []int64{4, 8}, DeloadPercent: 60}, "{}", "{4,8}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wavePercents, deloadWeeks := tt.progression.arrays()
+
+			got, err := wavePercents.Value()
+			if err != nil || got != tt.wantWavePercents {
+				t.Errorf("wave_percents = %v, %v; want %v", got, err, tt.wantWavePercents)
+			}
+			got, err = deloadWeeks.Value()
+			if err != nil || got != tt.wantDeloadWeeks {
+				t.Errorf("deload_weeks = %v, %v; want %v", got, err, tt.wantDeloadWeeks)
+			}
+		})
+	}
+}
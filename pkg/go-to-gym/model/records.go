@@ -0,0 +1,279 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const (
+	// RecordHeaviestWeight is the heaviest single: the most weight lifted
+	// for one rep.
+	RecordHeaviestWeight = "heaviest_weight"
+	RecordEstimated1RM   = "estimated_1rm"
+	RecordMostReps       = "most_reps"
+	RecordSessionVolume  = "session_volume"
+)
+
+type PersonalRecord struct {
+	ID           int64     `json:"id"`
+	AchievedAt   time.Time `json:"achieved_at"`
+	UserID       int64     `json:"-"`
+	ExerciseName string    `json:"exercise_name"`
+	Type         string    `json:"type"`
+	Value        float64   `json:"value"`
+	Weight       float64   `json:"weight,omitempty"`
+	Reps         int       `json:"reps,omitempty"`
+	SessionID    int64     `json:"session_id"`
+	SetID        int64     `json:"set_id"`
+}
+
+// Epley estimates a one-rep max as weight * (1 + reps/30).
+func Epley(weight float64, reps int) float64 {
+	if reps <= 1 {
+		return weight
+	}
+	return weight * (1 + float64(reps)/30)
+}
+
+// Brzycki estimates a one-rep max as weight * 36 / (37 - reps).
+func Brzycki(weight float64, reps int) float64 {
+	if reps <= 1 {
+		return weight
+	}
+	if reps >= 37 {
+		return Epley(weight, reps)
+	}
+	return weight * 36 / float64(37-reps)
+}
+
+// Estimate1RM uses Brzycki up to ten reps, where it is the more accurate of
+// the two, and Epley above that.
+func Estimate1RM(weight float64, reps int) float64 {
+	if reps <= 10 {
+		return round2(Brzycki(weight, reps))
+	}
+	return round2(Epley(weight, reps))
+}
+
+type RecordModel struct {
+	DB *sql.DB
+}
+
+// detectRecords compares a freshly logged set with the user's records for the
+// same exercise set before it was performed, stores every record it beats and
+// returns them. Exercises are matched by name so that records carry across
+// workouts, and records are dated when the set was performed, so imported
+// history yields the records it held at the time.
+func detectRecords(ctx context.Context, q Querier, userID int64, set *SessionSet) ([]*PersonalRecord, error) {
+	query := `
+		SELECT COALESCE(MAX(value) FILTER (WHERE record_type = 'heaviest_weight'), 0),
+		       COALESCE(MAX(value) FILTER (WHERE record_type = 'estimated_1rm'), 0),
+		       COALESCE(MAX(value) FILTER (WHERE record_type = 'most_reps' AND weight = $3), 0),
+		       COALESCE(MAX(value) FILTER (WHERE record_type = 'session_volume' AND session_id <> $4), 0)
+		FROM personal_records
+		WHERE user_id = $1 AND lower(exercise_name) = lower($2) AND achieved_at <= $5`
+
+	var heaviest, estimated, mostReps, volume float64
+
+	err := q.QueryRowContext(ctx, query, userID, set.ExerciseName, set.Weight, set.SessionID, set.PerformedAt).Scan(&heaviest, &estimated, &mostReps, &volume)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT COALESCE(SUM(weight * reps), 0)
+		FROM session_sets
+		WHERE session_id = $1 AND lower(exercise_name) = lower($2)`
+
+	var sessionVolume float64
+
+	err = q.QueryRowContext(ctx, query, set.SessionID, set.ExerciseName).Scan(&sessionVolume)
+	if err != nil {
+		return nil, err
+	}
+
+	newRecord := func(recordType string, value float64) *PersonalRecord {
+		return &PersonalRecord{
+			UserID:       userID,
+			ExerciseName: set.ExerciseName,
+			Type:         recordType,
+			Value:        round2(value),
+			Weight:       set.Weight,
+			Reps:         set.Reps,
+			SessionID:    set.SessionID,
+			SetID:        set.ID,
+			AchievedAt:   set.PerformedAt,
+		}
+	}
+
+	var records []*PersonalRecord
+
+	if set.Reps == 1 && set.Weight > 0 && set.Weight > heaviest {
+		records = append(records, newRecord(RecordHeaviestWeight, set.Weight))
+	}
+	if e1rm := Estimate1RM(set.Weight, set.Reps); set.Weight > 0 && e1rm > estimated {
+		records = append(records, newRecord(RecordEstimated1RM, e1rm))
+	}
+	if float64(set.Reps) > mostReps {
+		records = append(records, newRecord(RecordMostReps, float64(set.Reps)))
+	}
+	if sessionVolume > 0 && sessionVolume > volume {
+		// A session only ever holds one volume record per exercise, so the
+		// one from an earlier set of this session is replaced.
+		query = `
+			DELETE FROM personal_records
+			WHERE user_id = $1 AND lower(exercise_name) = lower($2) AND record_type = $3 AND session_id = $4`
+
+		_, err = q.ExecContext(ctx, query, userID, set.ExerciseName, RecordSessionVolume, set.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, newRecord(RecordSessionVolume, sessionVolume))
+	}
+
+	query = `
+		INSERT INTO personal_records (user_id, exercise_name, record_type, value, weight, reps, session_id, set_id, achieved_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, achieved_at`
+
+	for _, record := range records {
+		args := []interface{}{
+			record.UserID,
+			record.ExerciseName,
+			record.Type,
+			record.Value,
+			record.Weight,
+			record.Reps,
+			record.SessionID,
+			record.SetID,
+			record.AchievedAt,
+		}
+		err = q.QueryRowContext(ctx, query, args...).Scan(&record.ID, &record.AchievedAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return records, nil
+}
+
+// GetCurrent returns the user's standing records: the best value of each type
+// per exercise, and for most_reps the best value at every weight.
+func (m RecordModel) GetCurrent(userID int64, exerciseName string) ([]*PersonalRecord, error) {
+	query := `
+		SELECT DISTINCT ON (lower(exercise_name), record_type, CASE WHEN record_type = 'most_reps' THEN weight ELSE 0 END)
+		       id, achieved_at, user_id, exercise_name, record_type, value, weight, reps, session_id, set_id
+		FROM personal_records
+		WHERE user_id = $1
+		AND (lower(exercise_name) = lower($2) OR $2 = '')
+		ORDER BY lower(exercise_name), record_type, CASE WHEN record_type = 'most_reps' THEN weight ELSE 0 END, value DESC, id ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, exerciseName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []*PersonalRecord{}
+
+	for rows.Next() {
+		var record PersonalRecord
+
+		err := rows.Scan(
+			&record.ID,
+			&record.AchievedAt,
+			&record.UserID,
+			&record.ExerciseName,
+			&record.Type,
+			&record.Value,
+			&record.Weight,
+			&record.Reps,
+			&record.SessionID,
+			&record.SetID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, &record)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// GetBest returns the user's best value of a record type for an exercise, or
+// 0 if there is none yet.
+func (m RecordModel) GetBest(userID int64, exerciseName string, recordType string) (float64, error) {
+	query := `
+		SELECT COALESCE(MAX(value), 0)
+		FROM personal_records
+		WHERE user_id = $1 AND lower(exercise_name) = lower($2) AND record_type = $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var best float64
+	err := m.DB.QueryRowContext(ctx, query, userID, exerciseName, recordType).Scan(&best)
+	return best, err
+}
+
+func (m RecordModel) GetAll(userID int64, exerciseName string, recordType string, filters Filters) ([]*PersonalRecord, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, achieved_at, user_id, exercise_name, record_type, value, weight, reps, session_id, set_id
+		FROM personal_records
+		WHERE user_id = $1
+		AND (lower(exercise_name) = lower($2) OR $2 = '')
+		AND (record_type = $3 OR $3 = '')
+		ORDER BY %s %s, id ASC
+		LIMIT $4 OFFSET $5`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{userID, exerciseName, recordType, filters.limit(), filters.offset()}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	var records []*PersonalRecord
+
+	for rows.Next() {
+		var record PersonalRecord
+
+		err := rows.Scan(
+			&totalRecords,
+			&record.ID,
+			&record.AchievedAt,
+			&record.UserID,
+			&record.ExerciseName,
+			&record.Type,
+			&record.Value,
+			&record.Weight,
+			&record.Reps,
+			&record.SessionID,
+			&record.SetID,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		records = append(records, &record)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return records, metadata, nil
+}
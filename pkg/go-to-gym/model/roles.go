@@ -0,0 +1,152 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"github.com/lib/pq"
+	"time"
+)
+
+const (
+	RoleMember = "member"
+	RoleCoach  = "coach"
+	RoleAdmin  = "admin"
+)
+
+// Role bundles permissions. A user has the permissions of all their roles as
+// well as any granted to them directly.
+type Role struct {
+	Code        string      `json:"code"`
+	Description string      `json:"description"`
+	Permissions Permissions `json:"permissions"`
+}
+
+type RoleModel struct {
+	DB    *sql.DB
+	Cache *AuthCache
+}
+
+func (m RoleModel) GetAll() ([]*Role, error) {
+	query := `
+		SELECT roles.code, roles.description,
+		       ARRAY(SELECT permissions.code
+		             FROM permissions
+		             INNER JOIN roles_permissions ON roles_permissions.permission_id = permissions.id
+		             WHERE roles_permissions.role_id = roles.id
+		             ORDER BY permissions.code)
+		FROM roles
+		ORDER BY roles.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []*Role{}
+	for rows.Next() {
+		var role Role
+		err := rows.Scan(&role.Code, &role.Description, pq.Array(&role.Permissions))
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, &role)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (m RoleModel) GetAllForUser(userID int64) ([]string, error) {
+	query := `
+		SELECT roles.code
+		FROM roles
+		INNER JOIN users_roles ON users_roles.role_id = roles.id
+		WHERE users_roles.user_id = $1
+		ORDER BY roles.id`
+	return m.queryCodes(query, userID)
+}
+
+// GetGrantingForUser returns the user's roles that grant the permission.
+func (m RoleModel) GetGrantingForUser(userID int64, permission string) ([]string, error) {
+	query := `
+		SELECT roles.code
+		FROM roles
+		INNER JOIN users_roles ON users_roles.role_id = roles.id
+		INNER JOIN roles_permissions ON roles_permissions.role_id = roles.id
+		INNER JOIN permissions ON permissions.id = roles_permissions.permission_id
+		WHERE users_roles.user_id = $1
+		AND permissions.code = $2
+		ORDER BY roles.id`
+	return m.queryCodes(query, userID, permission)
+}
+
+func (m RoleModel) queryCodes(query string, args ...interface{}) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []string{}
+	for rows.Next() {
+		var role string
+		err := rows.Scan(&role)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+const (
+	addUserRolesSQL = `
+		INSERT INTO users_roles
+		SELECT $1, roles.id FROM roles WHERE roles.code = ANY($2)
+		ON CONFLICT DO NOTHING`
+	removeUserRolesSQL = `
+		DELETE FROM users_roles
+		USING roles
+		WHERE users_roles.role_id = roles.id
+		AND users_roles.user_id = $1
+		AND roles.code = ANY($2)`
+)
+
+func (m RoleModel) AddForUser(userID int64, codes ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, addUserRolesSQL, userID, pq.Array(codes))
+	m.Cache.invalidateUser(userID)
+	return err
+}
+
+func (m RoleModel) RemoveForUser(userID int64, codes ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, removeUserRolesSQL, userID, pq.Array(codes))
+	m.Cache.invalidateUser(userID)
+	return err
+}
+
+// ChangeForUser grants or revokes a role and records the change in the audit
+// log, in one transaction.
+func (m RoleModel) ChangeForUser(userID int64, code string, grant bool, entry *AuditEntry) error {
+	query := removeUserRolesSQL
+	if grant {
+		query = addUserRolesSQL
+	}
+	err := recordChange(m.DB, entry, query, userID, pq.Array([]string{code}))
+	m.Cache.invalidateUser(userID)
+	return err
+}
@@ -0,0 +1,517 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/validator"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FreqDaily   = "DAILY"
+	FreqWeekly  = "WEEKLY"
+	FreqMonthly = "MONTHLY"
+)
+
+// maxOccurrences bounds the expansion of a single rule so that an open-ended
+// daily rule can't run away.
+const maxOccurrences = 5000
+
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday,
+	"FR": time.Friday, "SA": time.Saturday, "SU": time.Sunday,
+}
+
+// Recurrence is the subset of an RFC 5545 RRULE the schedule understands:
+// FREQ (DAILY, WEEKLY, MONTHLY), INTERVAL, BYDAY (weekly only), COUNT and UNTIL.
+type Recurrence struct {
+	Freq     string
+	Interval int
+	ByDay    []time.Weekday
+	Count    int
+	Until    time.Time
+}
+
+// ParseRRule parses a rule such as "FREQ=WEEKLY;BYDAY=MO,WE,FR". An optional
+// "RRULE:" prefix is ignored.
+func ParseRRule(s string) (*Recurrence, error) {
+	rec := &Recurrence{Interval: 1}
+
+	s = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(s)), "RRULE:")
+
+	for _, part := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("malformed rule part %q", part)
+		}
+
+		switch key {
+		case "FREQ":
+			if value != FreqDaily && value != FreqWeekly && value != FreqMonthly {
+				return nil, fmt.Errorf("unsupported frequency %q", value)
+			}
+			rec.Freq = value
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > 52 {
+				return nil, errors.New("INTERVAL must be between 1 and 52")
+			}
+			rec.Interval = n
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				wd, ok := weekdays[day]
+				if !ok {
+					return nil, fmt.Errorf("unknown weekday %q", day)
+				}
+				rec.ByDay = append(rec.ByDay, wd)
+			}
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > maxOccurrences {
+				return nil, fmt.Errorf("COUNT must be between 1 and %d", maxOccurrences)
+			}
+			rec.Count = n
+		case "UNTIL":
+			until, err := parseUntil(value)
+			if err != nil {
+				return nil, err
+			}
+			rec.Until = until
+		default:
+			return nil, fmt.Errorf("unsupported rule part %q", key)
+		}
+	}
+
+	switch {
+	case rec.Freq == "":
+		return nil, errors.New("FREQ must be provided")
+	case len(rec.ByDay) > 0 && rec.Freq != FreqWeekly:
+		return nil, errors.New("BYDAY is only supported with FREQ=WEEKLY")
+	case rec.Count > 0 && !rec.Until.IsZero():
+		return nil, errors.New("COUNT and UNTIL must not be combined")
+	}
+	return rec, nil
+}
+
+// String formats the rule in canonical RRULE form, with UNTIL in UTC as
+// required when DTSTART carries a time zone.
+func (rec *Recurrence) String() string {
+	parts := []string{"FREQ=" + rec.Freq}
+	if rec.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(rec.Interval))
+	}
+	if len(rec.ByDay) > 0 {
+		days := make([]string, 0, len(rec.ByDay))
+		for _, wd := range rec.ByDay {
+			days = append(days, strings.ToUpper(wd.String()[:2]))
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if rec.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(rec.Count))
+	}
+	if !rec.Until.IsZero() {
+		parts = append(parts, "UNTIL="+rec.Until.UTC().Format("20060102T150405Z"))
+	}
+	return strings.Join(parts, ";")
+}
+
+func parseUntil(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			if layout == "20060102" {
+				// A date-only UNTIL includes the whole day.
+				t = t.Add(24*time.Hour - time.Second)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("malformed UNTIL %q", value)
+}
+
+type ScheduleEntry struct {
+	ID              int64     `json:"id"`
+	CreatedAt       time.Time `json:"-"`
+	UserID          int64     `json:"-"`
+	WorkoutID       int64     `json:"workout_id"`
+	WorkoutName     string    `json:"workout_name"`
+	StartsAt        time.Time `json:"starts_at"`
+	DurationMinutes int       `json:"duration_minutes"`
+	Timezone        string    `json:"timezone"`
+	RRule           string    `json:"rrule,omitempty"`
+	Notes           string    `json:"notes,omitempty"`
+	Version         int       `json:"version"`
+}
+
+// Occurrence is one concrete date of a schedule entry.
+type Occurrence struct {
+	EntryID     int64     `json:"entry_id"`
+	WorkoutID   int64     `json:"workout_id"`
+	WorkoutName string    `json:"workout_name"`
+	StartsAt    time.Time `json:"starts_at"`
+	EndsAt      time.Time `json:"ends_at"`
+	Notes       string    `json:"notes,omitempty"`
+}
+
+func ValidateScheduleEntry(v *validator.Validator, e *ScheduleEntry) {
+	v.Check(e.WorkoutID > 0, "workout_id", "must be provided")
+	v.Check(!e.StartsAt.IsZero(), "starts_at", "must be provided")
+	v.Check(e.DurationMinutes >= 1 && e.DurationMinutes <= 24*60, "duration_minutes", "must be between 1 and 1440")
+	v.Check(len(e.Notes) <= 1000, "notes", "must not be more than 1000 bytes long")
+
+	_, err := time.LoadLocation(e.Timezone)
+	v.Check(e.Timezone != "" && err == nil, "timezone", "must be a valid IANA time zone")
+
+	if e.RRule != "" {
+		_, err := ParseRRule(e.RRule)
+		if err != nil {
+			v.AddError("rrule", err.Error())
+		}
+	}
+}
+
+// Occurrences expands the entry into the occurrences that start within
+// [from, to). Recurrences are computed in the entry's time zone, so a 07:00
+// session stays at 07:00 across daylight saving changes.
+func (e *ScheduleEntry) Occurrences(from, to time.Time) ([]*Occurrence, error) {
+	loc, err := time.LoadLocation(e.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	start := e.StartsAt.In(loc)
+
+	var starts []time.Time
+	if e.RRule == "" {
+		starts = []time.Time{start}
+	} else {
+		rec, err := ParseRRule(e.RRule)
+		if err != nil {
+			return nil, err
+		}
+		starts = rec.expand(start, to)
+	}
+
+	var occurrences []*Occurrence
+	for _, s := range starts {
+		if s.Before(from) || !s.Before(to) {
+			continue
+		}
+		occurrences = append(occurrences, &Occurrence{
+			EntryID:     e.ID,
+			WorkoutID:   e.WorkoutID,
+			WorkoutName: e.WorkoutName,
+			StartsAt:    s,
+			EndsAt:      s.Add(time.Duration(e.DurationMinutes) * time.Minute),
+			Notes:       e.Notes,
+		})
+	}
+	return occurrences, nil
+}
+
+// expand returns the start times of the rule from start up to (excluding)
+// end, honouring COUNT and UNTIL.
+func (rec *Recurrence) expand(start, end time.Time) []time.Time {
+	var starts []time.Time
+
+	at := func(days, months int) time.Time {
+		return time.Date(start.Year(), start.Month()+time.Month(months), start.Day()+days,
+			start.Hour(), start.Minute(), start.Second(), 0, start.Location())
+	}
+
+	byDay := rec.ByDay
+	if len(byDay) == 0 {
+		byDay = []time.Weekday{start.Weekday()}
+	}
+	// Offsets from the Monday of the start week, in week order.
+	offsets := make([]int, 0, len(byDay))
+	for _, wd := range byDay {
+		offsets = append(offsets, (int(wd)+6)%7)
+	}
+	sort.Ints(offsets)
+	monday := -((int(start.Weekday()) + 6) % 7)
+
+	for period := 0; len(starts) < maxOccurrences; period++ {
+		var candidates []time.Time
+		switch rec.Freq {
+		case FreqDaily:
+			candidates = []time.Time{at(period*rec.Interval, 0)}
+		case FreqWeekly:
+			for _, offset := range offsets {
+				candidates = append(candidates, at(monday+period*rec.Interval*7+offset, 0))
+			}
+		case FreqMonthly:
+			t := at(0, period*rec.Interval)
+			// Months without the start day (e.g. the 31st) are skipped, as
+			// RFC 5545 requires.
+			if t.Day() != start.Day() {
+				continue
+			}
+			candidates = []time.Time{t}
+		}
+
+		for _, t := range candidates {
+			if t.Before(start) {
+				continue
+			}
+			if !t.Before(end) || (!rec.Until.IsZero() && t.After(rec.Until)) {
+				return starts
+			}
+			starts = append(starts, t)
+			if rec.Count > 0 && len(starts) == rec.Count {
+				return starts
+			}
+		}
+
+		if period > maxOccurrences*12 {
+			break
+		}
+	}
+	return starts
+}
+
+type ScheduleModel struct {
+	DB *sql.DB
+}
+
+func (m ScheduleModel) Insert(entry *ScheduleEntry) error {
+	query := `
+		INSERT INTO scheduled_workouts (user_id, workout_id, starts_at, duration_minutes, timezone, rrule, notes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at, version`
+
+	args := []interface{}{
+		entry.UserID,
+		entry.WorkoutID,
+		entry.StartsAt,
+		entry.DurationMinutes,
+		entry.Timezone,
+		entry.RRule,
+		entry.Notes,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&entry.ID, &entry.CreatedAt, &entry.Version)
+}
+
+func (m ScheduleModel) Get(id int64, userID int64) (*ScheduleEntry, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT scheduled_workouts.id, scheduled_workouts.created_at, scheduled_workouts.user_id,
+		       scheduled_workouts.workout_id, workouts.name, scheduled_workouts.starts_at,
+		       scheduled_workouts.duration_minutes, scheduled_workouts.timezone, scheduled_workouts.rrule,
+		       scheduled_workouts.notes, scheduled_workouts.version
+		FROM scheduled_workouts
+		INNER JOIN workouts ON workouts.id = scheduled_workouts.workout_id
+		WHERE scheduled_workouts.id = $1 AND scheduled_workouts.user_id = $2`
+
+	var entry ScheduleEntry
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(
+		&entry.ID,
+		&entry.CreatedAt,
+		&entry.UserID,
+		&entry.WorkoutID,
+		&entry.WorkoutName,
+		&entry.StartsAt,
+		&entry.DurationMinutes,
+		&entry.Timezone,
+		&entry.RRule,
+		&entry.Notes,
+		&entry.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &entry, nil
+}
+
+func (m ScheduleModel) Update(entry *ScheduleEntry) error {
+	query := `
+		UPDATE scheduled_workouts
+		SET workout_id = $1, starts_at = $2, duration_minutes = $3, timezone = $4, rrule = $5, notes = $6,
+		    version = version + 1
+		WHERE id = $7 AND version = $8 AND user_id = $9
+		RETURNING version`
+
+	args := []interface{}{
+		entry.WorkoutID,
+		entry.StartsAt,
+		entry.DurationMinutes,
+		entry.Timezone,
+		entry.RRule,
+		entry.Notes,
+		entry.ID,
+		entry.Version,
+		entry.UserID,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&entry.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m ScheduleModel) Delete(id int64, userID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM scheduled_workouts
+		WHERE id = $1 AND user_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetAll lists a page of the user's schedule entries as they were entered,
+// without expanding recurrences.
+func (m ScheduleModel) GetAll(userID int64, filters Filters) ([]*ScheduleEntry, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), scheduled_workouts.id, scheduled_workouts.created_at, scheduled_workouts.user_id,
+		       scheduled_workouts.workout_id, workouts.name, scheduled_workouts.starts_at,
+		       scheduled_workouts.duration_minutes, scheduled_workouts.timezone, scheduled_workouts.rrule,
+		       scheduled_workouts.notes, scheduled_workouts.version
+		FROM scheduled_workouts
+		INNER JOIN workouts ON workouts.id = scheduled_workouts.workout_id
+		WHERE scheduled_workouts.user_id = $1
+		ORDER BY scheduled_workouts.%s %s, scheduled_workouts.id ASC
+		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	entries := []*ScheduleEntry{}
+
+	for rows.Next() {
+		var entry ScheduleEntry
+
+		err := rows.Scan(
+			&totalRecords,
+			&entry.ID,
+			&entry.CreatedAt,
+			&entry.UserID,
+			&entry.WorkoutID,
+			&entry.WorkoutName,
+			&entry.StartsAt,
+			&entry.DurationMinutes,
+			&entry.Timezone,
+			&entry.RRule,
+			&entry.Notes,
+			&entry.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		entries = append(entries, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return entries, metadata, nil
+}
+
+// GetAllStartingBefore returns every entry of the user whose first occurrence
+// is before the given time; recurring entries are expanded by the caller. A
+// zero time returns all entries.
+func (m ScheduleModel) GetAllStartingBefore(userID int64, before time.Time) ([]*ScheduleEntry, error) {
+	query := `
+		SELECT scheduled_workouts.id, scheduled_workouts.created_at, scheduled_workouts.user_id,
+		       scheduled_workouts.workout_id, workouts.name, scheduled_workouts.starts_at,
+		       scheduled_workouts.duration_minutes, scheduled_workouts.timezone, scheduled_workouts.rrule,
+		       scheduled_workouts.notes, scheduled_workouts.version
+		FROM scheduled_workouts
+		INNER JOIN workouts ON workouts.id = scheduled_workouts.workout_id
+		WHERE scheduled_workouts.user_id = $1
+		AND ($2::timestamptz IS NULL OR scheduled_workouts.starts_at < $2)
+		ORDER BY scheduled_workouts.starts_at, scheduled_workouts.id`
+
+	var limit interface{}
+	if !before.IsZero() {
+		limit = before
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*ScheduleEntry{}
+
+	for rows.Next() {
+		var entry ScheduleEntry
+
+		err := rows.Scan(
+			&entry.ID,
+			&entry.CreatedAt,
+			&entry.UserID,
+			&entry.WorkoutID,
+			&entry.WorkoutName,
+			&entry.StartsAt,
+			&entry.DurationMinutes,
+			&entry.Timezone,
+			&entry.RRule,
+			&entry.Notes,
+			&entry.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,180 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRRule(t *testing.T) {
+	tests := []struct {
+		rule string
+		want string
+	}{
+		{"FREQ=DAILY", "FREQ=DAILY"},
+		{"RRULE:FREQ=WEEKLY;BYDAY=MO,WE,FR", "FREQ=WEEKLY;BYDAY=MO,WE,FR"},
+		{"  freq=weekly;interval=2;byday=tu  ", "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU"},
+		{"FREQ=MONTHLY;INTERVAL=1;COUNT=6", "FREQ=MONTHLY;COUNT=6"},
+		{"FREQ=DAILY;UNTIL=20240131T080000Z", "FREQ=DAILY;UNTIL=20240131T080000Z"},
+		{"FREQ=DAILY;UNTIL=20240131", "FREQ=DAILY;UNTIL=20240131T235959Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			rec, err := ParseRRule(tt.rule)
+			if err != nil {
+				t.Fatalf("ParseRRule returned error: %v", err)
+			}
+			if got := rec.String(); got != tt.want {
+				t.Errorf("ParseRRule(%q).String() = %q; want %q", tt.rule, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRRuleErrors(t *testing.T) {
+	tests := []struct {
+		rule string
+		want string
+	}{
+		{"", `malformed rule part ""`},
+		{"FREQ", `malformed rule part "FREQ"`},
+		{"INTERVAL=2", "FREQ must be provided"},
+		{"FREQ=YEARLY", `unsupported frequency "YEARLY"`},
+		{"FREQ=DAILY;INTERVAL=0", "INTERVAL must be between 1 and 52"},
+		{"FREQ=DAILY;INTERVAL=x", "INTERVAL must be between 1 and 52"},
+		{"FREQ=WEEKLY;BYDAY=XX", `unknown weekday "XX"`},
+		{"FREQ=DAILY;BYDAY=MO", "BYDAY is only supported with FREQ=WEEKLY"},
+		{"FREQ=DAILY;COUNT=5001", "COUNT must be between 1 and 5000"},
+		{"FREQ=DAILY;UNTIL=tomorrow", `malformed UNTIL "TOMORROW"`},
+		{"FREQ=DAILY;COUNT=2;UNTIL=20240131", "COUNT and UNTIL must not be combined"},
+		{"FREQ=DAILY;BYMONTH=1", `unsupported rule part "BYMONTH"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			_, err := ParseRRule(tt.rule)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("ParseRRule(%q) returned error %v; want %q", tt.rule, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleEntryOccurrences(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+
+	date := func(year int, month time.Month, day, hour int) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, berlin)
+	}
+
+	tests := []struct {
+		name     string
+		startsAt time.Time
+		rrule    string
+		from, to time.Time
+		want     []time.Time
+	}{
+		{
+			name:     "single",
+			startsAt: date(2024, 1, 3, 7),
+			from:     date(2024, 1, 1, 0),
+			to:       date(2024, 2, 1, 0),
+			want:     []time.Time{date(2024, 1, 3, 7)},
+		},
+		{
+			name:     "single outside the range",
+			startsAt: date(2024, 1, 3, 7),
+			from:     date(2024, 1, 4, 0),
+			to:       date(2024, 2, 1, 0),
+			want:     nil,
+		},
+		{
+			name:     "daily within the range",
+			startsAt: date(2024, 1, 1, 7),
+			rrule:    "FREQ=DAILY;INTERVAL=2",
+			from:     date(2024, 1, 4, 0),
+			to:       date(2024, 1, 10, 0),
+			want:     []time.Time{date(2024, 1, 5, 7), date(2024, 1, 7, 7), date(2024, 1, 9, 7)},
+		},
+		{
+			name:     "daily across a daylight saving change",
+			startsAt: date(2024, 3, 30, 7),
+			rrule:    "FREQ=DAILY;COUNT=3",
+			from:     date(2024, 3, 1, 0),
+			to:       date(2024, 5, 1, 0),
+			want:     []time.Time{date(2024, 3, 30, 7), date(2024, 3, 31, 7), date(2024, 4, 1, 7)},
+		},
+		{
+			name:     "weekly on several days, starting mid-week",
+			startsAt: date(2024, 1, 3, 18), // a Wednesday
+			rrule:    "FREQ=WEEKLY;BYDAY=MO,WE,FR",
+			from:     date(2024, 1, 1, 0),
+			to:       date(2024, 1, 10, 0),
+			want:     []time.Time{date(2024, 1, 3, 18), date(2024, 1, 5, 18), date(2024, 1, 8, 18)},
+		},
+		{
+			name:     "every other week",
+			startsAt: date(2024, 1, 2, 18),
+			rrule:    "FREQ=WEEKLY;INTERVAL=2;COUNT=3",
+			from:     date(2024, 1, 1, 0),
+			to:       date(2024, 12, 31, 0),
+			want:     []time.Time{date(2024, 1, 2, 18), date(2024, 1, 16, 18), date(2024, 1, 30, 18)},
+		},
+		{
+			name:     "monthly skips months without the day",
+			startsAt: date(2024, 1, 31, 9),
+			rrule:    "FREQ=MONTHLY;COUNT=3",
+			from:     date(2024, 1, 1, 0),
+			to:       date(2025, 1, 1, 0),
+			want:     []time.Time{date(2024, 1, 31, 9), date(2024, 3, 31, 9), date(2024, 5, 31, 9)},
+		},
+		{
+			name:     "until a date includes that day",
+			startsAt: date(2024, 1, 1, 20),
+			rrule:    "FREQ=DAILY;UNTIL=20240103",
+			from:     date(2024, 1, 1, 0),
+			to:       date(2024, 2, 1, 0),
+			want:     []time.Time{date(2024, 1, 1, 20), date(2024, 1, 2, 20), date(2024, 1, 3, 20)},
+		},
+		{
+			name:     "count counts occurrences before the range",
+			startsAt: date(2024, 1, 1, 7),
+			rrule:    "FREQ=DAILY;COUNT=5",
+			from:     date(2024, 1, 4, 0),
+			to:       date(2024, 2, 1, 0),
+			want:     []time.Time{date(2024, 1, 4, 7), date(2024, 1, 5, 7)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := &ScheduleEntry{
+				ID:              1,
+				WorkoutID:       2,
+				StartsAt:        tt.startsAt,
+				DurationMinutes: 45,
+				Timezone:        "Europe/Berlin",
+				RRule:           tt.rrule,
+			}
+
+			occurrences, err := entry.Occurrences(tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("Occurrences returned error: %v", err)
+			}
+			if len(occurrences) != len(tt.want) {
+				t.Fatalf("got %d occurrences; want %d", len(occurrences), len(tt.want))
+			}
+			for i, o := range occurrences {
+				if !o.StartsAt.Equal(tt.want[i]) {
+					t.Errorf("occurrence %d starts at %v; want %v", i, o.StartsAt, tt.want[i])
+				}
+				if d := o.EndsAt.Sub(o.StartsAt); d != 45*time.Minute {
+					t.Errorf("occurrence %d lasts %v; want 45m", i, d)
+				}
+			}
+		})
+	}
+}
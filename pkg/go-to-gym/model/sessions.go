@@ -0,0 +1,567 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/holydanchik/GoToGym/pkg/go-to-gym/validator"
+	"github.com/lib/pq"
+	"sort"
+	"strings"
+	"time"
+)
+
+type WorkoutSession struct {
+	ID             int64         `json:"id"`
+	CreatedAt      time.Time     `json:"-"`
+	UserID         int64         `json:"-"`
+	WorkoutID      int64         `json:"workout_id,omitempty"`
+	StartedAt      time.Time     `json:"started_at"`
+	FinishedAt     *time.Time    `json:"finished_at,omitempty"`
+	Notes          string        `json:"notes,omitempty"`
+	Distance       float64       `json:"distance_km,omitempty"`
+	CaloriesBurned *int          `json:"-"`
+	EnergyPerKg    float64       `json:"-"`
+	Calories       *Calories     `json:"calories,omitempty"`
+	Sets           []*SessionSet `json:"sets,omitempty"`
+	Version        int           `json:"version"`
+	ImportKey      string        `json:"-"`
+}
+
+func (s *WorkoutSession) IsFinished() bool {
+	return s.FinishedAt != nil
+}
+
+// SetCalories fills in Calories for someone weighing bodyweight kilograms,
+// preferring the manual override in CaloriesBurned.
+func (s *WorkoutSession) SetCalories(bodyweight float64) {
+	s.Calories = calories(s.CaloriesBurned, s.EnergyPerKg, bodyweight)
+}
+
+type SessionSet struct {
+	ID           int64     `json:"id"`
+	PerformedAt  time.Time `json:"performed_at"`
+	SessionID    int64     `json:"session_id"`
+	ExerciseID   int64     `json:"exercise_id,omitempty"`
+	ExerciseName string    `json:"exercise_name"`
+	Weight       float64   `json:"weight"`
+	Reps         int       `json:"reps"`
+	RPE          float64   `json:"rpe,omitempty"`
+	RestSeconds  int       `json:"rest_seconds,omitempty"`
+}
+
+// ValidateSession checks the fields a session can be saved with. The workout is
+// only required when the session starts, since deleting a workout leaves its
+// sessions without one.
+func ValidateSession(v *validator.Validator, s *WorkoutSession) {
+	v.Check(len(s.Notes) <= 1000, "notes", "must not be more than 1000 bytes long")
+	validateCaloriesOverride(v, s.CaloriesBurned)
+	if s.FinishedAt != nil {
+		v.Check(!s.FinishedAt.Before(s.StartedAt), "finished_at", "must not be before the session start")
+	}
+}
+
+func ValidateSessionSet(v *validator.Validator, set *SessionSet) {
+	v.Check(set.ExerciseID > 0, "exercise_id", "must be provided")
+	v.Check(set.Weight >= 0, "weight", "must be a non-negative value")
+	v.Check(set.Weight <= 10_000, "weight", "must not be more than 10000")
+	v.Check(set.Reps > 0, "reps", "must be greater than zero")
+	v.Check(set.Reps <= 1000, "reps", "must not be more than 1000")
+	v.Check(set.RPE >= 0 && set.RPE <= 10, "rpe", "must be between 0 and 10")
+	v.Check(set.RestSeconds >= 0, "rest_seconds", "must be a non-negative value")
+	v.Check(set.RestSeconds <= 3600, "rest_seconds", "must not be more than one hour")
+}
+
+type SessionModel struct {
+	DB *sql.DB
+}
+
+func (m SessionModel) Insert(session *WorkoutSession) error {
+	query := `
+		INSERT INTO workout_sessions (user_id, workout_id, notes)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, started_at, ` + sessionEnergySQL + `, version`
+
+	args := []interface{}{session.UserID, session.WorkoutID, session.Notes}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&session.ID, &session.CreatedAt, &session.StartedAt, &session.EnergyPerKg, &session.Version)
+}
+
+func (m SessionModel) Get(id int64, userID int64) (*WorkoutSession, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, created_at, user_id, COALESCE(workout_id, 0), started_at, finished_at, notes, distance_km,
+		       calories_burned, ` + sessionEnergySQL + `, version
+		FROM workout_sessions
+		WHERE id = $1 AND user_id = $2`
+
+	var session WorkoutSession
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(
+		&session.ID,
+		&session.CreatedAt,
+		&session.UserID,
+		&session.WorkoutID,
+		&session.StartedAt,
+		&session.FinishedAt,
+		&session.Notes,
+		&session.Distance,
+		&session.CaloriesBurned,
+		&session.EnergyPerKg,
+		&session.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &session, nil
+}
+
+func (m SessionModel) Update(session *WorkoutSession) error {
+	query := `
+		UPDATE workout_sessions
+		SET started_at = $1, finished_at = $2, notes = $3, calories_burned = $4, version = version + 1
+		WHERE id = $5 AND version = $6 AND user_id = $7
+		RETURNING ` + sessionEnergySQL + `, version`
+
+	args := []interface{}{
+		session.StartedAt,
+		session.FinishedAt,
+		session.Notes,
+		session.CaloriesBurned,
+		session.ID,
+		session.Version,
+		session.UserID,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&session.EnergyPerKg, &session.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m SessionModel) Delete(id int64, userID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM workout_sessions
+		WHERE id = $1 AND user_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetAll lists the user's sessions. A zero workoutID and nil from/to disable
+// the corresponding filter; from is inclusive and to is exclusive.
+func (m SessionModel) GetAll(userID int64, workoutID int64, from, to *time.Time, filters Filters) ([]*WorkoutSession, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, user_id, COALESCE(workout_id, 0), started_at, finished_at, notes,
+		       distance_km, calories_burned, %s, version
+		FROM workout_sessions
+		WHERE user_id = $1
+		AND (workout_id = $2 OR $2 = 0)
+		AND ($3::timestamptz IS NULL OR started_at >= $3)
+		AND ($4::timestamptz IS NULL OR started_at < $4)
+		ORDER BY %s %s, id ASC
+		LIMIT $5 OFFSET $6`, sessionEnergySQL, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{userID, workoutID, from, to, filters.limit(), filters.offset()}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	var sessions []*WorkoutSession
+
+	for rows.Next() {
+		var session WorkoutSession
+
+		err := rows.Scan(
+			&totalRecords,
+			&session.ID,
+			&session.CreatedAt,
+			&session.UserID,
+			&session.WorkoutID,
+			&session.StartedAt,
+			&session.FinishedAt,
+			&session.Notes,
+			&session.Distance,
+			&session.CaloriesBurned,
+			&session.EnergyPerKg,
+			&session.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		sessions = append(sessions, &session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return sessions, metadata, nil
+}
+
+// SessionImport is a finished session imported from another app. It belongs
+// to the user's workout with the name of Workout, or else to Workout created
+// with Exercises; exercises the workout lacks are appended. Sets are logged
+// against the exercise of their name.
+type SessionImport struct {
+	Session   *WorkoutSession
+	Workout   *Workout
+	Exercises []*Exercise
+	Sets      []*SessionSet
+	// Skipped is set by Import for a session that was imported before.
+	Skipped bool
+}
+
+// ImportedKeys returns which of the keys belong to sessions the user has
+// already imported.
+func (m SessionModel) ImportedKeys(userID int64, keys []string) (map[string]bool, error) {
+	query := `
+		SELECT import_key
+		FROM workout_sessions
+		WHERE user_id = $1 AND import_key = ANY($2)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, pq.Array(keys))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	imported := make(map[string]bool)
+	for rows.Next() {
+		var key string
+		err := rows.Scan(&key)
+		if err != nil {
+			return nil, err
+		}
+		imported[key] = true
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return imported, nil
+}
+
+// Import stores the sessions, all or nothing, skipping those whose ImportKey
+// was imported before. Personal records are detected for the imported sets in
+// the order they were performed, in the same transaction.
+func (m SessionModel) Import(imports []*SessionImport) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userID int64
+	var sets []*SessionSet
+
+	for _, imp := range imports {
+		session := imp.Session
+		userID = session.UserID
+
+		query := `
+			SELECT EXISTS (SELECT 1 FROM workout_sessions WHERE user_id = $1 AND import_key = $2)`
+
+		err = tx.QueryRowContext(ctx, query, session.UserID, session.ImportKey).Scan(&imp.Skipped)
+		if err != nil {
+			return err
+		}
+		if imp.Skipped {
+			continue
+		}
+
+		err = importWorkout(ctx, tx, imp)
+		if err != nil {
+			return err
+		}
+
+		query = `
+			INSERT INTO workout_sessions (user_id, workout_id, started_at, finished_at, notes, distance_km, calories_burned, import_key)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			RETURNING id, created_at, version`
+
+		session.WorkoutID = imp.Workout.ID
+		args := []interface{}{
+			session.UserID,
+			session.WorkoutID,
+			session.StartedAt,
+			session.FinishedAt,
+			session.Notes,
+			session.Distance,
+			session.CaloriesBurned,
+			session.ImportKey,
+		}
+
+		err = tx.QueryRowContext(ctx, query, args...).Scan(&session.ID, &session.CreatedAt, &session.Version)
+		if err != nil {
+			return err
+		}
+
+		query = `
+			INSERT INTO session_sets (session_id, exercise_id, exercise_name, weight, reps, rpe, rest_seconds, performed_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			RETURNING id, performed_at`
+
+		for _, set := range imp.Sets {
+			set.SessionID = session.ID
+			for _, exercise := range imp.Exercises {
+				if strings.EqualFold(exercise.Name, set.ExerciseName) {
+					set.ExerciseID = exercise.ID
+				}
+			}
+
+			args := []interface{}{
+				set.SessionID,
+				set.ExerciseID,
+				set.ExerciseName,
+				set.Weight,
+				set.Reps,
+				set.RPE,
+				set.RestSeconds,
+				set.PerformedAt,
+			}
+
+			err = tx.QueryRowContext(ctx, query, args...).Scan(&set.ID, &set.PerformedAt)
+			if err != nil {
+				return err
+			}
+			sets = append(sets, set)
+		}
+	}
+
+	sort.SliceStable(sets, func(i, j int) bool {
+		return sets[i].PerformedAt.Before(sets[j].PerformedAt)
+	})
+
+	for _, set := range sets {
+		_, err = detectRecords(ctx, tx, userID, set)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// importWorkout finds or creates the workout of an imported session and
+// fills in the IDs of its exercises. An existing workout that gains exercises
+// has its version bumped.
+func importWorkout(ctx context.Context, q Querier, imp *SessionImport) error {
+	query := `
+		SELECT id, created_at, version
+		FROM workouts
+		WHERE user_id = $1 AND lower(name) = lower($2)
+		ORDER BY id
+		LIMIT 1`
+
+	workout := imp.Workout
+	existed := true
+	err := q.QueryRowContext(ctx, query, workout.UserID, workout.Name).Scan(&workout.ID, &workout.CreatedAt, &workout.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		existed = false
+		err = insertWorkout(ctx, q, workout)
+	}
+	if err != nil {
+		return err
+	}
+
+	query = `
+		SELECT id, catalog_id
+		FROM exercises
+		WHERE workout_id = $1`
+
+	rows, err := q.QueryContext(ctx, query, workout.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	existing := make(map[int64]int64)
+	for rows.Next() {
+		var id, catalogID int64
+		err := rows.Scan(&id, &catalogID)
+		if err != nil {
+			return err
+		}
+		existing[catalogID] = id
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	added := false
+	for _, exercise := range imp.Exercises {
+		exercise.WorkoutID = int(workout.ID)
+		if id, ok := existing[exercise.CatalogID]; ok {
+			exercise.ID = id
+			continue
+		}
+		err = insertExercise(ctx, q, exercise)
+		if err != nil {
+			return err
+		}
+		existing[exercise.CatalogID] = exercise.ID
+		added = true
+	}
+
+	if existed && added {
+		return touchWorkout(ctx, q, workout)
+	}
+	return nil
+}
+
+// LogSet inserts a set the user performed and stores the personal records it
+// beats, in one transaction, and returns those records.
+func (m SessionModel) LogSet(userID int64, set *SessionSet) ([]*PersonalRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO session_sets (session_id, exercise_id, exercise_name, weight, reps, rpe, rest_seconds)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, performed_at`
+
+	args := []interface{}{
+		set.SessionID,
+		set.ExerciseID,
+		set.ExerciseName,
+		set.Weight,
+		set.Reps,
+		set.RPE,
+		set.RestSeconds,
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&set.ID, &set.PerformedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := detectRecords(ctx, tx, userID, set)
+	if err != nil {
+		return nil, err
+	}
+
+	return records, tx.Commit()
+}
+
+func (m SessionModel) GetAllSets(sessionID int64) ([]*SessionSet, error) {
+	query := `
+		SELECT id, performed_at, session_id, COALESCE(exercise_id, 0), exercise_name, weight, reps, rpe, rest_seconds
+		FROM session_sets
+		WHERE session_id = $1
+		ORDER BY id ASC`
+
+	return m.querySets(query, sessionID)
+}
+
+// GetLastSets returns the sets the user logged for an exercise in the most
+// recent session that contains it. Exercises are matched by name, like
+// personal records.
+func (m SessionModel) GetLastSets(userID int64, exerciseName string) ([]*SessionSet, error) {
+	query := `
+		SELECT id, performed_at, session_id, COALESCE(exercise_id, 0), exercise_name, weight, reps, rpe, rest_seconds
+		FROM session_sets
+		WHERE lower(exercise_name) = lower($2)
+		AND session_id = (
+			SELECT session_sets.session_id
+			FROM session_sets
+			INNER JOIN workout_sessions ON workout_sessions.id = session_sets.session_id
+			WHERE workout_sessions.user_id = $1 AND lower(session_sets.exercise_name) = lower($2)
+			ORDER BY workout_sessions.started_at DESC, session_sets.id DESC
+			LIMIT 1)
+		ORDER BY id ASC`
+
+	return m.querySets(query, userID, exerciseName)
+}
+
+func (m SessionModel) querySets(query string, args ...interface{}) ([]*SessionSet, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sets []*SessionSet
+
+	for rows.Next() {
+		var set SessionSet
+
+		err := rows.Scan(
+			&set.ID,
+			&set.PerformedAt,
+			&set.SessionID,
+			&set.ExerciseID,
+			&set.ExerciseName,
+			&set.Weight,
+			&set.Reps,
+			&set.RPE,
+			&set.RestSeconds,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, &set)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return sets, nil
+}
@@ -1,26 +1,53 @@
 package model
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base32"
+	"errors"
 	"github.com/holydanchik/GoToGym/pkg/go-to-gym/validator"
+	"github.com/lib/pq"
 	"time"
 )
 
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	ScopeCalendarFeed   = "calendar_feed"
+	ScopePasswordReset  = "password-reset"
+	ScopeRefresh        = "refresh"
+	ScopeCoachInvite    = "coach-invitation"
+	ScopeUnlock         = "unlock"
+	ScopeEmailChange    = "email-change"
 )
 
+// LoginScopes are the scopes of tokens that keep a user logged in: database
+// authentication tokens, or refresh tokens when signed access tokens are used.
+var LoginScopes = []string{ScopeAuthentication, ScopeRefresh}
+
 type Token struct {
 	Plaintext string    `json:"token"`
 	Hash      []byte    `json:"-"`
 	UserID    int64     `json:"-"`
 	Expiry    time.Time `json:"expiry"`
 	Scope     string    `json:"-"`
+	UserAgent string    `json:"-"`
+	IP        string    `json:"-"`
+}
+
+// LoginSession describes an authentication token without revealing it.
+type LoginSession struct {
+	ID         int64      `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Expiry     time.Time  `json:"expiry"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	Current    bool       `json:"current"`
+	Hash       []byte     `json:"-"`
 }
 
 func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
@@ -50,7 +77,8 @@ func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
 }
 
 type TokenModel struct {
-	DB *sql.DB
+	DB    *sql.DB
+	Cache *AuthCache
 }
 
 func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token, error) {
@@ -62,11 +90,27 @@ func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token,
 	return token, err
 }
 
+// NewForClient creates a token like New, recording the client it was issued
+// to so the user can recognise the login later.
+func (m TokenModel) NewForClient(userID int64, ttl time.Duration, scope, userAgent, ip string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+	if len(userAgent) > 500 {
+		userAgent = userAgent[:500]
+	}
+	token.UserAgent = userAgent
+	token.IP = ip
+	err = m.Insert(token)
+	return token, err
+}
+
 func (m TokenModel) Insert(token *Token) error {
 	query := `
-		INSERT INTO tokens (hash, user_id, expiry, scope)
-		VALUES ($1, $2, $3, $4)`
-	args := []interface{}{token.Hash, token.UserID, token.Expiry, token.Scope}
+		INSERT INTO tokens (hash, user_id, expiry, scope, user_agent, ip)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+	args := []interface{}{token.Hash, token.UserID, token.Expiry, token.Scope, token.UserAgent, token.IP}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	_, err := m.DB.ExecContext(ctx, query, args...)
@@ -80,5 +124,139 @@ func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	_, err := m.DB.ExecContext(ctx, query, scope, userID)
+	m.Cache.invalidateUser(userID)
+	return err
+}
+
+func (m TokenModel) Delete(scope, tokenPlaintext string) error {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	query := `
+		DELETE FROM tokens
+		WHERE scope = $1 AND hash = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, scope, tokenHash[:])
+	m.Cache.invalidateToken(scope, tokenHash[:])
+	return err
+}
+
+// DeleteOtherSessions deletes the user's login tokens except the one for
+// currentPlaintext, which is kept when it is one of them.
+func (m TokenModel) DeleteOtherSessions(userID int64, currentPlaintext string) error {
+	currentHash := sha256.Sum256([]byte(currentPlaintext))
+	query := `
+		DELETE FROM tokens
+		WHERE user_id = $1 AND scope = ANY($2) AND hash <> $3`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(LoginScopes), currentHash[:])
+	m.Cache.invalidateUser(userID)
 	return err
 }
+
+// Redeem deletes an unexpired token and returns the ID of its user, so that a
+// single-use token can be used only once even by concurrent requests. It
+// returns ErrRecordNotFound when there is no such token.
+func (m TokenModel) Redeem(scope, tokenPlaintext string) (int64, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	query := `
+		DELETE FROM tokens
+		WHERE scope = $1 AND hash = $2 AND expiry > NOW()
+		RETURNING user_id`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var userID int64
+	err := m.DB.QueryRowContext(ctx, query, scope, tokenHash[:]).Scan(&userID)
+	m.Cache.invalidateToken(scope, tokenHash[:])
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+	return userID, nil
+}
+
+// GetAllSessionsForUser returns the user's unexpired login tokens,
+// most recently used first. The one for currentPlaintext is marked current.
+func (m TokenModel) GetAllSessionsForUser(userID int64, currentPlaintext string) ([]*LoginSession, error) {
+	query := `
+		SELECT id, created_at, last_used_at, expiry, user_agent, ip, hash
+		FROM tokens
+		WHERE user_id = $1 AND scope = ANY($2) AND expiry > NOW()
+		ORDER BY COALESCE(last_used_at, created_at) DESC, id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, pq.Array(LoginScopes))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	currentHash := sha256.Sum256([]byte(currentPlaintext))
+
+	sessions := []*LoginSession{}
+	for rows.Next() {
+		var session LoginSession
+		err := rows.Scan(
+			&session.ID,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.Expiry,
+			&session.UserAgent,
+			&session.IP,
+			&session.Hash,
+		)
+		if err != nil {
+			return nil, err
+		}
+		session.Current = bytes.Equal(session.Hash, currentHash[:])
+		sessions = append(sessions, &session)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (m TokenModel) DeleteSession(id, userID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM tokens
+		WHERE id = $1 AND user_id = $2 AND scope = ANY($3)`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id, userID, pq.Array(LoginScopes))
+	m.Cache.invalidateUser(userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteExpired removes every expired token and returns how many there were.
+func (m TokenModel) DeleteExpired() (int64, error) {
+	query := `
+		DELETE FROM tokens
+		WHERE expiry < NOW()`
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,72 @@
+package model
+
+import "math"
+
+const (
+	UnitsMetric   = "metric"
+	UnitsImperial = "imperial"
+
+	UnitKilograms   = "kg"
+	UnitPounds      = "lb"
+	UnitKilometers  = "km"
+	UnitMiles       = "mi"
+	UnitCentimeters = "cm"
+	UnitInches      = "in"
+	UnitPercent     = "%"
+)
+
+const (
+	kilogramsPerPound  = 0.45359237
+	kilometersPerMile  = 1.609344
+	centimetersPerInch = 2.54
+)
+
+func convertWeight(value float64, from, to string) float64 {
+	switch {
+	case from == UnitPounds && to == UnitKilograms:
+		return round2(value * kilogramsPerPound)
+	case from == UnitKilograms && to == UnitPounds:
+		return round2(value / kilogramsPerPound)
+	}
+	return value
+}
+
+func convertDistance(value float64, from, to string) float64 {
+	switch {
+	case from == UnitMiles && to == UnitKilometers:
+		return round2(value * kilometersPerMile)
+	case from == UnitKilometers && to == UnitMiles:
+		return round2(value / kilometersPerMile)
+	}
+	return value
+}
+
+func convertLength(value float64, from, to string) float64 {
+	switch {
+	case from == UnitInches && to == UnitCentimeters:
+		return round2(value * centimetersPerInch)
+	case from == UnitCentimeters && to == UnitInches:
+		return round2(value / centimetersPerInch)
+	}
+	return value
+}
+
+// ToKilograms converts a weight given in the unit system to kilograms.
+func ToKilograms(value float64, system string) float64 {
+	if system == UnitsImperial {
+		return value * kilogramsPerPound
+	}
+	return value
+}
+
+// ToKilometers converts a distance given in the unit system to kilometres.
+func ToKilometers(value float64, system string) float64 {
+	if system == UnitsImperial {
+		return value * kilometersPerMile
+	}
+	return value
+}
+
+func round2(value float64) float64 {
+	return math.Round(value*100) / 100
+}
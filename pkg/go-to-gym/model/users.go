@@ -18,13 +18,14 @@ var (
 var AnonymousUser = &User{}
 
 type User struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	Password  password  `json:"-"`
-	Activated bool      `json:"activated"`
-	Version   int       `json:"-"`
+	ID          int64      `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Name        string     `json:"name"`
+	Email       string     `json:"email"`
+	Password    password   `json:"-"`
+	Activated   bool       `json:"activated"`
+	DeleteAfter *time.Time `json:"delete_after,omitempty"`
+	Version     int        `json:"version"`
 }
 
 func (u *User) IsAnonymous() bool {
@@ -84,7 +85,8 @@ func ValidateUser(v *validator.Validator, user *User) {
 }
 
 type UserModel struct {
-	DB *sql.DB
+	DB    *sql.DB
+	Cache *AuthCache
 }
 
 func (m UserModel) Insert(user *User) error {
@@ -107,9 +109,41 @@ func (m UserModel) Insert(user *User) error {
 	return nil
 }
 
+func (m UserModel) GetByID(id int64) (*User, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, created_at, name, email, password_hash, activated, delete_after, version
+		FROM users
+		WHERE id = $1`
+	var user User
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.DeleteAfter,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
 func (m UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-		SELECT id, created_at, name, email, password_hash, activated, version
+		SELECT id, created_at, name, email, password_hash, activated, delete_after, version
 		FROM users
 		WHERE email = $1`
 	var user User
@@ -122,6 +156,7 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.DeleteAfter,
 		&user.Version,
 	)
 	if err != nil {
@@ -152,6 +187,7 @@ func (m UserModel) Update(user *User) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
+	m.Cache.invalidateUser(user.ID)
 	if err != nil {
 		switch {
 		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
@@ -165,10 +201,29 @@ func (m UserModel) Update(user *User) error {
 	return nil
 }
 
+// GetForToken returns the user a token belongs to. Looking up an
+// authentication token also records that it was used, at most once a minute,
+// and the result is cached.
 func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error) {
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	if tokenScope == ScopeAuthentication {
+		if user, ok := m.Cache.getUser(tokenScope, tokenHash[:]); ok {
+			return user, nil
+		}
+	}
+
 	query := `
-		SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+		WITH touched AS (
+			UPDATE tokens
+			SET last_used_at = NOW()
+			WHERE hash = $1
+			AND scope = $2
+			AND expiry > $3
+			AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+		)
+		SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated,
+		       users.delete_after, users.version, tokens.expiry
 		FROM users
 		INNER JOIN tokens
 		ON users.id = tokens.user_id
@@ -178,6 +233,7 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 
 	args := []interface{}{tokenHash[:], tokenScope, time.Now()}
 	var user User
+	var expiry time.Time
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -188,7 +244,9 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.DeleteAfter,
 		&user.Version,
+		&expiry,
 	)
 	if err != nil {
 		switch {
@@ -199,5 +257,162 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 		}
 	}
 
+	if tokenScope == ScopeAuthentication {
+		m.Cache.setUser(tokenScope, tokenHash[:], &user, expiry)
+	}
 	return &user, nil
 }
+
+// SetPendingEmail stores the address a user wants to change to until they
+// confirm it with ConfirmEmail.
+func (m UserModel) SetPendingEmail(id int64, email string) error {
+	query := `
+		UPDATE users
+		SET pending_email = $2
+		WHERE id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, id, email)
+	return err
+}
+
+// ConfirmEmail switches the user to their pending address.
+func (m UserModel) ConfirmEmail(user *User) error {
+	query := `
+		UPDATE users
+		SET email = pending_email, pending_email = NULL, version = version + 1
+		WHERE id = $1 AND pending_email IS NOT NULL
+		RETURNING email, version`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, user.ID).Scan(&user.Email, &user.Version)
+	m.Cache.invalidateUser(user.ID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+			return ErrDuplicateEmail
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// SetDeleteAfter schedules the user's account for deletion, or cancels the
+// deletion when deleteAfter is nil.
+func (m UserModel) SetDeleteAfter(user *User, deleteAfter *time.Time) error {
+	query := `
+		UPDATE users
+		SET delete_after = $1, version = version + 1
+		WHERE id = $2 AND version = $3
+		RETURNING delete_after, version`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, deleteAfter, user.ID, user.Version).Scan(&user.DeleteAfter, &user.Version)
+	m.Cache.invalidateUser(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete deletes a user with everything they own. Their shared and public
+// workouts are kept without an owner, like the seeded library workouts, so
+// other users' sessions, schedules and programs still find them.
+func (m UserModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE workouts
+		SET user_id = NULL
+		WHERE user_id = $1 AND visibility IN ('shared', 'public')`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE exercises
+		SET user_id = NULL
+		FROM workouts
+		WHERE exercises.workout_id = workouts.id
+		AND workouts.user_id IS NULL
+		AND exercises.user_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	err = tx.Commit()
+	m.Cache.invalidateUser(id)
+	return err
+}
+
+// DeleteScheduled deletes the accounts whose grace period has run out and
+// returns how many it deleted.
+func (m UserModel) DeleteScheduled() (int64, error) {
+	query := `
+		SELECT id
+		FROM users
+		WHERE delete_after <= NOW()`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var count int64
+	for _, id := range ids {
+		err := m.Delete(id)
+		if err != nil && !errors.Is(err, ErrRecordNotFound) {
+			return count, err
+		}
+		if err == nil {
+			count++
+		}
+	}
+	return count, nil
+}
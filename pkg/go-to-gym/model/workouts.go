@@ -10,62 +10,179 @@ import (
 	"time"
 )
 
+const (
+	VisibilityPrivate = "private"
+	VisibilityShared  = "shared"
+	VisibilityPublic  = "public"
+)
+
 type Workout struct {
 	ID             int64     `json:"id"`
 	CreatedAt      time.Time `json:"-"`
+	UserID         int64     `json:"user_id,omitempty"`
 	Name           string    `json:"name"`
 	Description    string    `json:"description,omitempty"`
 	Exercises      []string  `json:"exercises"`
-	CaloriesBurned int       `json:"calories_burned,omitempty"`
+	CatalogIDs     []int64   `json:"catalog_ids"`
+	CaloriesBurned *int      `json:"-"`
+	EnergyPerKg    float64   `json:"-"`
+	Calories       *Calories `json:"calories,omitempty"`
+	Visibility     string    `json:"visibility"`
 	Version        int       `json:"version"`
 }
 
+// IsOwnedBy reports whether the workout belongs to the given user. Seeded
+// library workouts have no owner and can't be changed through the API.
+func (w *Workout) IsOwnedBy(user *User) bool {
+	return w.UserID != 0 && w.UserID == user.ID
+}
+
+// SetCalories fills in Calories for someone weighing bodyweight kilograms.
+// CaloriesBurned holds the owner's manual override; without one the calories
+// are estimated from EnergyPerKg.
+func (w *Workout) SetCalories(bodyweight float64) {
+	w.Calories = calories(w.CaloriesBurned, w.EnergyPerKg, bodyweight)
+}
+
 func ValidateWorkout(v *validator.Validator, w *Workout) {
 	v.Check(w.Name != "", "name", "must be provided")
 	v.Check(len(w.Name) <= 100, "name", "must not be more than 100 characters long")
-	v.Check(len(w.Exercises) > 0, "exercises", "at least one exercise must be provided")
-	v.Check(w.CaloriesBurned >= 0, "calories_burned", "must be a non-negative value")
+	v.Check(len(w.CatalogIDs) > 0, "exercises", "at least one exercise must be provided")
+	validateCaloriesOverride(v, w.CaloriesBurned)
+	v.Check(validator.In(w.Visibility, VisibilityPrivate, VisibilityShared, VisibilityPublic), "visibility", "must be one of private, shared or public")
 }
 
 type WorkoutModel struct {
 	DB *sql.DB
 }
 
-func (m WorkoutModel) Insert(workout *Workout) error {
+// Insert creates the workout together with its exercises, in one
+// transaction. Without exercises it gets one exercises row per entry in
+// CatalogIDs, which start without a prescription.
+func (m WorkoutModel) Insert(workout *Workout, exercises ...*Exercise) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertWorkout(ctx, tx, workout)
+	if err != nil {
+		return err
+	}
+
+	err = setWorkoutExercises(ctx, tx, workout, exercises)
+	if err != nil {
+		return err
+	}
+
+	err = loadWorkoutEnergy(ctx, tx, workout)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func insertWorkout(ctx context.Context, q Querier, workout *Workout) error {
 	query := `
-		INSERT INTO workouts (name, description, exercises, calories_burned)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO workouts (user_id, name, description, calories_burned, visibility)
+		VALUES (NULLIF($1, 0), $2, $3, $4, $5)
 		RETURNING id, created_at, version`
 
-	args := []interface{}{workout.Name, workout.Description, pq.Array(workout.Exercises), workout.CaloriesBurned}
+	args := []interface{}{
+		workout.UserID,
+		workout.Name,
+		workout.Description,
+		workout.CaloriesBurned,
+		workout.Visibility,
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	return q.QueryRowContext(ctx, query, args...).Scan(&workout.ID, &workout.CreatedAt, &workout.Version)
+}
+
+// WorkoutImport is a workout with exercises to append to it. A workout
+// without an ID is created first.
+type WorkoutImport struct {
+	Workout   *Workout
+	Exercises []*Exercise
+}
+
+// Import creates the new workouts and appends the exercises, all or nothing,
+// bumping the version of existing workouts that gain exercises. Unlike Insert
+// it doesn't add exercises for the workouts' CatalogIDs.
+func (m WorkoutModel) Import(imports []*WorkoutImport) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&workout.ID, &workout.CreatedAt, &workout.Version)
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, imp := range imports {
+		existed := imp.Workout.ID != 0
+		if !existed {
+			err = insertWorkout(ctx, tx, imp.Workout)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, exercise := range imp.Exercises {
+			exercise.WorkoutID = int(imp.Workout.ID)
+			err = insertExercise(ctx, tx, exercise)
+			if err != nil {
+				return err
+			}
+		}
+
+		if existed && len(imp.Exercises) > 0 {
+			err = touchWorkout(ctx, tx, imp.Workout)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
 }
 
-func (m WorkoutModel) Get(id int64) (*Workout, error) {
+// Get returns the workout if the user owns it, it is shared or public, or the
+// user's coach assigned it to them.
+func (m WorkoutModel) Get(id int64, userID int64) (*Workout, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 	query := `
-		SELECT id, created_at, name, description, exercises, calories_burned, version
+		SELECT id, created_at, COALESCE(user_id, 0), name, description,
+		       ARRAY(SELECT exercises.name FROM exercises WHERE exercises.workout_id = workouts.id ORDER BY exercises.position, exercises.id),
+		       ARRAY(SELECT exercises.catalog_id FROM exercises WHERE exercises.workout_id = workouts.id ORDER BY exercises.position, exercises.id),
+		       calories_burned, ` + workoutEnergySQL + `, visibility, version
 		FROM workouts
-		WHERE id = $1`
+		WHERE id = $1
+		AND (user_id = $2 OR visibility IN ('shared', 'public') OR id IN (` + assignedWorkoutsSQL() + `))`
 
 	var workout Workout
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(
 		&workout.ID,
 		&workout.CreatedAt,
+		&workout.UserID,
 		&workout.Name,
 		&workout.Description,
 		pq.Array(&workout.Exercises),
+		pq.Array(&workout.CatalogIDs),
 		&workout.CaloriesBurned,
+		&workout.EnergyPerKg,
+		&workout.Visibility,
 		&workout.Version,
 	)
 
@@ -80,24 +197,36 @@ func (m WorkoutModel) Get(id int64) (*Workout, error) {
 	return &workout, nil
 }
 
-func (m WorkoutModel) Update(workout *Workout) error {
+// Update saves the workout together with its exercises, in one transaction.
+// Without exercises it brings its exercises rows in line with CatalogIDs:
+// rows for entries that are no longer listed are removed, rows for new
+// entries are added and the remaining rows keep their prescriptions.
+func (m WorkoutModel) Update(workout *Workout, exercises ...*Exercise) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `
 		UPDATE workouts
-		SET name = $1, description = $2, exercises = $3, calories_burned = $4, version = version + 1
-		WHERE id = $5 AND version = $6
+		SET name = $1, description = $2, calories_burned = $3, visibility = $4, version = version + 1
+		WHERE id = $5 AND version = $6 AND user_id = $7
 		RETURNING version`
 
 	args := []interface{}{
 		workout.Name,
 		workout.Description,
-		pq.Array(workout.Exercises),
 		workout.CaloriesBurned,
+		workout.Visibility,
 		workout.ID,
 		workout.Version,
+		workout.UserID,
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&workout.Version)
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&workout.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -106,19 +235,188 @@ func (m WorkoutModel) Update(workout *Workout) error {
 			return err
 		}
 	}
-	return nil
+
+	err = setWorkoutExercises(ctx, tx, workout, exercises)
+	if err != nil {
+		return err
+	}
+
+	err = loadWorkoutEnergy(ctx, tx, workout)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (m WorkoutModel) Delete(id int64) error {
+// loadWorkoutEnergy reads the energy per kilogram of bodyweight of the workout's
+// saved exercises, for SetCalories.
+func loadWorkoutEnergy(ctx context.Context, q Querier, workout *Workout) error {
+	query := `SELECT ` + workoutEnergySQL + ` FROM workouts WHERE id = $1`
+
+	return q.QueryRowContext(ctx, query, workout.ID).Scan(&workout.EnergyPerKg)
+}
+
+// setWorkoutExercises saves the exercises of a workout, or syncs its rows with
+// CatalogIDs when there are none.
+func setWorkoutExercises(ctx context.Context, q Querier, workout *Workout, exercises []*Exercise) error {
+	if len(exercises) == 0 {
+		return syncWorkoutExercises(ctx, q, workout)
+	}
+	return saveWorkoutExercises(ctx, q, workout, exercises)
+}
+
+// saveWorkoutExercises makes exercises the workout's exercises in program
+// order. Those with an ID are updated and the others inserted; any other
+// exercises of the workout are deleted.
+func saveWorkoutExercises(ctx context.Context, q Querier, workout *Workout, exercises []*Exercise) error {
+	keep := []int64{}
+	for _, exercise := range exercises {
+		if exercise.ID != 0 {
+			keep = append(keep, exercise.ID)
+		}
+	}
+
+	_, err := q.ExecContext(ctx, `DELETE FROM exercises WHERE workout_id = $1 AND NOT (id = ANY($2))`, workout.ID, pq.Array(keep))
+	if err != nil {
+		return err
+	}
+
+	for i, exercise := range exercises {
+		exercise.WorkoutID = int(workout.ID)
+		if exercise.ID == 0 {
+			err = insertExercise(ctx, q, exercise)
+		} else {
+			err = updateExercise(ctx, q, exercise)
+		}
+		if err != nil {
+			return err
+		}
+
+		if exercise.Position != i+1 {
+			exercise.Position = i + 1
+			_, err = q.ExecContext(ctx, `UPDATE exercises SET position = $1 WHERE id = $2`, exercise.Position, exercise.ID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return loadWorkoutExercises(ctx, q, workout)
+}
+
+func syncWorkoutExercises(ctx context.Context, q Querier, workout *Workout) error {
+	rows, err := q.QueryContext(ctx, `SELECT id, catalog_id FROM exercises WHERE workout_id = $1 ORDER BY position, id`, workout.ID)
+	if err != nil {
+		return err
+	}
+
+	wanted := make(map[int64]int)
+	for _, catalogID := range workout.CatalogIDs {
+		wanted[catalogID]++
+	}
+
+	var stale []int64
+	for rows.Next() {
+		var id, catalogID int64
+		err := rows.Scan(&id, &catalogID)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		if wanted[catalogID] > 0 {
+			wanted[catalogID]--
+		} else {
+			stale = append(stale, id)
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if len(stale) > 0 {
+		_, err = q.ExecContext(ctx, `DELETE FROM exercises WHERE id = ANY($1)`, pq.Array(stale))
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `
+		INSERT INTO exercises (user_id, name, sets, reps, workout_id, catalog_id, position)
+		SELECT NULLIF($1, 0), name, 0, 0, $2, id,
+		       (SELECT COALESCE(MAX(position), 0) + 1 FROM exercises WHERE workout_id = $2)
+		FROM catalog_exercises
+		WHERE id = $3`
+
+	for _, catalogID := range workout.CatalogIDs {
+		if wanted[catalogID] == 0 {
+			continue
+		}
+		wanted[catalogID]--
+		_, err = q.ExecContext(ctx, query, workout.UserID, workout.ID, catalogID)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The order of CatalogIDs is the program order, so the rows are renumbered
+	// to follow it.
+	rows, err = q.QueryContext(ctx, `SELECT id, catalog_id FROM exercises WHERE workout_id = $1 ORDER BY position, id`, workout.ID)
+	if err != nil {
+		return err
+	}
+
+	byCatalogID := make(map[int64][]int64)
+	for rows.Next() {
+		var id, catalogID int64
+		err := rows.Scan(&id, &catalogID)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		byCatalogID[catalogID] = append(byCatalogID[catalogID], id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for i, catalogID := range workout.CatalogIDs {
+		ids := byCatalogID[catalogID]
+		if len(ids) == 0 {
+			continue
+		}
+		byCatalogID[catalogID] = ids[1:]
+		_, err = q.ExecContext(ctx, `UPDATE exercises SET position = $1 WHERE id = $2 AND position <> $1`, i+1, ids[0])
+		if err != nil {
+			return err
+		}
+	}
+
+	return loadWorkoutExercises(ctx, q, workout)
+}
+
+// loadWorkoutExercises reads back the names and catalog IDs of the workout's
+// exercises.
+func loadWorkoutExercises(ctx context.Context, q Querier, workout *Workout) error {
+	query := `
+		SELECT ARRAY(SELECT name FROM exercises WHERE workout_id = $1 ORDER BY position, id),
+		       ARRAY(SELECT catalog_id FROM exercises WHERE workout_id = $1 ORDER BY position, id)`
+
+	return q.QueryRowContext(ctx, query, workout.ID).Scan(pq.Array(&workout.Exercises), pq.Array(&workout.CatalogIDs))
+}
+
+func (m WorkoutModel) Delete(id int64, userID int64) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 	query := `
 		DELETE FROM workouts
-		WHERE id = $1`
+		WHERE id = $1 AND user_id = $2`
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	result, err := m.DB.ExecContext(ctx, query, id)
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
 	if err != nil {
 		return err
 	}
@@ -132,21 +430,40 @@ func (m WorkoutModel) Delete(id int64) error {
 	return nil
 }
 
-func (m WorkoutModel) GetAll(name string, exercises []string, from, to int, filters Filters) ([]*Workout, Metadata, error) {
+// GetAll lists the user's own workouts together with everyone's public ones.
+// Shared workouts are only reachable by ID and are never listed to others.
+// The exercises filter expects lower-case exercise names. The calorie range
+// and the calories_burned sort use the calories for the given bodyweight.
+func (m WorkoutModel) GetAll(userID int64, bodyweight float64, name string, exercises []string, from, to int, filters Filters) ([]*Workout, Metadata, error) {
+	if bodyweight <= 0 {
+		bodyweight = ReferenceBodyweight
+	}
+
+	sortColumn := filters.sortColumn()
+	if sortColumn == "calories_burned" {
+		sortColumn = "COALESCE(calories_burned, ROUND(energy_per_kg * $8))"
+	}
+
 	query := fmt.Sprintf(`
-		SELECT count(*) OVER(), id, created_at, name, description, exercises, calories_burned, version
-		FROM workouts
-		WHERE (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '')
-		AND (exercises @> $2 OR $2 = '{}')
-		AND (calories_burned >= $3 OR $3 = 0)
-		AND (calories_burned <= $4 OR $4 = 0)
+		SELECT count(*) OVER(), id, created_at, user_id, name, description, exercise_names, catalog_ids,
+		       calories_burned, energy_per_kg, visibility, version
+		FROM (SELECT id, created_at, COALESCE(user_id, 0) AS user_id, name, description,
+		             ARRAY(SELECT exercises.name FROM exercises WHERE exercises.workout_id = workouts.id ORDER BY exercises.position, exercises.id) AS exercise_names,
+		             ARRAY(SELECT exercises.catalog_id FROM exercises WHERE exercises.workout_id = workouts.id ORDER BY exercises.position, exercises.id) AS catalog_ids,
+		             calories_burned, %s AS energy_per_kg, visibility, version
+		      FROM workouts
+		      WHERE (user_id = $1 OR visibility = 'public')
+		      AND (to_tsvector('simple', name) @@ plainto_tsquery('simple', $2) OR $2 = '')
+		      AND (ARRAY(SELECT lower(exercises.name) FROM exercises WHERE exercises.workout_id = workouts.id) @> $3 OR $3 = '{}')) AS workouts
+		WHERE (COALESCE(calories_burned, ROUND(energy_per_kg * $8)) >= $4 OR $4 = 0)
+		AND (COALESCE(calories_burned, ROUND(energy_per_kg * $8)) <= $5 OR $5 = 0)
 		ORDER BY %s %s, id ASC
-		LIMIT $5 OFFSET $6`, filters.sortColumn(), filters.sortDirection())
+		LIMIT $6 OFFSET $7`, workoutEnergySQL, sortColumn, filters.sortDirection())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []interface{}{name, pq.Array(exercises), from, to, filters.limit(), filters.offset()}
+	args := []interface{}{userID, name, pq.Array(exercises), from, to, filters.limit(), filters.offset(), bodyweight}
 
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -165,10 +482,14 @@ func (m WorkoutModel) GetAll(name string, exercises []string, from, to int, filt
 			&totalRecords,
 			&workout.ID,
 			&workout.CreatedAt,
+			&workout.UserID,
 			&workout.Name,
 			&workout.Description,
 			pq.Array(&workout.Exercises),
+			pq.Array(&workout.CatalogIDs),
 			&workout.CaloriesBurned,
+			&workout.EnergyPerKg,
+			&workout.Visibility,
 			&workout.Version,
 		)
 		if err != nil {
@@ -13,3 +13,11 @@ VALUES (
            (SELECT id FROM permissions WHERE code = 'workouts:write')
        );
 
+
+
+--- make someone an admin, so they can manage roles and permissions through the API
+INSERT INTO users_roles
+VALUES (
+           (SELECT id FROM users WHERE email = 'admin@example.com'),
+           (SELECT id FROM roles WHERE code = 'admin')
+       );
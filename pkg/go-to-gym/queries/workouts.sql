@@ -1,37 +1,104 @@
-INSERT INTO workouts (name, description, exercises, calories_burned)
-VALUES ('Full Body Strength Training',
-        'This workout targets all major muscle groups to build strength and endurance.',
-        ARRAY ['Squats', 'Push-ups', 'Rows', 'Lunges', 'Overhead press'],
-        400);
+WITH workout AS (
+    INSERT INTO workouts (name, description, calories_burned, visibility)
+        VALUES ('Full Body Strength Training',
+                'This workout targets all major muscle groups to build strength and endurance.',
+                400,
+                'public')
+        RETURNING id)
+INSERT
+INTO exercises (name, sets, reps, workout_id, catalog_id)
+SELECT catalog_exercises.name, 0, 0, workout.id, catalog_exercises.id
+FROM workout,
+     unnest(ARRAY ['Squats', 'Push-ups', 'Rows', 'Lunges', 'Overhead press']) WITH ORDINALITY AS names(name, position)
+         INNER JOIN catalog_exercises
+                    ON lower(catalog_exercises.name) = lower(names.name)
+                        OR lower(names.name) IN (SELECT lower(alias) FROM unnest(catalog_exercises.aliases) AS alias)
+ORDER BY names.position;
 
-INSERT INTO workouts (name, description, exercises, calories_burned)
-VALUES ('Cardio HIIT',
-        'High-Intensity Interval Training to improve cardiovascular health and burn calories.',
-        ARRAY ['Jumping jacks', 'Burpees', 'Mountain climbers', 'High knees', 'Jumping rope'],
-        350);
+WITH workout AS (
+    INSERT INTO workouts (name, description, calories_burned, visibility)
+        VALUES ('Cardio HIIT',
+                'High-Intensity Interval Training to improve cardiovascular health and burn calories.',
+                350,
+                'public')
+        RETURNING id)
+INSERT
+INTO exercises (name, sets, reps, workout_id, catalog_id)
+SELECT catalog_exercises.name, 0, 0, workout.id, catalog_exercises.id
+FROM workout,
+     unnest(ARRAY ['Jumping jacks', 'Burpees', 'Mountain climbers', 'High knees', 'Jumping rope']) WITH ORDINALITY AS names(name, position)
+         INNER JOIN catalog_exercises
+                    ON lower(catalog_exercises.name) = lower(names.name)
+                        OR lower(names.name) IN (SELECT lower(alias) FROM unnest(catalog_exercises.aliases) AS alias)
+ORDER BY names.position;
 
-INSERT INTO workouts (name, description, exercises, calories_burned)
-VALUES ('Yoga for Flexibility',
-        'A gentle yoga flow to improve flexibility, balance, and core strength.',
-        ARRAY ['Downward-Facing Dog', 'Warrior Pose', 'Triangle Pose', 'Cat-Cow', 'Childs Pose'],
-        250);
+WITH workout AS (
+    INSERT INTO workouts (name, description, calories_burned, visibility)
+        VALUES ('Yoga for Flexibility',
+                'A gentle yoga flow to improve flexibility, balance, and core strength.',
+                250,
+                'public')
+        RETURNING id)
+INSERT
+INTO exercises (name, sets, reps, workout_id, catalog_id)
+SELECT catalog_exercises.name, 0, 0, workout.id, catalog_exercises.id
+FROM workout,
+     unnest(ARRAY ['Downward-Facing Dog', 'Warrior Pose', 'Triangle Pose', 'Cat-Cow', 'Childs Pose']) WITH ORDINALITY AS names(name, position)
+         INNER JOIN catalog_exercises
+                    ON lower(catalog_exercises.name) = lower(names.name)
+                        OR lower(names.name) IN (SELECT lower(alias) FROM unnest(catalog_exercises.aliases) AS alias)
+ORDER BY names.position;
 
-INSERT INTO workouts (name, description, exercises, calories_burned)
-VALUES ('Back and Bicep Burner',
-        'Target your back and biceps with this intense workout.',
-        ARRAY ['Pull-ups', 'Rows', 'Bicep curls', 'Hammer curls'],
-        300);
+WITH workout AS (
+    INSERT INTO workouts (name, description, calories_burned, visibility)
+        VALUES ('Back and Bicep Burner',
+                'Target your back and biceps with this intense workout.',
+                300,
+                'public')
+        RETURNING id)
+INSERT
+INTO exercises (name, sets, reps, workout_id, catalog_id)
+SELECT catalog_exercises.name, 0, 0, workout.id, catalog_exercises.id
+FROM workout,
+     unnest(ARRAY ['Pull-ups', 'Rows', 'Bicep curls', 'Hammer curls']) WITH ORDINALITY AS names(name, position)
+         INNER JOIN catalog_exercises
+                    ON lower(catalog_exercises.name) = lower(names.name)
+                        OR lower(names.name) IN (SELECT lower(alias) FROM unnest(catalog_exercises.aliases) AS alias)
+ORDER BY names.position;
 
-INSERT INTO workouts (name, description, exercises, calories_burned)
-VALUES ('Legs and Core Challenge',
-        'Strengthen your legs and core with this effective workout.',
-        ARRAY ['Squats', 'Lunges', 'Leg press', 'Plank', 'Crunches'],
-        275);
+WITH workout AS (
+    INSERT INTO workouts (name, description, calories_burned, visibility)
+        VALUES ('Legs and Core Challenge',
+                'Strengthen your legs and core with this effective workout.',
+                275,
+                'public')
+        RETURNING id)
+INSERT
+INTO exercises (name, sets, reps, workout_id, catalog_id)
+SELECT catalog_exercises.name, 0, 0, workout.id, catalog_exercises.id
+FROM workout,
+     unnest(ARRAY ['Squats', 'Lunges', 'Leg press', 'Plank', 'Crunches']) WITH ORDINALITY AS names(name, position)
+         INNER JOIN catalog_exercises
+                    ON lower(catalog_exercises.name) = lower(names.name)
+                        OR lower(names.name) IN (SELECT lower(alias) FROM unnest(catalog_exercises.aliases) AS alias)
+ORDER BY names.position;
 
-INSERT INTO workouts (name, description, exercises, calories_burned)
-VALUES ('Full Body Cardio Blast',
-        'Get your heart rate up and burn calories with this full-body cardio workout.',
-        ARRAY ['Jumping jacks', 'Burpees', 'High knees', 'Mountain climbers', 'Running in place'],
-        450);
+WITH workout AS (
+    INSERT INTO workouts (name, description, calories_burned, visibility)
+        VALUES ('Full Body Cardio Blast',
+                'Get your heart rate up and burn calories with this full-body cardio workout.',
+                450,
+                'public')
+        RETURNING id)
+INSERT
+INTO exercises (name, sets, reps, workout_id, catalog_id)
+SELECT catalog_exercises.name, 0, 0, workout.id, catalog_exercises.id
+FROM workout,
+     unnest(ARRAY ['Jumping jacks', 'Burpees', 'High knees', 'Mountain climbers', 'Running in place']) WITH ORDINALITY AS names(name, position)
+         INNER JOIN catalog_exercises
+                    ON lower(catalog_exercises.name) = lower(names.name)
+                        OR lower(names.name) IN (SELECT lower(alias) FROM unnest(catalog_exercises.aliases) AS alias)
+ORDER BY names.position;
 
-select * from workouts;
\ No newline at end of file
+SELECT workouts.*, ARRAY(SELECT name FROM exercises WHERE workout_id = workouts.id ORDER BY id) AS exercises
+FROM workouts;
\ No newline at end of file
@@ -0,0 +1,241 @@
+package tracker
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// table is a CSV file with named columns.
+type table struct {
+	columns map[string]int
+	records [][]string
+}
+
+// readTable reads CSV separated by commas or, as Strong writes in some
+// locales, semicolons.
+func readTable(r io.Reader, required ...string) (*table, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+
+	cr := csv.NewReader(bytes.NewReader(data))
+	if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		cr.Comma = ';'
+	}
+
+	records, err := cr.ReadAll()
+	if err != nil {
+		var parseError *csv.ParseError
+		if errors.As(err, &parseError) {
+			return nil, fmt.Errorf("badly-formed CSV (line %d)", parseError.Line)
+		}
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("empty CSV file")
+	}
+
+	t := &table{columns: make(map[string]int), records: records[1:]}
+	for i, name := range records[0] {
+		t.columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range required {
+		if !t.has(name) {
+			return nil, fmt.Errorf("missing column %q", name)
+		}
+	}
+	return t, nil
+}
+
+func (t *table) has(column string) bool {
+	_, ok := t.columns[column]
+	return ok
+}
+
+func (t *table) get(record []string, column string) string {
+	i, ok := t.columns[column]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+func (t *table) float(record []string, row int, column string) (float64, error) {
+	s := t.get(record, column)
+	if s == "" {
+		return 0, nil
+	}
+	// Semicolon-separated exports use decimal commas.
+	f, err := strconv.ParseFloat(strings.ReplaceAll(s, ",", "."), 64)
+	if err != nil {
+		return 0, &RowError{Row: row, Column: column, Err: "must be a number"}
+	}
+	return f, nil
+}
+
+func (t *table) int(record []string, row int, column string) (int, error) {
+	f, err := t.float(record, row, column)
+	if err != nil {
+		return 0, err
+	}
+	if f != float64(int(f)) {
+		return 0, &RowError{Row: row, Column: column, Err: "must be an integer value"}
+	}
+	return int(f), nil
+}
+
+func (t *table) time(record []string, row int, column string, loc *time.Location, layouts ...string) (time.Time, error) {
+	s := t.get(record, column)
+	for _, layout := range layouts {
+		value, err := time.ParseInLocation(layout, s, loc)
+		if err == nil {
+			return value, nil
+		}
+	}
+	return time.Time{}, &RowError{Row: row, Column: column, Err: "must be a date and time"}
+}
+
+// grouper collects sets into activities keyed by their start and name, in
+// the order they first appear.
+type grouper struct {
+	activities []*Activity
+	byKey      map[string]*Activity
+}
+
+func (g *grouper) activity(startedAt time.Time, name string, row int) (*Activity, bool) {
+	if g.byKey == nil {
+		g.byKey = make(map[string]*Activity)
+	}
+	key := startedAt.String() + "\x00" + name
+	if activity, ok := g.byKey[key]; ok {
+		return activity, false
+	}
+	activity := &Activity{Name: name, StartedAt: startedAt, Row: row}
+	g.byKey[key] = activity
+	g.activities = append(g.activities, activity)
+	return activity, true
+}
+
+// ReadStrong reads the CSV export of the Strong app. Its dates have no time
+// zone and are read in loc; its weights and distances are in whatever units
+// the app was set to, so Imperial is never set.
+func ReadStrong(r io.Reader, loc *time.Location) ([]*Activity, error) {
+	t, err := readTable(r, "date", "workout name", "exercise name", "weight", "reps")
+	if err != nil {
+		return nil, err
+	}
+
+	var g grouper
+	for i, record := range t.records {
+		row := i + 1
+
+		// Newer versions of the app write a row for each rest timer.
+		if strings.EqualFold(t.get(record, "set order"), "rest timer") {
+			continue
+		}
+
+		startedAt, err := t.time(record, row, "date", loc, "2006-01-02 15:04:05", "2006-01-02 15:04")
+		if err != nil {
+			return nil, err
+		}
+
+		activity, created := g.activity(startedAt, t.get(record, "workout name"), row)
+		if created {
+			activity.Notes = t.get(record, "workout notes")
+			if s := t.get(record, "duration"); s != "" {
+				duration, err := time.ParseDuration(strings.ReplaceAll(s, " ", ""))
+				if err != nil {
+					return nil, &RowError{Row: row, Column: "duration", Err: "must be a duration such as 1h 5m"}
+				}
+				activity.FinishedAt = startedAt.Add(duration)
+			}
+		}
+
+		set := &Set{Exercise: t.get(record, "exercise name"), Row: row}
+		if set.Weight, err = t.float(record, row, "weight"); err != nil {
+			return nil, err
+		}
+		if set.Reps, err = t.int(record, row, "reps"); err != nil {
+			return nil, err
+		}
+		if set.RPE, err = t.float(record, row, "rpe"); err != nil {
+			return nil, err
+		}
+		if set.Distance, err = t.float(record, row, "distance"); err != nil {
+			return nil, err
+		}
+		if set.Duration, err = t.int(record, row, "seconds"); err != nil {
+			return nil, err
+		}
+		activity.Sets = append(activity.Sets, set)
+	}
+	return g.activities, nil
+}
+
+// ReadHevy reads the CSV export of the Hevy app, whose times have no time
+// zone and are read in loc.
+func ReadHevy(r io.Reader, loc *time.Location) ([]*Activity, error) {
+	t, err := readTable(r, "title", "start_time", "exercise_title", "reps")
+	if err != nil {
+		return nil, err
+	}
+
+	weightColumn, distanceColumn := "weight_kg", "distance_km"
+	imperial := t.has("weight_lbs")
+	if imperial {
+		weightColumn, distanceColumn = "weight_lbs", "distance_miles"
+	}
+
+	layouts := []string{"2 Jan 2006, 15:04", "2006-01-02 15:04:05", time.RFC3339}
+
+	var g grouper
+	for i, record := range t.records {
+		row := i + 1
+
+		startedAt, err := t.time(record, row, "start_time", loc, layouts...)
+		if err != nil {
+			return nil, err
+		}
+
+		activity, created := g.activity(startedAt, t.get(record, "title"), row)
+		if created {
+			activity.Notes = t.get(record, "description")
+			activity.Imperial = imperial
+			if t.get(record, "end_time") != "" {
+				activity.FinishedAt, err = t.time(record, row, "end_time", loc, layouts...)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		set := &Set{Exercise: t.get(record, "exercise_title"), Row: row}
+		if set.Weight, err = t.float(record, row, weightColumn); err != nil {
+			return nil, err
+		}
+		if set.Reps, err = t.int(record, row, "reps"); err != nil {
+			return nil, err
+		}
+		if set.RPE, err = t.float(record, row, "rpe"); err != nil {
+			return nil, err
+		}
+		if set.Distance, err = t.float(record, row, distanceColumn); err != nil {
+			return nil, err
+		}
+		if set.Duration, err = t.int(record, row, "duration_seconds"); err != nil {
+			return nil, err
+		}
+		activity.Sets = append(activity.Sets, set)
+	}
+	return g.activities, nil
+}
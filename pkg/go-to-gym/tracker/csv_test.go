@@ -0,0 +1,258 @@
+package tracker
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// checkActivities compares activities field by field, comparing times with
+// Equal.
+func checkActivities(t *testing.T, got, want []*Activity) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d activities; want %d", len(got), len(want))
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.Name != w.Name || g.Sport != w.Sport || g.Notes != w.Notes || g.Imperial != w.Imperial ||
+			g.Distance != w.Distance || g.Calories != w.Calories || g.Row != w.Row {
+			t.Errorf("activity %d = %+v; want %+v", i, *g, *w)
+		}
+		if !g.StartedAt.Equal(w.StartedAt) || !g.FinishedAt.Equal(w.FinishedAt) {
+			t.Errorf("activity %d runs from %v to %v; want %v to %v", i, g.StartedAt, g.FinishedAt, w.StartedAt, w.FinishedAt)
+		}
+		if len(g.Sets) != len(w.Sets) {
+			t.Errorf("activity %d has %d sets; want %d", i, len(g.Sets), len(w.Sets))
+			continue
+		}
+		for j := range w.Sets {
+			if *g.Sets[j] != *w.Sets[j] {
+				t.Errorf("activity %d set %d = %+v; want %+v", i, j, *g.Sets[j], *w.Sets[j])
+			}
+		}
+	}
+}
+
+// checkRowError makes sure err is a RowError for the row and column.
+func checkRowError(t *testing.T, err error, row int, column string) {
+	t.Helper()
+
+	var rowError *RowError
+	if !errors.As(err, &rowError) {
+		t.Fatalf("got error %v; want a RowError", err)
+	}
+	if rowError.Row != row || rowError.Column != column {
+		t.Errorf("got error in row %d, column %q; want row %d, column %q", rowError.Row, rowError.Column, row, column)
+	}
+}
+
+func TestReadStrong(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+
+	tests := []struct {
+		name string
+		csv  string
+		loc  *time.Location
+		want []*Activity
+	}{
+		{
+			name: "comma separated",
+			csv: "Date,Workout Name,Duration,Exercise Name,Set Order,Weight,Reps,Distance,Seconds,Notes,Workout Notes,RPE\n" +
+				"2024-01-05 18:00:00,Push,1h 5m,Bench Press (Barbell),1,80,5,0,0,,Felt good,8\n" +
+				"2024-01-05 18:00:00,Push,1h 5m,Bench Press (Barbell),Rest Timer,0,0,0,90,,,\n" +
+				"2024-01-05 18:00:00,Push,1h 5m,Bench Press (Barbell),2,82.5,3,0,0,,,9.5\n" +
+				"2024-01-07 09:30:00,Cardio,30m,Running,1,0,0,5.2,1800,,,\n",
+			loc: time.UTC,
+			want: []*Activity{
+				{
+					Name:       "Push",
+					StartedAt:  time.Date(2024, 1, 5, 18, 0, 0, 0, time.UTC),
+					FinishedAt: time.Date(2024, 1, 5, 19, 5, 0, 0, time.UTC),
+					Notes:      "Felt good",
+					Row:        1,
+					Sets: []*Set{
+						{Exercise: "Bench Press (Barbell)", Weight: 80, Reps: 5, RPE: 8, Row: 1},
+						{Exercise: "Bench Press (Barbell)", Weight: 82.5, Reps: 3, RPE: 9.5, Row: 3},
+					},
+				},
+				{
+					Name:       "Cardio",
+					StartedAt:  time.Date(2024, 1, 7, 9, 30, 0, 0, time.UTC),
+					FinishedAt: time.Date(2024, 1, 7, 10, 0, 0, 0, time.UTC),
+					Row:        4,
+					Sets: []*Set{
+						{Exercise: "Running", Distance: 5.2, Duration: 1800, Row: 4},
+					},
+				},
+			},
+		},
+		{
+			name: "semicolons, decimal commas and a byte order mark",
+			csv: "\ufeffDate;Workout Name;Exercise Name;Weight;Reps\n" +
+				"2024-03-01 07:15;Legs;Squat;102,5;5\n",
+			loc: berlin,
+			want: []*Activity{
+				{
+					Name:      "Legs",
+					StartedAt: time.Date(2024, 3, 1, 7, 15, 0, 0, berlin),
+					Row:       1,
+					Sets: []*Set{
+						{Exercise: "Squat", Weight: 102.5, Reps: 5, Row: 1},
+					},
+				},
+			},
+		},
+		{
+			name: "header only",
+			csv:  "Date,Workout Name,Exercise Name,Weight,Reps\n",
+			loc:  time.UTC,
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadStrong(strings.NewReader(tt.csv), tt.loc)
+			if err != nil {
+				t.Fatalf("ReadStrong returned error: %v", err)
+			}
+			checkActivities(t, got, tt.want)
+		})
+	}
+}
+
+func TestReadStrongErrors(t *testing.T) {
+	const header = "Date,Workout Name,Duration,Exercise Name,Weight,Reps\n"
+
+	tests := []struct {
+		name   string
+		csv    string
+		row    int
+		column string
+	}{
+		{"bad date", header + "05/01/2024,Push,,Bench Press,80,5\n", 1, "date"},
+		{"bad weight", header + "2024-01-05 18:00:00,Push,,Bench Press,heavy,5\n", 1, "weight"},
+		{"fractional reps", header + "2024-01-05 18:00:00,Push,,Bench Press,80,5\n2024-01-05 18:00:00,Push,,Bench Press,80,2.5\n", 2, "reps"},
+		{"bad duration", header + "2024-01-05 18:00:00,Push,an hour,Bench Press,80,5\n", 1, "duration"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadStrong(strings.NewReader(tt.csv), time.UTC)
+			checkRowError(t, err, tt.row, tt.column)
+		})
+	}
+}
+
+func TestReadStrongBadFiles(t *testing.T) {
+	tests := []struct {
+		name string
+		csv  string
+		want string
+	}{
+		{"empty", "", "empty CSV file"},
+		{"missing column", "Date,Workout Name,Exercise Name,Weight\n", `missing column "reps"`},
+		{"badly formed", "Date,Workout Name,Exercise Name,Weight,Reps\n\"2024-01-05,Push\n", "badly-formed CSV (line 2)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadStrong(strings.NewReader(tt.csv), time.UTC)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("got error %v; want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadHevy(t *testing.T) {
+	tests := []struct {
+		name string
+		csv  string
+		want []*Activity
+	}{
+		{
+			name: "metric",
+			csv: "title,start_time,end_time,description,exercise_title,set_index,weight_kg,reps,distance_km,duration_seconds,rpe\n" +
+				"Upper,\"5 Jan 2024, 18:00\",\"5 Jan 2024, 19:10\",Deload,Bench Press (Barbell),0,60,8,,,7\n" +
+				"Upper,\"5 Jan 2024, 18:00\",\"5 Jan 2024, 19:10\",Deload,Plank,1,,,,60,\n" +
+				"Lower,\"6 Jan 2024, 10:00\",,,Squat (Barbell),0,100,5,,,\n",
+			want: []*Activity{
+				{
+					Name:       "Upper",
+					StartedAt:  time.Date(2024, 1, 5, 18, 0, 0, 0, time.UTC),
+					FinishedAt: time.Date(2024, 1, 5, 19, 10, 0, 0, time.UTC),
+					Notes:      "Deload",
+					Row:        1,
+					Sets: []*Set{
+						{Exercise: "Bench Press (Barbell)", Weight: 60, Reps: 8, RPE: 7, Row: 1},
+						{Exercise: "Plank", Duration: 60, Row: 2},
+					},
+				},
+				{
+					Name:      "Lower",
+					StartedAt: time.Date(2024, 1, 6, 10, 0, 0, 0, time.UTC),
+					Row:       3,
+					Sets: []*Set{
+						{Exercise: "Squat (Barbell)", Weight: 100, Reps: 5, Row: 3},
+					},
+				},
+			},
+		},
+		{
+			name: "imperial",
+			csv: "title,start_time,end_time,exercise_title,weight_lbs,reps,distance_miles,duration_seconds\n" +
+				"Run,2024-02-10 08:00:00,2024-02-10 08:30:00,Running,,,3.1,1800\n",
+			want: []*Activity{
+				{
+					Name:       "Run",
+					StartedAt:  time.Date(2024, 2, 10, 8, 0, 0, 0, time.UTC),
+					FinishedAt: time.Date(2024, 2, 10, 8, 30, 0, 0, time.UTC),
+					Imperial:   true,
+					Row:        1,
+					Sets: []*Set{
+						{Exercise: "Running", Distance: 3.1, Duration: 1800, Row: 1},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadHevy(strings.NewReader(tt.csv), time.UTC)
+			if err != nil {
+				t.Fatalf("ReadHevy returned error: %v", err)
+			}
+			checkActivities(t, got, tt.want)
+		})
+	}
+}
+
+func TestReadHevyErrors(t *testing.T) {
+	const header = "title,start_time,end_time,exercise_title,weight_kg,reps\n"
+
+	tests := []struct {
+		name   string
+		csv    string
+		row    int
+		column string
+	}{
+		{"bad start time", header + "Upper,yesterday,,Bench Press,60,8\n", 1, "start_time"},
+		{"bad end time", header + "Upper,2024-01-05 18:00:00,later,Bench Press,60,8\n", 1, "end_time"},
+		{"bad reps", header + "Upper,2024-01-05 18:00:00,,Bench Press,60,eight\n", 1, "reps"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadHevy(strings.NewReader(tt.csv), time.UTC)
+			checkRowError(t, err, tt.row, tt.column)
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package tracker
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+type gpxFile struct {
+	Metadata struct {
+		Time time.Time `xml:"time"`
+	} `xml:"metadata"`
+	Tracks []struct {
+		Name     string `xml:"name"`
+		Desc     string `xml:"desc"`
+		Type     string `xml:"type"`
+		Segments []struct {
+			Points []struct {
+				Lat  float64   `xml:"lat,attr"`
+				Lon  float64   `xml:"lon,attr"`
+				Time time.Time `xml:"time"`
+			} `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+// ReadGPX reads each track of a GPX file as an activity. The distance is
+// measured along the track, and the sport is guessed from the track's type.
+func ReadGPX(r io.Reader) ([]*Activity, error) {
+	var file gpxFile
+	err := xml.NewDecoder(r).Decode(&file)
+	if err != nil {
+		return nil, fmt.Errorf("badly-formed GPX: %w", err)
+	}
+
+	var activities []*Activity
+	for i, track := range file.Tracks {
+		activity := &Activity{
+			Name:  track.Name,
+			Sport: normalizeSport(track.Type),
+			Notes: track.Desc,
+			Row:   i + 1,
+		}
+
+		for _, segment := range track.Segments {
+			for j, point := range segment.Points {
+				if !point.Time.IsZero() {
+					if activity.StartedAt.IsZero() {
+						activity.StartedAt = point.Time
+					}
+					activity.FinishedAt = point.Time
+				}
+				if j > 0 {
+					previous := segment.Points[j-1]
+					activity.Distance += haversine(previous.Lat, previous.Lon, point.Lat, point.Lon)
+				}
+			}
+		}
+
+		if activity.StartedAt.IsZero() {
+			activity.StartedAt = file.Metadata.Time
+		}
+		if activity.StartedAt.IsZero() {
+			return nil, &RowError{Row: activity.Row, Column: "time", Err: "must be recorded for the track's points"}
+		}
+		activity.Distance = math.Round(activity.Distance*100) / 100
+		activities = append(activities, activity)
+	}
+
+	if len(activities) == 0 {
+		return nil, errors.New("GPX file has no tracks")
+	}
+	return activities, nil
+}
+
+type tcxFile struct {
+	Activities []struct {
+		Sport string    `xml:"Sport,attr"`
+		ID    time.Time `xml:"Id"`
+		Notes string    `xml:"Notes"`
+		Laps  []struct {
+			StartTime        time.Time `xml:"StartTime,attr"`
+			TotalTimeSeconds float64   `xml:"TotalTimeSeconds"`
+			DistanceMeters   float64   `xml:"DistanceMeters"`
+			Calories         int       `xml:"Calories"`
+		} `xml:"Lap"`
+	} `xml:"Activities>Activity"`
+}
+
+// ReadTCX reads each activity of a TCX file, adding up the time, distance and
+// calories of its laps.
+func ReadTCX(r io.Reader) ([]*Activity, error) {
+	var file tcxFile
+	err := xml.NewDecoder(r).Decode(&file)
+	if err != nil {
+		return nil, fmt.Errorf("badly-formed TCX: %w", err)
+	}
+
+	var activities []*Activity
+	for i, a := range file.Activities {
+		activity := &Activity{
+			Sport:     normalizeSport(a.Sport),
+			StartedAt: a.ID,
+			Notes:     a.Notes,
+			Row:       i + 1,
+		}
+
+		var meters float64
+		for _, lap := range a.Laps {
+			if activity.StartedAt.IsZero() {
+				activity.StartedAt = lap.StartTime
+			}
+			end := lap.StartTime.Add(time.Duration(lap.TotalTimeSeconds * float64(time.Second)))
+			if end.After(activity.FinishedAt) {
+				activity.FinishedAt = end
+			}
+			meters += lap.DistanceMeters
+			activity.Calories += lap.Calories
+		}
+
+		if activity.StartedAt.IsZero() {
+			return nil, &RowError{Row: activity.Row, Column: "Id", Err: "must be the activity's start time"}
+		}
+		activity.Distance = math.Round(meters/10) / 100
+		activities = append(activities, activity)
+	}
+
+	if len(activities) == 0 {
+		return nil, errors.New("TCX file has no activities")
+	}
+	return activities, nil
+}
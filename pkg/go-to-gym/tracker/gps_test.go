@@ -0,0 +1,207 @@
+package tracker
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadGPX(t *testing.T) {
+	tests := []struct {
+		name string
+		gpx  string
+		want []*Activity
+	}{
+		{
+			name: "run across two segments",
+			gpx: `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+  <trk>
+    <name>Morning Run</name>
+    <desc>Easy pace</desc>
+    <type>running</type>
+    <trkseg>
+      <trkpt lat="0" lon="0"><time>2024-05-01T06:00:00Z</time></trkpt>
+      <trkpt lat="0.01" lon="0"><time>2024-05-01T06:05:00Z</time></trkpt>
+    </trkseg>
+    <trkseg>
+      <trkpt lat="0.02" lon="0"><time>2024-05-01T06:10:00Z</time></trkpt>
+      <trkpt lat="0.03" lon="0"><time>2024-05-01T06:15:00Z</time></trkpt>
+    </trkseg>
+  </trk>
+</gpx>`,
+			want: []*Activity{
+				{
+					Name:       "Morning Run",
+					Sport:      SportRunning,
+					Notes:      "Easy pace",
+					StartedAt:  time.Date(2024, 5, 1, 6, 0, 0, 0, time.UTC),
+					FinishedAt: time.Date(2024, 5, 1, 6, 15, 0, 0, time.UTC),
+					// The gap between segments isn't counted.
+					Distance: 2.22,
+					Row:      1,
+				},
+			},
+		},
+		{
+			name: "tracks without times or a type",
+			gpx: `<gpx version="1.1" xmlns="http://www.topografix.com/GPX/1/1">
+  <metadata><time>2024-05-02T17:00:00Z</time></metadata>
+  <trk>
+    <name>Ride</name>
+    <trkseg>
+      <trkpt lat="0" lon="0"></trkpt>
+      <trkpt lat="0" lon="0.1"></trkpt>
+    </trkseg>
+  </trk>
+  <trk>
+    <name>Ride back</name>
+    <type>cycling</type>
+    <trkseg>
+      <trkpt lat="0" lon="0.1"></trkpt>
+      <trkpt lat="0" lon="0"></trkpt>
+    </trkseg>
+  </trk>
+</gpx>`,
+			want: []*Activity{
+				{
+					Name:      "Ride",
+					StartedAt: time.Date(2024, 5, 2, 17, 0, 0, 0, time.UTC),
+					Distance:  11.12,
+					Row:       1,
+				},
+				{
+					Name:      "Ride back",
+					Sport:     SportCycling,
+					StartedAt: time.Date(2024, 5, 2, 17, 0, 0, 0, time.UTC),
+					Distance:  11.12,
+					Row:       2,
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadGPX(strings.NewReader(tt.gpx))
+			if err != nil {
+				t.Fatalf("ReadGPX returned error: %v", err)
+			}
+			checkActivities(t, got, tt.want)
+		})
+	}
+}
+
+func TestReadGPXErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		gpx  string
+		want string
+	}{
+		{"not XML", "time,lat,lon\n", "badly-formed GPX: EOF"},
+		{"no tracks", `<gpx version="1.1"></gpx>`, "GPX file has no tracks"},
+		{"no times", `<gpx><trk><trkseg><trkpt lat="0" lon="0"></trkpt></trkseg></trk></gpx>`, "row 1: time must be recorded for the track's points"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadGPX(strings.NewReader(tt.gpx))
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("got error %v; want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadTCX(t *testing.T) {
+	tests := []struct {
+		name string
+		tcx  string
+		want []*Activity
+	}{
+		{
+			name: "activities with laps",
+			tcx: `<?xml version="1.0" encoding="UTF-8"?>
+<TrainingCenterDatabase xmlns="http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2">
+  <Activities>
+    <Activity Sport="Running">
+      <Id>2024-06-01T07:00:00Z</Id>
+      <Lap StartTime="2024-06-01T07:00:00Z">
+        <TotalTimeSeconds>600</TotalTimeSeconds>
+        <DistanceMeters>2000</DistanceMeters>
+        <Calories>150</Calories>
+      </Lap>
+      <Lap StartTime="2024-06-01T07:10:00Z">
+        <TotalTimeSeconds>630.5</TotalTimeSeconds>
+        <DistanceMeters>2014.6</DistanceMeters>
+        <Calories>160</Calories>
+      </Lap>
+      <Notes>Tempo</Notes>
+    </Activity>
+    <Activity Sport="Biking">
+      <Lap StartTime="2024-06-02T18:00:00Z">
+        <TotalTimeSeconds>3600</TotalTimeSeconds>
+        <DistanceMeters>30000</DistanceMeters>
+      </Lap>
+    </Activity>
+    <Activity Sport="Other">
+      <Id>2024-06-03T12:00:00Z</Id>
+    </Activity>
+  </Activities>
+</TrainingCenterDatabase>`,
+			want: []*Activity{
+				{
+					Sport:      SportRunning,
+					Notes:      "Tempo",
+					StartedAt:  time.Date(2024, 6, 1, 7, 0, 0, 0, time.UTC),
+					FinishedAt: time.Date(2024, 6, 1, 7, 20, 30, 500000000, time.UTC),
+					Distance:   4.01,
+					Calories:   310,
+					Row:        1,
+				},
+				{
+					Sport:      SportCycling,
+					StartedAt:  time.Date(2024, 6, 2, 18, 0, 0, 0, time.UTC),
+					FinishedAt: time.Date(2024, 6, 2, 19, 0, 0, 0, time.UTC),
+					Distance:   30,
+					Row:        2,
+				},
+				{
+					StartedAt: time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC),
+					Row:       3,
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadTCX(strings.NewReader(tt.tcx))
+			if err != nil {
+				t.Fatalf("ReadTCX returned error: %v", err)
+			}
+			checkActivities(t, got, tt.want)
+		})
+	}
+}
+
+func TestReadTCXErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		tcx  string
+		want string
+	}{
+		{"not XML", "{}", "badly-formed TCX: EOF"},
+		{"no activities", `<TrainingCenterDatabase><Activities></Activities></TrainingCenterDatabase>`, "TCX file has no activities"},
+		{"no start time", `<TrainingCenterDatabase><Activities><Activity Sport="Running"></Activity></Activities></TrainingCenterDatabase>`, "row 1: Id must be the activity's start time"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadTCX(strings.NewReader(tt.tcx))
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("got error %v; want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+// Package tracker reads workout history exported by other fitness apps: the
+// CSV exports of Strong and Hevy, and GPX or TCX files of runs and rides.
+package tracker
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	SportRunning = "running"
+	SportCycling = "cycling"
+)
+
+// Activity is one logged workout. Lifting activities have an empty Sport.
+type Activity struct {
+	Name       string
+	Sport      string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Notes      string
+	// Imperial is set when weights are in pounds and distances in miles
+	// rather than kilograms and kilometres.
+	Imperial bool
+	Distance float64
+	Calories int
+	Sets     []*Set
+	// Row is the CSV row of the activity's first set, counting from 1 without
+	// the header, or the position of the track or activity in a GPX or TCX
+	// file.
+	Row int
+}
+
+// Set is a set of an exercise. Cardio and timed exercises have a distance or
+// a duration instead of reps.
+type Set struct {
+	Exercise string
+	Weight   float64
+	Reps     int
+	RPE      float64
+	Distance float64
+	Duration int
+	Row      int
+}
+
+// RowError reports a value that could not be read.
+type RowError struct {
+	Row    int
+	Column string
+	Err    string
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("row %d: %s %s", e.Row, e.Column, e.Err)
+}
+
+// normalizeSport maps the activity types used by trackers to SportRunning or
+// SportCycling, or returns "" for anything else.
+func normalizeSport(sport string) string {
+	sport = strings.ToLower(sport)
+	switch {
+	case strings.Contains(sport, "run"):
+		return SportRunning
+	case strings.Contains(sport, "cycl"), strings.Contains(sport, "bik"), strings.Contains(sport, "ride"):
+		return SportCycling
+	}
+	return ""
+}
+
+// haversine returns the distance in kilometres between two points.
+func haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadius = 6371.0088
+
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := rad(lat2 - lat1)
+	dLon := rad(lon2 - lon1)
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(rad(lat1))*math.Cos(rad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
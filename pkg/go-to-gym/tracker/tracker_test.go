@@ -0,0 +1,54 @@
+package tracker
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNormalizeSport(t *testing.T) {
+	tests := []struct {
+		sport string
+		want  string
+	}{
+		{"Running", SportRunning},
+		{"running", SportRunning},
+		{"trail_run", SportRunning},
+		{"Biking", SportCycling},
+		{"cycling", SportCycling},
+		{"VirtualRide", SportCycling},
+		{"Other", ""},
+		{"swimming", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sport, func(t *testing.T) {
+			if got := normalizeSport(tt.sport); got != tt.want {
+				t.Errorf("normalizeSport(%q) = %q; want %q", tt.sport, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHaversine(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+		want                   float64
+	}{
+		{"same point", 51.5, -0.12, 51.5, -0.12, 0},
+		{"one degree of latitude", 0, 0, 1, 0, 111.2},
+		{"one degree of longitude at the equator", 0, 0, 0, 1, 111.2},
+		{"London to Paris", 51.5074, -0.1278, 48.8566, 2.3522, 343.6},
+		{"across the antimeridian", 0, 179.5, 0, -179.5, 111.2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := haversine(tt.lat1, tt.lon1, tt.lat2, tt.lon2)
+			if math.Abs(got-tt.want) > 0.1 {
+				t.Errorf("haversine(%v, %v, %v, %v) = %.2f; want %.1f", tt.lat1, tt.lon1, tt.lat2, tt.lon2, got, tt.want)
+			}
+		})
+	}
+}